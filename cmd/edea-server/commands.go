@@ -0,0 +1,448 @@
+package main
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"gitlab.com/edea-dev/edea-server/internal/check"
+	"gitlab.com/edea-dev/edea-server/internal/config"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/refresh"
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"gitlab.com/edea-dev/edea-server/internal/search"
+	"go.uber.org/zap"
+)
+
+// command is a subcommand of edea-server, run returns the exit code
+type command struct {
+	name  string
+	args  string
+	short string
+	run   func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	// assigned here because usage refers to commands
+	commands = []command{
+		{"serve", "[-graceful-timeout 15s]", "run the web server, the default", serve},
+		{"migrate", "[-to version] [up|down|status]", "apply or roll back database migrations, or list them", migrateCmd},
+		{"reindex", "", "rebuild the search index from the database", reindexCmd},
+		{"pull-all", "", "fetch all module repositories and update the modules", pullAllCmd},
+		{"create-user", "[-admin] [-subject id] [-name display-name] handle", "create a user, subject is their id at the identity provider", createUserCmd},
+		{"promote-admin", "[-revoke] handle", "grant or revoke admin privileges", promoteAdminCmd},
+		{"cache-gc", "[-all]", "recalculate repository sizes and evict unused repositories", cacheGCCmd},
+		{"export-user", "[-o file] handle", "write a zip archive with the data of a user", exportUserCmd},
+		{"check", "[-repair]", "look for inconsistencies between the repository cache, database and search index", checkCmd},
+	}
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+
+	fmt.Fprintf(out, "usage: %s [flags] [command] [args]\n\ncommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %s %s\n    \t%s\n", c.name, c.args, c.short)
+	}
+	fmt.Fprintln(out, "\nflags:")
+	flag.PrintDefaults()
+}
+
+func (c *command) usage(fs *flag.FlagSet) {
+	fmt.Fprintf(fs.Output(), "usage: %s %s %s\n", os.Args[0], c.name, c.args)
+	fs.PrintDefaults()
+}
+
+// parse parses the flags of a command and checks the number of positional arguments
+func parse(fs *flag.FlagSet, args []string, positional int) bool {
+	cmd := findCommand(fs.Name())
+	fs.Usage = func() { cmd.usage(fs) }
+
+	if err := fs.Parse(args); err != nil {
+		return false
+	}
+	if fs.NArg() != positional {
+		fs.Usage()
+		return false
+	}
+
+	return true
+}
+
+// setup connects to the database and initializes the repository cache and search,
+// most commands need all of that
+func setup() bool {
+	if err := connectDB(); err != nil {
+		zap.L().Error("could not connect to the database", zap.Error(err))
+		return false
+	}
+
+	repo.InitCache(config.Cfg.Cache.Repo.Base, config.Cfg.Cache.Repo.MaxSize<<20)
+
+	if err := search.Init(config.Cfg.Search.Backend, config.Cfg.Search.Host, config.Cfg.Search.Index, config.Cfg.Search.APIKey); err != nil {
+		zap.L().Error("could not init search", zap.Error(err))
+	}
+
+	return true
+}
+
+// commandContext is cancelled on an interrupt and can change data like the system itself
+func commandContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	return model.SystemContext(ctx), cancel
+}
+
+func migrateCmd(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	to := fs.Int("to", -1, "version to migrate up or down to, defaults to the latest for up and the previous one for down")
+	fs.Usage = func() { findCommand("migrate").usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	action := "up"
+	if fs.NArg() > 0 {
+		action = fs.Arg(0)
+	}
+	if fs.NArg() > 1 || (action != "up" && action != "down" && action != "status") {
+		fs.Usage()
+		return 2
+	}
+
+	if err := connectDB(); err != nil {
+		zap.L().Error("could not connect to the database", zap.Error(err))
+		return 1
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	switch action {
+	case "status":
+		return migrationStatus(ctx)
+	case "down":
+		return migrateDown(ctx, *to)
+	}
+
+	target := *to
+	if target < 0 {
+		target = 0
+	}
+
+	if err := migrate(target); err != nil {
+		zap.L().Error("could not migrate the database", zap.Error(err))
+		return 1
+	}
+
+	return migrationStatus(ctx)
+}
+
+func migrateDown(ctx context.Context, target int) int {
+	if target < 0 {
+		states, err := model.Migrations(ctx)
+		if err != nil {
+			zap.L().Error("could not fetch the migrations", zap.Error(err))
+			return 1
+		}
+
+		// one step back from the newest applied migration
+		target = 0
+		current := 0
+		for _, s := range states {
+			if s.Applied {
+				target, current = current, s.Version
+			}
+		}
+	}
+
+	rolledBack, err := model.MigrateDown(ctx, target)
+	if err != nil {
+		zap.L().Error("could not roll back the database", zap.Error(err))
+		return 1
+	}
+
+	for _, m := range rolledBack {
+		fmt.Printf("rolled back %d %s\n", m.Version, m.Name)
+	}
+
+	return migrationStatus(ctx)
+}
+
+func migrationStatus(ctx context.Context) int {
+	states, err := model.Migrations(ctx)
+	if err != nil {
+		zap.L().Error("could not fetch the migrations", zap.Error(err))
+		return 1
+	}
+
+	code := 0
+	for _, s := range states {
+		switch {
+		case s.Unknown:
+			fmt.Printf("%4d %-40s applied %s, unknown to this binary\n", s.Version, s.Name, s.AppliedAt.Format(time.RFC3339))
+			code = 1
+		case s.Applied:
+			fmt.Printf("%4d %-40s applied %s\n", s.Version, s.Name, s.AppliedAt.Format(time.RFC3339))
+		default:
+			fmt.Printf("%4d %-40s pending\n", s.Version, s.Name)
+		}
+	}
+
+	return code
+}
+
+func reindexCmd(args []string) int {
+	fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+	if !parse(fs, args, 0) {
+		return 2
+	}
+	if !setup() {
+		return 1
+	}
+
+	n, err := search.ReIndex()
+	if err != nil {
+		zap.L().Error("could not rebuild the search index", zap.Error(err))
+		return 1
+	}
+
+	fmt.Printf("indexed %d benches and modules\n", n)
+	return 0
+}
+
+func pullAllCmd(args []string) int {
+	fs := flag.NewFlagSet("pull-all", flag.ExitOnError)
+	if !parse(fs, args, 0) {
+		return 2
+	}
+	if !setup() {
+		return 1
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	if err := refresh.All(ctx, config.Cfg.Refresh.Concurrency); err != nil {
+		zap.L().Error("could not refresh the repositories", zap.Error(err))
+		return 1
+	}
+
+	var failed []model.Module
+	if result := model.DB.Where("refresh_error <> ''").Find(&failed); result.Error != nil {
+		zap.L().Error("could not fetch modules with refresh errors", zap.Error(result.Error))
+		return 1
+	}
+
+	for _, m := range failed {
+		fmt.Printf("%s (%s): %s\n", m.Name, m.RepoURL, m.RefreshError)
+	}
+	fmt.Printf("refreshed all repositories, %d modules failed\n", len(failed))
+
+	if len(failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func createUserCmd(args []string) int {
+	fs := flag.NewFlagSet("create-user", flag.ExitOnError)
+	admin := fs.Bool("admin", false, "make the user an admin")
+	subject := fs.String("subject", "", "the subject of the user at the identity provider, defaults to the handle")
+	name := fs.String("name", "", "display name, defaults to the handle")
+	if !parse(fs, args, 1) {
+		return 2
+	}
+	if !setup() {
+		return 1
+	}
+
+	u := &model.User{Handle: fs.Arg(0), AuthUUID: *subject, IsAdmin: *admin}
+	if u.AuthUUID == "" {
+		u.AuthUUID = u.Handle
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	if err := ops.CreateUser(ctx, u, &model.Profile{DisplayName: *name}); err != nil {
+		zap.L().Error("could not create the user", zap.Error(err))
+		return 1
+	}
+
+	fmt.Printf("created user %s with id %s\n", u.Handle, u.ID)
+	return 0
+}
+
+func promoteAdminCmd(args []string) int {
+	fs := flag.NewFlagSet("promote-admin", flag.ExitOnError)
+	revoke := fs.Bool("revoke", false, "take the admin privileges away instead")
+	if !parse(fs, args, 1) {
+		return 2
+	}
+	if !setup() {
+		return 1
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	u, err := ops.SetAdmin(ctx, fs.Arg(0), !*revoke)
+	if err != nil {
+		zap.L().Error("could not change the admin privileges", zap.Error(err))
+		return 1
+	}
+
+	if *revoke {
+		fmt.Printf("%s is no admin anymore\n", u.Handle)
+	} else {
+		fmt.Printf("%s is an admin now\n", u.Handle)
+	}
+	return 0
+}
+
+func cacheGCCmd(args []string) int {
+	fs := flag.NewFlagSet("cache-gc", flag.ExitOnError)
+	all := fs.Bool("all", false, "evict every unused repository, not only until the cache fits into max_size")
+	if !parse(fs, args, 0) {
+		return 2
+	}
+	if !setup() {
+		return 1
+	}
+
+	if err := repo.UpdateSizes(); err != nil {
+		zap.L().Error("could not update repository sizes", zap.Error(err))
+		return 1
+	}
+
+	var evicted []model.Repository
+	var err error
+
+	if *all {
+		evicted, err = repo.EvictUnused()
+	} else {
+		evicted, err = repo.Evict()
+	}
+	if err != nil {
+		zap.L().Error("could not evict repositories", zap.Error(err))
+		return 1
+	}
+
+	var freed int64
+	for _, r := range evicted {
+		fmt.Printf("evicted %s\n", r.URL)
+		freed += r.Size
+	}
+
+	usage, err := repo.Usage()
+	if err != nil {
+		zap.L().Error("could not fetch repository cache usage", zap.Error(err))
+		return 1
+	}
+
+	fmt.Printf("freed %d bytes, %d repositories use %d bytes\n", freed, len(usage.Entries), usage.Total)
+	return 0
+}
+
+func exportUserCmd(args []string) int {
+	fs := flag.NewFlagSet("export-user", flag.ExitOnError)
+	out := fs.String("o", "", "output file, defaults to <handle>.zip")
+	if !parse(fs, args, 1) {
+		return 2
+	}
+	if !setup() {
+		return 1
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	u, err := ops.UserByHandle(ctx, fs.Arg(0))
+	if err != nil {
+		zap.L().Error("could not find the user", zap.Error(err))
+		return 1
+	}
+
+	if *out == "" {
+		*out = u.Handle + ".zip"
+	}
+
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		zap.L().Error("could not create the archive", zap.Error(err))
+		return 1
+	}
+
+	err = ops.ExportUser(ctx, u, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		zap.L().Error("could not export the user", zap.Error(err))
+		_ = os.Remove(*out)
+		return 1
+	}
+
+	fmt.Printf("wrote %s\n", *out)
+	return 0
+}
+
+func checkCmd(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "also repair what it finds")
+	if !parse(fs, args, 0) {
+		return 2
+	}
+	if !setup() {
+		return 1
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	report, err := check.Run(ctx, *repair)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		zap.L().Error("consistency check failed", zap.Error(err))
+	}
+
+	for _, p := range report.Problems {
+		status := "found"
+		switch {
+		case p.Repaired:
+			status = "repaired"
+		case p.Error != "":
+			status = "failed: " + p.Error
+		}
+		fmt.Printf("%-18s %s %s (%s)\n", p.Kind, p.Subject, p.Detail, status)
+	}
+
+	if report.SearchSkipped {
+		fmt.Println("search index not checked, the search backend is not available")
+	}
+
+	unresolved := report.Unresolved()
+	fmt.Printf("%d problems, %d unresolved\n", len(report.Problems), unresolved)
+
+	if err != nil || unresolved > 0 {
+		return 1
+	}
+	return 0
+}
@@ -4,8 +4,13 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/glebarez/sqlite"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/stdlib"
 	"gitlab.com/edea-dev/edea-server/internal/config"
@@ -17,53 +22,116 @@ import (
 	"moul.io/zapgorm2"
 )
 
+// db connects to the database and applies pending migrations, it refuses
+// to work with a schema which is newer than this binary
 func db() error {
-	var err error
+	if err := connectDB(); err != nil {
+		return err
+	}
+
+	if err := model.CheckSchema(context.Background()); err != nil {
+		return err
+	}
+
+	return migrate(0)
+}
+
+// connectDB waits for the database to be ready and connects to it,
+// SQLite is used if the DSN points to a file, see sqlitePath
+func connectDB() error {
+	var dialector gorm.Dialector
 
-	// start connection pool
 	dsn := config.Cfg.DSN
 
+	if path, ok := sqlitePath(dsn); ok {
+		zap.L().Info("using sqlite", zap.String("path", path))
+		dialector = sqlite.Open(path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	} else {
+		conn, err := connectPostgres(dsn)
+		if err != nil {
+			return err
+		}
+		dialector = postgres.New(postgres.Config{Conn: conn})
+	}
+
+	gl := zapgorm2.New(zap.L())
+	gl.SetAsDefault()
+	gl.IgnoreRecordNotFoundError = true
+	gl.LogLevel = logger.Info
+
+	var err error
+
+	model.DB, err = gorm.Open(dialector, &gorm.Config{Logger: gl})
+	if err != nil {
+		return err
+	}
+
+	if model.SQLite(model.DB) {
+		// sqlite has a single writer anyway, this way we never see "database is locked"
+		sqlDB, err := model.DB.DB()
+		if err != nil {
+			return err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	return model.RegisterCallbacks(model.DB)
+}
+
+// sqlitePath returns the database file if the DSN is "sqlite:<path>", "file:<path>"
+// or a path ending in .db, .sqlite or .sqlite3
+func sqlitePath(dsn string) (string, bool) {
+	for _, prefix := range []string{"sqlite://", "sqlite:", "file:"} {
+		if strings.HasPrefix(dsn, prefix) {
+			return strings.TrimPrefix(dsn, prefix), true
+		}
+	}
+
+	switch filepath.Ext(dsn) {
+	case ".db", ".sqlite", ".sqlite3":
+		return dsn, true
+	}
+
+	return "", false
+}
+
+// connectPostgres waits up to a minute for postgres to accept connections
+func connectPostgres(dsn string) (*sql.DB, error) {
 	cfg, err := pgx.ParseConfig(dsn)
 	if err != nil {
-		zap.L().Fatal("could not parse db config", zap.String("dsn", dsn))
+		return nil, fmt.Errorf("could not parse db config: %w", err)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
 
 	dbConn := stdlib.OpenDB(*cfg)
-	if err != nil {
-		zap.L().Fatal("could not open db connection", zap.Error(err))
-	}
 
 	for {
-		if err := dbConn.PingContext(ctx); err != nil {
-			zap.S().Info("database not yet ready", zap.Error(err))
-			select {
-			case <-ctx.Done():
-				zap.L().Fatal("timed out waiting for database")
-			case <-time.After(time.Second):
-			}
-		} else {
-			cancel()
-			break
+		err := dbConn.PingContext(ctx)
+		if err == nil {
+			return dbConn, nil
 		}
-	}
-
-	gl := zapgorm2.New(zap.L())
-	gl.SetAsDefault()
-	gl.IgnoreRecordNotFoundError = true
-	gl.LogLevel = logger.Info
 
-	model.DB, err = gorm.Open(postgres.New(postgres.Config{Conn: dbConn}), &gorm.Config{Logger: gl})
+		zap.S().Info("database not yet ready", zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for database: %w", err)
+		case <-time.After(time.Second):
+		}
+	}
+}
 
-	if result := model.DB.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp";`); result.Error != nil {
-		zap.L().Error("failed to create uuid-ossp extension, please create it manually", zap.Error(err))
-		// return err
+// migrate applies all pending migrations up to target, zero means all of them
+func migrate(target int) error {
+	applied, err := model.MigrateUp(context.Background(), target)
+	if err != nil {
+		return err
 	}
 
-	model.CreateTables()
-	model.CreateCategories()
-	model.CreateFilters()
+	for _, m := range applied {
+		zap.L().Info("applied migration", zap.Int("version", m.Version), zap.String("name", m.Name))
+	}
 
 	return nil
 }
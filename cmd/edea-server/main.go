@@ -15,15 +15,18 @@ import (
 	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
 	"gitlab.com/edea-dev/edea-server/internal/config"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
 	"gitlab.com/edea-dev/edea-server/internal/middleware"
+	"gitlab.com/edea-dev/edea-server/internal/refresh"
 	"gitlab.com/edea-dev/edea-server/internal/repo"
 	"gitlab.com/edea-dev/edea-server/internal/search"
 	"go.uber.org/zap"
 )
 
-func main() {
-	var wait time.Duration
+// graceful shutdown timeout of the server
+var wait time.Duration
 
+func main() {
 	zc := zap.NewDevelopmentConfig()
 
 	switch strings.ToLower(os.Getenv("LOG")) {
@@ -45,8 +48,40 @@ func main() {
 	config.ReadConfig()
 
 	flag.DurationVar(&wait, "graceful-timeout", time.Second*15, "the duration for which the server gracefully wait for existing connections to finish - e.g. 15s or 1m")
+	flag.Usage = usage
 	flag.Parse()
 
+	// without a command we run the server like we always did
+	name, args := "serve", flag.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		usage()
+		return
+	}
+
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	code := cmd.run(args)
+	zl.Sync()
+	os.Exit(code)
+}
+
+// serve runs the web server and the background workers until it's interrupted
+func serve(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.DurationVar(&wait, "graceful-timeout", wait, "the duration for which the server gracefully wait for existing connections to finish - e.g. 15s or 1m")
+	fs.Parse(args)
+
+	zl := zap.L()
+
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(ginzap.GinzapWithConfig(zl, &ginzap.Config{
@@ -59,18 +94,25 @@ func main() {
 	routes(r)
 
 	// start embedded postgres DB
-	err := db()
-	if err != nil {
-		os.Exit(1)
+	if err := db(); err != nil {
+		zap.L().Error("could not set up the database", zap.Error(err))
+		return 1
 	}
 
 	// zap.S().Info().Interface("config", config.Cfg)
-	repo.InitCache(config.Cfg.Cache.Repo.Base)
+	repo.InitCache(config.Cfg.Cache.Repo.Base, config.Cfg.Cache.Repo.MaxSize<<20)
 
-	if err := search.Init(config.Cfg.Search.Host, config.Cfg.Search.Index, config.Cfg.Search.APIKey); err != nil {
+	if err := search.Init(config.Cfg.Search.Backend, config.Cfg.Search.Host, config.Cfg.Search.Index, config.Cfg.Search.APIKey); err != nil {
 		zap.L().Error("could not init search", zap.Error(err))
 	}
 
+	// background workers for imports, pulls, diffs and merges
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	jobs.Start(bgCtx, config.Cfg.Jobs.Workers)
+
+	// keep the repositories fresh in case the hosts can't send webhooks
+	go refresh.Run(bgCtx, config.Cfg.Refresh.Interval, config.Cfg.Refresh.Concurrency)
+
 	addr := fmt.Sprintf("%s:%s", config.Cfg.Server.Host, config.Cfg.Server.Port)
 
 	srv := &http.Server{
@@ -110,12 +152,18 @@ func main() {
 	// until the timeout deadline.
 	if err := srv.Shutdown(ctx); err != nil {
 		zap.L().Error("could not shut down", zap.Error(err))
-		os.Exit(1)
+		stopBackground()
+		return 1
 	}
 
+	// stop claiming new jobs and give the running ones as long as the connections had to finish,
+	// the ones cancelled after that are picked up again after a restart
+	stopBackground()
+	jobs.Wait(wait)
+
 	// Optionally, you could run srv.Shutdown in a goroutine and block on
 	// <-ctx.Done() if your application should wait for other services
 	// to finalize based on context cancellation.
 	zap.S().Info("shutting down")
-	os.Exit(0)
+	return 0
 }
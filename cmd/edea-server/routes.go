@@ -4,13 +4,18 @@ package main
 
 import (
 	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/api"
 	"gitlab.com/edea-dev/edea-server/internal/auth"
 	"gitlab.com/edea-dev/edea-server/internal/config"
+	"gitlab.com/edea-dev/edea-server/internal/model"
 	"gitlab.com/edea-dev/edea-server/internal/search"
 	"gitlab.com/edea-dev/edea-server/internal/view"
+	"gitlab.com/edea-dev/edea-server/internal/view/admin"
 	"gitlab.com/edea-dev/edea-server/internal/view/bench"
+	"gitlab.com/edea-dev/edea-server/internal/view/job"
 	"gitlab.com/edea-dev/edea-server/internal/view/module"
 	"gitlab.com/edea-dev/edea-server/internal/view/user"
+	"gitlab.com/edea-dev/edea-server/internal/webhook"
 )
 
 func faviconHandler(c *gin.Context) {
@@ -28,16 +33,23 @@ func routes(router *gin.Engine) {
 
 	a := r.Group("/", auth.RequireAuth())
 
-	a.GET("/module/new", module.New)                 // new module page
-	a.POST("/module/new", module.Create)             // add new module
-	r.GET("/module/explore", module.Explore)         // explore public modules
-	r.GET("/module/user/:id", module.ExploreUser)    // view a users modules
-	a.POST("/module/:id", module.Update)             // view new module or adjust params
-	r.GET("/module/:id", module.View)                // view module
-	a.GET("/module/update/:id", module.UpdateView)   // update a module
-	a.GET("/module/delete/:id", module.Delete)       // delete module
-	a.GET("/module/pull/:id", module.Pull)           // pull repo of module
-	r.GET("/module/history/:id", module.ViewHistory) // show revision history of a module
+	a.GET("/module/new", module.New)                      // new module page
+	a.POST("/module/new", module.Create)                  // add new module
+	a.GET("/module/import", module.ImportForm)            // import sub-modules of a repository
+	a.POST("/module/import/scan", module.ImportScan)      // queue listing the sub-modules in edea.yml
+	a.GET("/module/import/scan/:id", module.ImportSelect) // choose from the sub-modules found by a scan
+	a.POST("/module/import", module.Import)               // register the selected sub-modules
+	a.GET("/module/lint", module.Lint)                    // queue checking the edea.yml of a repository
+	a.POST("/module/lint", module.Lint)                   // check it with the values of the new module form
+	a.GET("/module/lint/:id", module.LintResult)          // the problems found by a check
+	r.GET("/module/explore", module.Explore)              // explore public modules
+	r.GET("/module/user/:id", module.ExploreUser)         // view a users modules
+	a.POST("/module/:id", module.Update)                  // view new module or adjust params
+	r.GET("/module/:id", module.View)                     // view module
+	a.GET("/module/update/:id", module.UpdateView)        // update a module
+	a.GET("/module/delete/:id", module.Delete)            // delete module
+	a.GET("/module/pull/:id", module.Pull)                // pull repo of module
+	r.GET("/module/history/:id", module.ViewHistory)      // show revision history of a module
 	r.GET("/module/diff/:id", module.Diff)
 	a.GET("/module/build_book/:id", module.BuildBook)
 	r.GET("/module/search", view.Template("module/parametric_search.tmpl", "EDeA - Module Search"))
@@ -51,12 +63,23 @@ func routes(router *gin.Engine) {
 	r.GET("/bench/:id", bench.View)                                          // view a bench
 	a.GET("/bench/update/:id", bench.ViewUpdate)                             // update form view of a bench
 	a.GET("/bench/add/:id", bench.AddModule)                                 // add a module to the active bench
+	a.POST("/bench/add_dependencies/:id", bench.AddDependencies)             // add the dependencies of a module to the active bench
 	a.GET("/bench/remove/:id", bench.RemoveModule)                           // remove module from workbench
+	a.POST("/bench/pin/:id", bench.PinModule)                                // change the revision of a module on a workbench
 	a.GET("/bench/delete/:id", bench.Delete)                                 // delete the workbench
 	r.GET("/bench/user/:id", bench.ListUser)                                 // list workbenches of a specific user
 	a.GET("/bench/fork/:id", bench.Fork)                                     // fork a workbench
 	a.GET("/bench/activate/:id", bench.SetActive)                            // set a workbench as active
 	r.GET("/bench/merge/:id", bench.Merge)
+	r.GET("/bench/snapshots/:id", bench.Snapshots)          // list the snapshots of a workbench
+	a.POST("/bench/snapshot/:id", bench.CreateSnapshot)     // take a snapshot of a workbench
+	r.GET("/bench/snapshot/:id", bench.ViewSnapshot)        // view a snapshot
+	r.GET("/bench/snapshot/merge/:id", bench.MergeSnapshot) // merge a snapshot
+	a.GET("/bench/snapshot/fork/:id", bench.ForkSnapshot)   // fork a snapshot into a new workbench
+
+	a.GET("/jobs", job.List)                  // list my background jobs
+	r.GET("/jobs/:id", job.View)              // status of a background job
+	r.GET("/jobs/:id/download", job.Download) // download the result of a merge
 
 	r.GET("/favicon.ico", faviconHandler)
 
@@ -64,6 +87,82 @@ func routes(router *gin.Engine) {
 	r.POST("/api/search_module", search.SearchModule)
 	r.GET("/api/filters", search.Filters)
 
+	// versioned json api
+	v1 := router.Group("/api/v1", auth.Authenticate(), auth.RequireScope(model.ScopeRead))
+	v1a := v1.Group("/", api.RequireAuth(), auth.RequireScope(model.ScopeWrite))
+
+	v1.GET("/modules", api.ListModules)
+	v1.GET("/modules/:id", api.GetModule)
+	v1.GET("/modules/:id/dependencies", api.GetModuleDependencies)
+	v1a.POST("/modules", api.CreateModule)
+	v1a.PUT("/modules/:id", api.UpdateModule)
+	v1a.DELETE("/modules/:id", api.DeleteModule)
+	v1a.POST("/modules/:id/pull", api.PullModule)
+	v1a.GET("/import", api.ScanRepository)
+	v1a.POST("/import", api.ImportModules)
+	v1a.GET("/lint", api.LintRepository)
+	v1.POST("/lint", api.LintFile)
+
+	// push notifications of the repository hosts, these are authenticated by their signature
+	router.POST("/api/v1/hooks/:provider", webhook.Receive)
+
+	v1.GET("/benches", api.ListBenches)
+	v1.GET("/benches/:id", api.GetBench)
+	v1a.POST("/benches", api.CreateBench)
+	v1a.PUT("/benches/:id", api.UpdateBench)
+	v1a.DELETE("/benches/:id", api.DeleteBench)
+	v1a.PUT("/benches/:id/order", api.ReorderBenchModules)
+	v1.GET("/benches/:id/modules", api.ListBenchModules)
+	v1a.POST("/benches/:id/modules", api.AddBenchModule)
+	v1a.DELETE("/benches/:id/modules/:bmid", api.RemoveBenchModule)
+	v1.GET("/benches/:id/modules/:bmid/conf", api.GetBenchModuleConf)
+	v1a.PUT("/benches/:id/modules/:bmid/conf", api.SetBenchModuleConf)
+	v1a.PUT("/benches/:id/modules/:bmid/revision", api.PinBenchModule)
+	v1.POST("/benches/:id/merge", api.MergeBench)
+	v1.GET("/benches/:id/snapshots", api.ListSnapshots)
+	v1a.POST("/benches/:id/snapshots", api.CreateSnapshot)
+	v1.GET("/snapshots/:id", api.GetSnapshot)
+	v1.POST("/snapshots/:id/merge", api.MergeSnapshot)
+	v1a.POST("/snapshots/:id/fork", api.ForkSnapshot)
+
+	v1.GET("/search", api.Search)
+	v1.GET("/categories", api.ListCategories)
+	v1.GET("/categories/:id/params", api.ListCategoryParams)
+	v1.GET("/filters", api.ListFilters)
+
+	v1a.GET("/credentials", api.ListCredentials)
+	v1s := v1a.Group("/", auth.RequireSession()) // tokens can't manage tokens and credentials
+	v1s.POST("/credentials", api.CreateCredential)
+	v1s.DELETE("/credentials/:id", api.DeleteCredential)
+
+	v1a.GET("/saved_searches", api.ListSavedSearches)
+	v1a.POST("/saved_searches", api.CreateSavedSearch)
+	v1a.PUT("/saved_searches/:id", api.UpdateSavedSearch)
+	v1a.DELETE("/saved_searches/:id", api.DeleteSavedSearch)
+	v1a.GET("/notifications", api.ListNotifications)
+	v1a.POST("/notifications/read", api.ReadAllNotifications)
+	v1a.POST("/notifications/:id/read", api.ReadNotification)
+
+	v1a.GET("/jobs", api.ListJobs)
+	v1.GET("/jobs/:id", api.GetJob)
+
+	v1adm := v1a.Group("/admin", api.RequireAdmin(), auth.RequireScope(model.ScopeAdmin))
+	v1adm.GET("/refresh", api.RefreshStatus)
+	v1adm.POST("/refresh", api.RefreshRepositories)
+	v1adm.GET("/cache", api.CacheUsage)
+	v1adm.POST("/cache/evict", api.EvictCache)
+	v1adm.GET("/check", api.Check)
+	v1adm.POST("/check/repair", api.Repair)
+	v1adm.POST("/categories", api.CreateCategory)
+	v1adm.PUT("/categories/:id", api.UpdateCategory)
+	v1adm.DELETE("/categories/:id", api.DeleteCategory)
+	v1adm.POST("/categories/:id/params", api.CreateCategoryParam)
+	v1adm.PUT("/categories/:id/params/:pid", api.UpdateCategoryParam)
+	v1adm.DELETE("/categories/:id/params/:pid", api.DeleteCategoryParam)
+	v1adm.POST("/filters", api.CreateFilter)
+	v1adm.PUT("/filters/:id", api.UpdateFilter)
+	v1adm.DELETE("/filters/:id", api.DeleteFilter)
+
 	// static files
 	router.Static("/css", "./static/css")
 	router.Static("/js", "./static/js")
@@ -77,7 +176,18 @@ func routes(router *gin.Engine) {
 
 	a.GET("/profile", user.Profile)
 	a.POST("/profile", user.UpdateProfile)
+	a.GET("/profile/email/confirm", user.ConfirmEmail) // link of the confirmation email
 	a.GET("/profile/export", user.DataExport)
+	as := a.Group("/", auth.RequireSession()) // tokens can't manage tokens and credentials
+	as.POST("/profile/tokens", user.CreateToken)
+	as.POST("/profile/tokens/:id/revoke", user.RevokeToken)
+	as.POST("/profile/credentials", user.CreateCredential)
+	as.POST("/profile/credentials/:id/delete", user.DeleteCredential)
+	a.POST("/profile/searches", user.SaveSearch)            // save the search of the search pages
+	a.POST("/profile/searches/:id", user.UpdateSavedSearch) // rename or change the email setting
+	a.POST("/profile/searches/:id/delete", user.DeleteSavedSearch)
+	a.GET("/profile/notifications/:id", user.OpenNotification)    // mark as read and show the module
+	a.POST("/profile/notifications/read", user.ReadNotifications) // mark all as read
 
 	r.GET("/callback", auth.CallbackHandler)
 	r.POST("/callback", auth.CallbackHandler)
@@ -86,7 +196,24 @@ func routes(router *gin.Engine) {
 	r.GET("/logout", auth.LogoutHandler)
 
 	a.GET("/search/_bulk_update", search.ReIndexDB)
-	a.GET("/_module/_bulk_update", module.PullAllRepos)
+
+	adm := a.Group("/", auth.RequireAdmin())
+	adm.GET("/admin", admin.Index)
+	adm.POST("/admin/refresh", admin.Refresh)              // refresh all module repositories
+	adm.GET("/admin/cache", admin.Cache)                   // repository cache usage
+	adm.POST("/admin/cache/sizes", admin.UpdateCacheSizes) // recalculate the repository sizes
+	adm.POST("/admin/cache/evict", admin.EvictCache)       // remove unused repositories
+	adm.GET("/admin/catalog", admin.Catalog)               // categories and search filters
+	adm.POST("/admin/categories", admin.CreateCategory)
+	adm.POST("/admin/categories/:id", admin.UpdateCategory)
+	adm.POST("/admin/categories/:id/delete", admin.DeleteCategory) // moves the modules into another category
+	adm.GET("/admin/categories/:id/params", admin.CategoryParams)  // parameter schema of a category
+	adm.POST("/admin/categories/:id/params", admin.CreateCategoryParam)
+	adm.POST("/admin/categories/:id/params/:pid", admin.UpdateCategoryParam)
+	adm.POST("/admin/categories/:id/params/:pid/delete", admin.DeleteCategoryParam)
+	adm.POST("/admin/filters", admin.CreateFilter)
+	adm.POST("/admin/filters/:id", admin.UpdateFilter)
+	adm.POST("/admin/filters/:id/delete", admin.DeleteFilter)
 
 	// the login action redirects to the OIDC provider, with mock auth we have to provide this ourselves
 	if config.Cfg.Auth.MiniOIDCServer.UseBuiltin {
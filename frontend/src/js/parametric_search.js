@@ -83,84 +83,92 @@ function _create_button(button_label, aria_label, color, disabled = false) {
 
 const filterfield_prefix = "filterf_"
 
-async function categories() {
+const category_select = document.getElementById("category")
+
+// fill the category select, choosing one shows the parameters of its schema
+async function load_categories() {
+	const categories = await fetch(`/api/v1/categories`).then((response) => response.json())
+	categories.forEach(cat => {
+		let opt = document.createElement('option')
+		opt.value = cat.ID
+		opt.innerText = cat.Name
+		category_select.appendChild(opt)
+	})
+}
+
+async function search_fields() {
 	const filters_container = document.getElementById("filters-row")
 	if (typeof(filters_container) == "undefined") {
 		return;
 	}
-	const filters = await fetch(`/api/filters`).then((response) => response.json())
-	var filter_dict = {}
-	for (var i = 0; i < filters.length; i++) {
-		filter_dict[filters[i].Key] = filters[i]
-	}
-	const categories = await fetch(`/api/search_fields`).then((response) => response.json())
-	const cats = Object.keys(categories)
+	filters_container.replaceChildren()
 
-	if (cats.length > 0) {
+	var url = `/api/search_fields`
+	if (category_select.value != "") {
+		url += "?category=" + encodeURIComponent(category_select.value)
+	}
+	const fields = await fetch(url).then((response) => response.json())
 
-		let i = 0;
-		cats.forEach(cat => {
-			let outer_div = document.createElement("div")
-			outer_div.classList.add("filterbox", "col-3")  // change container width here when necessary
+	fields.forEach(field => {
+		let outer_div = document.createElement("div")
+		outer_div.classList.add("filterbox", "col-3")  // change container width here when necessary
 
-			let form_control_element_name = filterfield_prefix + cat
+		let form_control_element_name = filterfield_prefix + field.key
 
-			let label = document.createElement('label')
-			var cat_name = cat
-			var cat_label_found = false
-			if (typeof (filter_dict[cat]) != 'undefined') {
-				cat_name = filter_dict[cat].Name
-				cat_label_found = true
-			}
-			label.innerText = cat_name
-			label.setAttribute("for", form_control_element_name)
-			label.classList.add("form-label")
-
-			outer_div.appendChild(label)
-
-			let select = document.createElement('select')
-			select.name = form_control_element_name
-			select.setAttribute("multiple", "")
-			select.setAttribute("aria-label", "filter options for " + cat)
-			select.classList.add("form-select", "form-select-sm", "mb-1")
-			select.addEventListener('change', enable_update_filters_btn)
-
-			// add an option for each value
-			var num_cats = 0
-			var num_selected = 0
-			categories[cat].forEach(value => {
-				let opt = document.createElement('option')
-				opt.value = value
-				opt.innerText = value
-				select.appendChild(opt)
-				num_cats++
-				if (opt.selected) {
-					num_selected++
-				}
-			})
-
-			// add everything together
-			outer_div.appendChild(select)
-
-			let control_div = document.createElement("div")
-			control_div.classList.add("input-group", "input-group-sm", "mb-3")
-
-			control_div.appendChild(_create_button("&nbsp;&#x2264;&nbsp;", "select all values less than or equal to selected", "secondary", disabled = (num_cats < 2)))
-			let midbtn = _create_button("&nbsp;&#x21bb;&nbsp;", "clear this filter", "primary", disabled = false)
-			if (num_selected == 0) {
-				midbtn.disabled = true
+		let label = document.createElement('label')
+		label.innerText = field.name
+		if (field.unit) {
+			label.innerText += " [" + field.unit + "]"
+		}
+		if (field.description) {
+			label.title = field.description
+		}
+		label.setAttribute("for", form_control_element_name)
+		label.classList.add("form-label")
+
+		outer_div.appendChild(label)
+
+		let select = document.createElement('select')
+		select.name = form_control_element_name
+		select.id = form_control_element_name
+		select.setAttribute("multiple", "")
+		select.setAttribute("aria-label", "filter options for " + field.name)
+		select.classList.add("form-select", "form-select-sm", "mb-1")
+		select.addEventListener('change', enable_update_filters_btn)
+
+		// add an option for each value
+		var num_cats = 0
+		var num_selected = 0
+		field.values.forEach(value => {
+			let opt = document.createElement('option')
+			opt.value = value
+			opt.innerText = value
+			select.appendChild(opt)
+			num_cats++
+			if (opt.selected) {
+				num_selected++
 			}
-			midbtn.classList.add("form-control")
-			control_div.appendChild(midbtn)
-			control_div.appendChild(_create_button("&nbsp;&#x2265;&nbsp;", "select all values larger than or equal to selected", "secondary", disabled = (num_cats < 2)))
+		})
 
-			outer_div.appendChild(control_div)
+		// add everything together
+		outer_div.appendChild(select)
 
-			filters_container.appendChild(outer_div)
-			i++
-		})
-	}
+		let control_div = document.createElement("div")
+		control_div.classList.add("input-group", "input-group-sm", "mb-3")
 
+		control_div.appendChild(_create_button("&nbsp;&#x2264;&nbsp;", "select all values less than or equal to selected", "secondary", disabled = (num_cats < 2)))
+		let midbtn = _create_button("&nbsp;&#x21bb;&nbsp;", "clear this filter", "primary", disabled = false)
+		if (num_selected == 0) {
+			midbtn.disabled = true
+		}
+		midbtn.classList.add("form-control")
+		control_div.appendChild(midbtn)
+		control_div.appendChild(_create_button("&nbsp;&#x2265;&nbsp;", "select all values larger than or equal to selected", "secondary", disabled = (num_cats < 2)))
+
+		outer_div.appendChild(control_div)
+
+		filters_container.appendChild(outer_div)
+	})
 }
 
 function disable_update_filters_btn() {
@@ -176,7 +184,7 @@ let update_filters_already_enabled = false
 
 function enable_update_filters_btn(event) {
 	// enable reset filter button
-	if (event.srcElement.nodeName == "SELECT") {
+	if (event.srcElement.nodeName == "SELECT" && event.srcElement.name.startsWith(filterfield_prefix)) {
 		event.srcElement.parentElement.lastChild.children[1].disabled = false
 	}
 
@@ -191,11 +199,59 @@ function enable_update_filters_btn(event) {
 	filter_button.addEventListener('click', do_search)
 }
 
-categories();
+// a saved search links here with its query, category and params
+const url_params = new URLSearchParams(window.location.search)
+
+async function load_saved_search() {
+	await load_categories()
+	category_select.value = url_params.get("category") || ""
+	await search_fields()
+
+	query_input.value = url_params.get("query") || ""
+
+	var params = []
+	try {
+		params = JSON.parse(url_params.get("params") || "[]")
+	} catch (e) {
+		params = []
+	}
+	params.forEach(p => {
+		let select = document.getElementById(filterfield_prefix + p.field)
+		if (select == null) {
+			return
+		}
+		for (var i = 0; i < select.options.length; i++) {
+			if (p.values.includes(select.options[i].value)) {
+				select.options[i].selected = true
+			}
+		}
+	})
+
+	if (url_params.has("query") || url_params.has("params") || url_params.has("category")) {
+		do_search()
+	}
+}
+
+category_select.addEventListener('change', (event) => {
+	search_fields()
+	enable_update_filters_btn(event)
+})
+
+const query_input = document.getElementById("query")
+query_input.addEventListener('input', enable_update_filters_btn)
+query_input.addEventListener('keydown', (event) => {
+	if (event.key == "Enter") {
+		event.preventDefault()
+		do_search()
+	}
+})
+
+load_saved_search();
+
 let search_results = []
 
-async function do_search() {
-	disable_update_filters_btn()
+// the values selected in the filter boxes as list of params
+function selected_params() {
 	var filter_row = document.getElementsByClassName("filterbox")
 
 	var filter_ops = []
@@ -217,10 +273,28 @@ async function do_search() {
 		filter_ops.push({ 'field': e.name.substring(filterfield_prefix.length), 'op': '=', 'values': op_values })
 	}
 
-	const results = await fetch(
+	return filter_ops
+}
+
+async function do_search() {
+	disable_update_filters_btn()
+	const filter_ops = selected_params()
+
+	const response = await fetch(
 		'/api/search_module',
-		{ method: 'POST', body: JSON.stringify(filter_ops) }
-	).then((response) => response.json())
+		{ method: 'POST', body: JSON.stringify({ 'query': query_input.value, 'params': filter_ops, 'category': category_select.value }) }
+	)
+	const results = await response.json()
+
+	// syntax errors and unit mismatches are shown below the query
+	const query_error = document.getElementById("query-error")
+	if (!response.ok) {
+		query_input.classList.add("is-invalid")
+		query_error.innerText = results.error
+		return
+	}
+	query_input.classList.remove("is-invalid")
+	query_error.innerText = ""
 
 	search_results = results  // put it into a global for easier debugging from dev console
 	let results_container = document.getElementById("hits-row")
@@ -298,3 +372,13 @@ async function do_search() {
 		results_container.appendChild(result_container_div)
 	}
 }
+
+// saving the search takes what's currently entered
+const save_form = document.getElementById("save-search-form")
+if (save_form != null) {
+	save_form.addEventListener('submit', () => {
+		document.getElementById("save-search-text").value = query_input.value
+		document.getElementById("save-search-params").value = JSON.stringify(selected_params())
+		document.getElementById("save-search-category").value = category_select.value
+	})
+}
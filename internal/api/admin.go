@@ -0,0 +1,92 @@
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/check"
+	"gitlab.com/edea-dev/edea-server/internal/config"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/refresh"
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+)
+
+// RefreshStatus returns whether a repository refresh is running and when the last one ran
+//
+//	GET /api/v1/admin/refresh
+func RefreshStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, refresh.Current())
+}
+
+// RefreshRepositories starts refreshing all module repositories in the background
+//
+//	POST /api/v1/admin/refresh
+func RefreshRepositories(c *gin.Context) {
+	if err := refresh.Start(config.Cfg.Refresh.Concurrency); errors.Is(err, refresh.ErrRunning) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, refresh.Current())
+}
+
+// CacheUsage returns the disk usage of the repository cache
+//
+//	GET /api/v1/admin/cache
+func CacheUsage(c *gin.Context) {
+	usage, err := repo.Usage()
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// EvictCache removes all cached repositories which no module, bench or snapshot needs
+//
+//	POST /api/v1/admin/cache/evict
+func EvictCache(c *gin.Context) {
+	evicted, err := repo.EvictUnused()
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if evicted == nil {
+		evicted = []model.Repository{}
+	}
+
+	c.JSON(http.StatusOK, evicted)
+}
+
+// Check looks for inconsistencies between the repository cache, the database and the search index
+//
+//	GET /api/v1/admin/check
+func Check(c *gin.Context) {
+	report, err := check.Run(c, false)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// Repair fixes the inconsistencies Check finds
+//
+//	POST /api/v1/admin/check/repair
+func Repair(c *gin.Context) {
+	report, err := check.Run(c, true)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
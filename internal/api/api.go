@@ -0,0 +1,133 @@
+// Package api provides the versioned JSON REST API
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/search"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidID is returned when a path parameter is not a valid uuid
+	ErrInvalidID = errors.New("invalid id")
+	// ErrUnauthenticated is returned when a route requires a logged in user
+	ErrUnauthenticated = errors.New("authentication required")
+)
+
+// defaultLimit is the page size of list endpoints if the client didn't specify one
+const defaultLimit = 50
+
+// RequireAuth aborts the request with a JSON error if there is no authenticated user
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Keys["user"].(*model.User); !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrUnauthenticated.Error()})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireAdmin aborts the request with a JSON error if the user is not an admin
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if u, ok := c.Keys["user"].(*model.User); !ok || !u.IsAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin privileges required"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// errorStatus maps the errors of the API to their http status code, the first match wins
+var errorStatus = []struct {
+	err    error
+	status int
+}{
+	{ErrInvalidID, http.StatusBadRequest},
+	{ops.ErrIncompleteOrder, http.StatusBadRequest},
+	{ops.ErrUnknownRevision, http.StatusBadRequest},
+	{ops.ErrEmptyName, http.StatusBadRequest},
+	{ops.ErrUnknownSubModule, http.StatusBadRequest},
+	{ops.ErrInvalidCredential, http.StatusBadRequest},
+	{ops.ErrDefaultCategory, http.StatusBadRequest},
+	{ops.ErrSameCategory, http.StatusBadRequest},
+	{ops.ErrInvalidFilterKey, http.StatusBadRequest},
+	{ops.ErrInvalidParam, http.StatusBadRequest},
+	{search.ErrInvalidSort, http.StatusBadRequest},
+	{ops.ErrInvalidSavedSearch, http.StatusBadRequest},
+	{gorm.ErrRecordNotFound, http.StatusNotFound},
+	{util.ErrNoSuchModule, http.StatusNotFound},
+	{util.ErrNoSuchBench, http.StatusNotFound},
+	{ops.ErrCategoryExists, http.StatusConflict},
+	{ops.ErrFilterExists, http.StatusConflict},
+	{ops.ErrParamExists, http.StatusConflict},
+	{ErrUnauthenticated, http.StatusUnauthorized},
+	{model.ErrUnauthorized, http.StatusForbidden},
+	{model.ErrImmutable, http.StatusForbidden},
+}
+
+// abortWithError maps an error to its http status code and writes it as JSON
+func abortWithError(c *gin.Context, err error) {
+	var hint util.HintError
+	status := http.StatusInternalServerError
+
+	for _, e := range errorStatus {
+		if errors.Is(err, e.err) {
+			status = e.status
+			break
+		}
+	}
+	if status == http.StatusInternalServerError && errors.As(err, &hint) {
+		status = http.StatusUnprocessableEntity
+	}
+
+	if status == http.StatusInternalServerError {
+		zap.L().Error("api request failed", zap.Error(err), zap.String("route", c.FullPath()))
+	}
+
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
+// paramID parses the named path parameter as uuid
+func paramID(c *gin.Context, name string) (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Param(name))
+	if err != nil {
+		return uuid.Nil, ErrInvalidID
+	}
+	return id, nil
+}
+
+// currentUser returns the logged in user or nil
+func currentUser(c *gin.Context) *model.User {
+	u, _ := c.Keys["user"].(*model.User)
+	return u
+}
+
+// paginate applies the limit and offset query parameters to a query
+func paginate(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || limit <= 0 || limit > 500 {
+			limit = defaultLimit
+		}
+		offset, err := strconv.Atoi(c.Query("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+		return db.Limit(limit).Offset(offset)
+	}
+}
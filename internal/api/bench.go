@@ -0,0 +1,446 @@
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/search"
+	"gorm.io/datatypes"
+)
+
+// BenchRequest is the body of create and update requests for benches
+type BenchRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Public      bool   `json:"public"`
+	Active      bool   `json:"active"`
+}
+
+// BenchModuleRequest adds a module to a bench
+type BenchModuleRequest struct {
+	ModuleID uuid.UUID      `json:"module_id" binding:"required"`
+	Conf     datatypes.JSON `json:"conf"`
+
+	WithDependencies bool `json:"with_dependencies"` // also add the dependencies which aren't on the bench yet
+}
+
+// RevisionRequest pins a bench module to a revision, an empty revision means the latest commit
+type RevisionRequest struct {
+	Revision string `json:"revision"`
+}
+
+// OrderRequest contains the bench module ids in their new order
+type OrderRequest struct {
+	IDs []uuid.UUID `json:"ids" binding:"required"`
+}
+
+// getBench loads a bench which is either public or belongs to the current user
+func getBench(c *gin.Context) (*model.Bench, error) {
+	var userID uuid.UUID
+
+	id, err := paramID(c, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	if u := currentUser(c); u != nil {
+		userID = u.ID
+	}
+
+	bench := new(model.Bench)
+
+	result := model.DB.Where("id = ? and (public = true or user_id = ?)", id, userID).First(bench)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return bench, nil
+}
+
+// getOwnBench loads a bench the current user is allowed to change
+func getOwnBench(c *gin.Context) (*model.Bench, error) {
+	bench, err := getBench(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := model.IsAuthorized(c, bench.UserID); err != nil {
+		return nil, err
+	}
+
+	return bench, nil
+}
+
+// benchModules returns the modules of a bench in order
+func benchModules(bench *model.Bench) ([]model.BenchModule, error) {
+	var benchMods []model.BenchModule
+
+	result := model.DB.Preload("Module").Where("bench_id = ?", bench.ID).Order("position").Find(&benchMods)
+	return benchMods, result.Error
+}
+
+// ListBenches returns the benches of the current user or the public benches of another one
+//
+//	GET /api/v1/benches?user_id=
+func ListBenches(c *gin.Context) {
+	var benches []model.Bench
+
+	user := currentUser(c)
+	tx := model.DB.Scopes(paginate(c)).Order("updated_at desc")
+
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			abortWithError(c, ErrInvalidID)
+			return
+		}
+		if user == nil || user.ID != id {
+			tx = tx.Where("public = true")
+		}
+		tx = tx.Where("user_id = ?", id)
+	} else if user != nil {
+		tx = tx.Where("user_id = ?", user.ID)
+	} else {
+		abortWithError(c, ErrUnauthenticated)
+		return
+	}
+
+	if result := tx.Find(&benches); result.Error != nil {
+		abortWithError(c, result.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, benches)
+}
+
+// GetBench returns a bench including its modules
+//
+//	GET /api/v1/benches/:id
+func GetBench(c *gin.Context) {
+	bench, err := getBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if bench.Modules, err = benchModules(bench); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, bench)
+}
+
+// CreateBench adds a new bench for the current user
+//
+//	POST /api/v1/benches
+func CreateBench(c *gin.Context) {
+	var req BenchRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bench := &model.Bench{
+		Name:        req.Name,
+		Description: req.Description,
+		Public:      req.Public,
+		Active:      req.Active,
+	}
+
+	if err := ops.CreateBench(c, currentUser(c), bench); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("Location", "/api/v1/benches/"+bench.ID.String())
+	c.JSON(http.StatusCreated, bench)
+}
+
+// UpdateBench changes the name, description and visibility of a bench
+//
+//	PUT /api/v1/benches/:id
+func UpdateBench(c *gin.Context) {
+	var req BenchRequest
+
+	bench, err := getOwnBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bench.Name = req.Name
+	bench.Description = req.Description
+	bench.Public = req.Public
+
+	result := model.DB.WithContext(c).Model(bench).Select("Name", "Description", "Public").Updates(bench)
+	if result.Error != nil {
+		abortWithError(c, result.Error)
+		return
+	}
+
+	if err := search.UpdateEntry(search.BenchToEntry(*bench)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, bench)
+}
+
+// DeleteBench removes a bench
+//
+//	DELETE /api/v1/benches/:id
+func DeleteBench(c *gin.Context) {
+	bench, err := getOwnBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := ops.DeleteBench(c, bench.ID); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListBenchModules returns the modules of a bench in order
+//
+//	GET /api/v1/benches/:id/modules
+func ListBenchModules(c *gin.Context) {
+	bench, err := getBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	benchMods, err := benchModules(bench)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, benchMods)
+}
+
+// AddBenchModule appends a module to a bench
+//
+//	POST /api/v1/benches/:id/modules
+func AddBenchModule(c *gin.Context) {
+	var req BenchModuleRequest
+
+	bench, err := getOwnBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	module := new(model.Module)
+
+	result := model.DB.Scopes(model.ModulesVisibleTo(currentUser(c))).First(module, req.ModuleID)
+	if result.Error != nil {
+		abortWithError(c, result.Error)
+		return
+	}
+
+	bm, err := ops.AddBenchModule(c, bench, module, req.Conf)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if req.WithDependencies {
+		if _, err := ops.AddBenchDependencies(c, currentUser(c), bench, module, nil); err != nil {
+			abortWithError(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, bm)
+}
+
+// RemoveBenchModule removes a module from a bench
+//
+//	DELETE /api/v1/benches/:id/modules/:bmid
+func RemoveBenchModule(c *gin.Context) {
+	bench, err := getOwnBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	id, err := paramID(c, "bmid")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := ops.RemoveBenchModule(c, bench, id); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ReorderBenchModules changes the order of the modules on a bench
+//
+//	PUT /api/v1/benches/:id/order
+func ReorderBenchModules(c *gin.Context) {
+	var req OrderRequest
+
+	bench, err := getOwnBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ops.ReorderBenchModules(c, bench, req.IDs); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	benchMods, err := benchModules(bench)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, benchMods)
+}
+
+// getBenchModule loads a module of the bench in the request
+func getBenchModule(c *gin.Context, bench *model.Bench) (*model.BenchModule, error) {
+	id, err := paramID(c, "bmid")
+	if err != nil {
+		return nil, err
+	}
+
+	bm := new(model.BenchModule)
+
+	result := model.DB.Where("id = ? and bench_id = ?", id, bench.ID).First(bm)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return bm, nil
+}
+
+// GetBenchModuleConf returns the configuration of a module on a bench
+//
+//	GET /api/v1/benches/:id/modules/:bmid/conf
+func GetBenchModuleConf(c *gin.Context) {
+	bench, err := getBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	bm, err := getBenchModule(c, bench)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	conf := bm.Conf
+	if len(conf) == 0 {
+		conf = datatypes.JSON("{}")
+	}
+
+	c.Data(http.StatusOK, "application/json", conf)
+}
+
+// SetBenchModuleConf replaces the configuration of a module on a bench, the body has to be a JSON object
+//
+//	PUT /api/v1/benches/:id/modules/:bmid/conf
+func SetBenchModuleConf(c *gin.Context) {
+	bench, err := getOwnBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	bm, err := getBenchModule(c, bench)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	b, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	var conf map[string]interface{}
+	if err := json.Unmarshal(b, &conf); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "conf has to be a JSON object: " + err.Error()})
+		return
+	}
+
+	result := model.DB.WithContext(c).Model(bm).Update("conf", datatypes.JSON(b))
+	if result.Error != nil {
+		abortWithError(c, result.Error)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", b)
+}
+
+// PinBenchModule sets the revision a module on a bench is merged at. The revision
+// can be anything git understands (commit hash, tag, branch), an empty one bumps
+// the module to the latest commit.
+//
+//	PUT /api/v1/benches/:id/modules/:bmid/revision
+func PinBenchModule(c *gin.Context) {
+	var req RevisionRequest
+
+	bench, err := getOwnBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	id, err := paramID(c, "bmid")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bm, err := ops.PinBenchModule(c, bench, id, req.Revision)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, bm)
+}
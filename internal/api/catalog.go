@@ -0,0 +1,206 @@
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+)
+
+// CategoryRequest creates or changes a category
+type CategoryRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// FilterRequest creates or changes a search filter, the name defaults to the key
+type FilterRequest struct {
+	Key         string `json:"key" binding:"required"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ListCategories lists all categories with the number of modules in them
+//
+//	GET /api/v1/categories
+func ListCategories(c *gin.Context) {
+	categories, err := ops.Categories(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, categories)
+}
+
+// CreateCategory adds a new category
+//
+//	POST /api/v1/admin/categories
+func CreateCategory(c *gin.Context) {
+	var req CategoryRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, err := ops.CreateCategory(c, &model.Category{Name: req.Name, Description: req.Description})
+	if errors.Is(err, ops.ErrCategoryExists) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error(), "id": category.ID})
+		return
+	} else if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+// UpdateCategory renames a category or changes its description
+//
+//	PUT /api/v1/admin/categories/:id
+func UpdateCategory(c *gin.Context) {
+	var req CategoryRequest
+
+	id, err := paramID(c, "id")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, err := ops.UpdateCategory(c, id.String(), &model.Category{Name: req.Name, Description: req.Description})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// DeleteCategory removes a category, its modules are moved into the category given by
+// the into query parameter or the default category
+//
+//	DELETE /api/v1/admin/categories/:id?into=...
+func DeleteCategory(c *gin.Context) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	into := c.Query("into")
+	if into != "" {
+		if _, err := uuid.Parse(into); err != nil {
+			abortWithError(c, ErrInvalidID)
+			return
+		}
+	}
+
+	moved, err := ops.DeleteCategory(c, id.String(), into)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"moved": moved})
+}
+
+// ListFilters lists the filters of the parametric search
+//
+//	GET /api/v1/filters
+func ListFilters(c *gin.Context) {
+	filters, err := ops.Filters(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, filters)
+}
+
+// CreateFilter adds a filter for a parameter
+//
+//	POST /api/v1/admin/filters
+func CreateFilter(c *gin.Context) {
+	var req FilterRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := ops.CreateFilter(c, &model.Filter{Key: req.Key, Name: req.Name, Description: req.Description})
+	if errors.Is(err, ops.ErrFilterExists) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error(), "id": filter.ID})
+		return
+	} else if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, filter)
+}
+
+// UpdateFilter changes the key, name or description of a filter
+//
+//	PUT /api/v1/admin/filters/:id
+func UpdateFilter(c *gin.Context) {
+	var req FilterRequest
+
+	id, err := filterID(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := ops.UpdateFilter(c, id, &model.Filter{Key: req.Key, Name: req.Name, Description: req.Description})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, filter)
+}
+
+// DeleteFilter removes a filter
+//
+//	DELETE /api/v1/admin/filters/:id
+func DeleteFilter(c *gin.Context) {
+	id, err := filterID(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := ops.DeleteFilter(c, id); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// filterID parses the id of a filter, unlike the other models they have numeric ids
+func filterID(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		return 0, ErrInvalidID
+	}
+	return uint(id), nil
+}
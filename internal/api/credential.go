@@ -0,0 +1,71 @@
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+)
+
+// CredentialRequest stores credentials for private repositories
+type CredentialRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Kind     string `json:"kind" binding:"required"` // "token" or "ssh"
+	Username string `json:"username"`
+	Secret   string `json:"secret" binding:"required"` // access token or private key
+}
+
+// ListCredentials lists the repository credentials of the current user without their secrets
+//
+//	GET /api/v1/credentials
+func ListCredentials(c *gin.Context) {
+	creds, err := ops.UserCredentials(c, currentUser(c))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, creds)
+}
+
+// CreateCredential stores new repository credentials, the secret can't be retrieved afterwards
+//
+//	POST /api/v1/credentials
+func CreateCredential(c *gin.Context) {
+	var req CredentialRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cred := &model.Credential{Name: req.Name, Kind: req.Kind, Username: req.Username}
+
+	if err := ops.CreateCredential(c, currentUser(c), cred, req.Secret); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, cred)
+}
+
+// DeleteCredential removes repository credentials, modules using them lose access to private repositories
+//
+//	DELETE /api/v1/credentials/:id
+func DeleteCredential(c *gin.Context) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := ops.DeleteCredential(c, currentUser(c), id); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,90 @@
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+)
+
+// ImportRequest registers several sub-modules of a repository at once
+type ImportRequest struct {
+	RepoURL string          `json:"repo_url" binding:"required"`
+	Modules []ModuleRequest `json:"modules" binding:"required"`
+}
+
+// ScanRepository queues listing the sub-modules in the edea.yml of a repository,
+// the finished job has them in its result
+//
+//	GET /api/v1/import?repo_url=https://...
+func ScanRepository(c *gin.Context) {
+	url := c.Query("repo_url")
+	if url == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "repo_url is required"})
+		return
+	}
+
+	job, err := jobs.ScanRepository(c, currentUser(c).ID, url)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	accepted(c, job)
+}
+
+// ImportModules registers the given sub-modules of a repository in one transaction
+// and queues their import. The repo_url of the individual modules is ignored.
+//
+//	POST /api/v1/import
+func ImportModules(c *gin.Context) {
+	var req ImportRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Modules) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "modules must not be empty"})
+		return
+	}
+
+	user := currentUser(c)
+
+	modules := make([]*model.Module, 0, len(req.Modules))
+	for _, m := range req.Modules {
+		modules = append(modules, &model.Module{
+			Name:        m.Name,
+			Sub:         m.Sub,
+			Description: m.Description,
+			CategoryID:  m.CategoryID,
+			Private:     m.Private,
+		})
+	}
+
+	err := ops.RegisterModules(c, user, req.RepoURL, modules)
+	if errors.Is(err, ops.ErrModuleExists) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	queued := make([]*model.Job, 0, len(modules))
+	for _, module := range modules {
+		job, err := jobs.ImportModule(c, user.ID, module)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		queued = append(queued, job)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"modules": modules, "jobs": queued})
+}
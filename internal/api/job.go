@@ -0,0 +1,92 @@
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gorm.io/gorm"
+)
+
+// accepted responds with a queued job and where to poll for its status
+func accepted(c *gin.Context, job *model.Job) {
+	c.Header("Location", "/api/v1/jobs/"+job.ID.String())
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListJobs lists the jobs of the current user, newest first
+//
+//	GET /api/v1/jobs?status=queued&limit=50&offset=0
+func ListJobs(c *gin.Context) {
+	var list []model.Job
+
+	tx := model.DB.WithContext(c).Scopes(paginate(c)).Where("user_id = ?", currentUser(c).ID)
+	if status := c.Query("status"); status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+
+	if err := tx.Order("created_at desc").Find(&list).Error; err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// GetJob returns the status of a job. Jobs of other users are not found,
+// jobs queued without a user (e.g. diffs requested anonymously) are visible to everyone.
+//
+//	GET /api/v1/jobs/:id
+func GetJob(c *gin.Context) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	job, err := jobs.Get(id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if job.UserID != uuid.Nil {
+		u := currentUser(c)
+		if u == nil || (u.ID != job.UserID && !u.IsAdmin) {
+			abortWithError(c, gorm.ErrRecordNotFound)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// MergeBench queues merging a bench into a new project, the archive can be
+// downloaded from the result url of the job once it's done
+//
+//	POST /api/v1/benches/:id/merge
+func MergeBench(c *gin.Context) {
+	var userID uuid.UUID
+
+	bench, err := getBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if u := currentUser(c); u != nil {
+		userID = u.ID
+	}
+
+	job, err := jobs.MergeBench(c, userID, bench)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	accepted(c, job)
+}
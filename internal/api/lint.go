@@ -0,0 +1,52 @@
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
+	"gitlab.com/edea-dev/edea-server/internal/lint"
+)
+
+// maximum size of an edea.yml sent to LintFile
+const maxLintSize = 1 << 20
+
+// LintRepository queues validating the edea.yml of a repository at a revision, HEAD by default,
+// the finished job has the problems in its result
+//
+//	GET /api/v1/lint?repo_url=https://...&revision=v1.0
+func LintRepository(c *gin.Context) {
+	url := c.Query("repo_url")
+	if url == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "repo_url is required"})
+		return
+	}
+
+	job, err := jobs.LintRepository(c, currentUser(c).ID, url, c.Query("revision"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	accepted(c, job)
+}
+
+// LintFile validates an edea.yml sent as the request body, paths aren't checked against a repository
+//
+//	POST /api/v1/lint
+func LintFile(c *gin.Context) {
+	b, err := io.ReadAll(io.LimitReader(c.Request.Body, maxLintSize+1))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(b) > maxLintSize {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "edea.yml is too large"})
+		return
+	}
+
+	c.JSON(http.StatusOK, lint.Validate(b, nil))
+}
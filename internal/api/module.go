@@ -0,0 +1,268 @@
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+)
+
+// ModuleRequest is the body of create and update requests for modules
+type ModuleRequest struct {
+	Name        string `json:"name" binding:"required"`
+	RepoURL     string `json:"repo_url"`
+	Sub         string `json:"sub"`
+	Description string `json:"description"`
+	CategoryID  string `json:"category_id"`
+	Private     bool   `json:"private"`
+
+	CredentialID *string `json:"credential_id"` // empty for public repositories, left out to keep the current ones
+}
+
+// credentialID parses the credential_id of a request, current is kept if it was left out
+func (r *ModuleRequest) credentialID(current *uuid.UUID) (*uuid.UUID, error) {
+	if r.CredentialID == nil {
+		return current, nil
+	}
+	if *r.CredentialID == "" {
+		return nil, nil
+	}
+
+	id, err := uuid.Parse(*r.CredentialID)
+	if err != nil {
+		return nil, ErrInvalidID
+	}
+	return &id, nil
+}
+
+// getModule loads a module by id with the same visibility rules as the module pages
+func getModule(c *gin.Context) (*model.Module, error) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	module := new(model.Module)
+
+	result := model.DB.Scopes(model.ModulesVisibleTo(currentUser(c))).Preload("Category").Preload("User").First(module, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return module, nil
+}
+
+// ListModules returns the modules visible to the current user
+//
+//	GET /api/v1/modules?user_id=&category_id=&limit=&offset=
+func ListModules(c *gin.Context) {
+	var modules []model.Module
+
+	tx := model.DB.Scopes(model.ModulesVisibleTo(currentUser(c)), paginate(c)).Preload("Category").Preload("User")
+
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			abortWithError(c, ErrInvalidID)
+			return
+		}
+		tx = tx.Where("user_id = ?", id)
+	}
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		id, err := uuid.Parse(categoryID)
+		if err != nil {
+			abortWithError(c, ErrInvalidID)
+			return
+		}
+		tx = tx.Where("category_id = ?", id)
+	}
+
+	if result := tx.Order("updated_at desc").Find(&modules); result.Error != nil {
+		abortWithError(c, result.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, modules)
+}
+
+// GetModule returns a single module
+//
+//	GET /api/v1/modules/:id
+func GetModule(c *gin.Context) {
+	module, err := getModule(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, module)
+}
+
+// GetModuleDependencies returns the dependency graph of a module
+//
+//	GET /api/v1/modules/:id/dependencies
+func GetModuleDependencies(c *gin.Context) {
+	module, err := getModule(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	graph, err := ops.ResolveDependencies(c, currentUser(c), module)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if graph == nil {
+		graph = []*ops.DependencyNode{}
+	}
+
+	c.JSON(http.StatusOK, graph)
+}
+
+// CreateModule registers a new module and queues the import of its repository
+//
+//	POST /api/v1/modules
+func CreateModule(c *gin.Context) {
+	var req ModuleRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.RepoURL == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "repo_url is required"})
+		return
+	}
+
+	credentialID, err := req.credentialID(nil)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	module := &model.Module{
+		Name:         req.Name,
+		RepoURL:      req.RepoURL,
+		Sub:          req.Sub,
+		Description:  req.Description,
+		CategoryID:   req.CategoryID,
+		Private:      req.Private,
+		CredentialID: credentialID,
+	}
+
+	user := currentUser(c)
+
+	module, err = ops.RegisterModule(c, user, module)
+	if errors.Is(err, ops.ErrModuleExists) && module != nil {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error(), "id": module.ID})
+		return
+	} else if errors.Is(err, ops.ErrModuleExists) {
+		// the existing module is private to someone else
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	// the repository is cloned in the background
+	job, err := jobs.ImportModule(c, user.ID, module)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	accepted(c, job)
+}
+
+// UpdateModule changes the name, description, category, visibility and credentials of a module
+//
+//	PUT /api/v1/modules/:id
+func UpdateModule(c *gin.Context) {
+	var req ModuleRequest
+
+	module, err := getModule(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.CategoryID == "" {
+		req.CategoryID = module.CategoryID
+	}
+
+	credentialID, err := req.credentialID(module.CredentialID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	module, err = ops.UpdateModule(c, module.ID, &model.Module{
+		Name:         req.Name,
+		Description:  req.Description,
+		CategoryID:   req.CategoryID,
+		Private:      req.Private,
+		CredentialID: credentialID,
+	})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, module)
+}
+
+// DeleteModule removes a module
+//
+//	DELETE /api/v1/modules/:id
+func DeleteModule(c *gin.Context) {
+	module, err := getModule(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := ops.DeleteModule(c, module.ID); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// PullModule queues fetching the latest changes of the module repository and updating the metadata
+//
+//	POST /api/v1/modules/:id/pull
+func PullModule(c *gin.Context) {
+	module, err := getModule(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	// only the owner (or an admin) should trigger pulls
+	if err := model.IsAuthorized(c, module.UserID); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	job, err := jobs.PullModule(c, currentUser(c).ID, module)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	accepted(c, job)
+}
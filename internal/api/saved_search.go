@@ -0,0 +1,169 @@
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/search"
+)
+
+// SavedSearchRequest saves a full text search with its words and facet filters or a
+// parametric search with its query, params and category
+type SavedSearchRequest struct {
+	Name     string               `json:"name" binding:"required"`
+	Kind     string               `json:"kind" binding:"required"` // "text" or "params"
+	Text     string               `json:"text"`                    // words of a full text search or query of a parametric search
+	Filters  map[string][]string  `json:"filters"`                 // facet values of a full text search
+	Params   []search.SearchParam `json:"params"`                  // comparisons of a parametric search
+	Category string               `json:"category"`                // category id of a parametric search
+	Email    bool                 `json:"email"`                   // also notify by email
+}
+
+// savedSearch converts the request to a saved search
+func (req *SavedSearchRequest) savedSearch() *model.SavedSearch {
+	s := &model.SavedSearch{
+		Name:       req.Name,
+		Kind:       req.Kind,
+		Text:       req.Text,
+		CategoryID: req.Category,
+		Email:      req.Email,
+	}
+	if len(req.Filters) > 0 {
+		s.Filters, _ = json.Marshal(req.Filters)
+	}
+	if len(req.Params) > 0 {
+		s.Params, _ = json.Marshal(req.Params)
+	}
+	return s
+}
+
+// ListSavedSearches lists the saved searches of the current user
+//
+//	GET /api/v1/saved_searches
+func ListSavedSearches(c *gin.Context) {
+	searches, err := ops.SavedSearches(c, currentUser(c))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, searches)
+}
+
+// CreateSavedSearch saves a search, the current user is notified when a module starts matching it
+//
+//	POST /api/v1/saved_searches
+func CreateSavedSearch(c *gin.Context) {
+	var req SavedSearchRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s := req.savedSearch()
+	if err := ops.CreateSavedSearch(c, currentUser(c), s); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, s)
+}
+
+// UpdateSavedSearch replaces a saved search, the modules matching the new one aren't notified
+//
+//	PUT /api/v1/saved_searches/:id
+func UpdateSavedSearch(c *gin.Context) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	var req SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s, err := ops.UpdateSavedSearch(c, currentUser(c), id, req.savedSearch())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
+
+// DeleteSavedSearch removes a saved search, its notifications stay
+//
+//	DELETE /api/v1/saved_searches/:id
+func DeleteSavedSearch(c *gin.Context) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := ops.DeleteSavedSearch(c, currentUser(c), id); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListNotifications lists the notifications of the current user, the newest first
+//
+//	GET /api/v1/notifications?unread=true
+func ListNotifications(c *gin.Context) {
+	var list []model.Notification
+
+	tx := model.DB.WithContext(c).Scopes(paginate(c)).Where("user_id = ?", currentUser(c).ID)
+	if c.Query("unread") == "true" {
+		tx = tx.Where("read_at IS NULL")
+	}
+
+	if err := tx.Order("created_at desc").Find(&list).Error; err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// ReadNotification marks a notification as read
+//
+//	POST /api/v1/notifications/:id/read
+func ReadNotification(c *gin.Context) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	n, err := ops.ReadNotification(c, currentUser(c), id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, n)
+}
+
+// ReadAllNotifications marks all notifications of the current user as read
+//
+//	POST /api/v1/notifications/read
+func ReadAllNotifications(c *gin.Context) {
+	if err := ops.ReadAllNotifications(c, currentUser(c)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,180 @@
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+)
+
+// CategoryParamRequest creates or changes a parameter in the schema of a category. The bounds
+// are numbers in the base unit or quantities like "4.5V".
+type CategoryParamRequest struct {
+	Key         string      `json:"key" binding:"required"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Type        string      `json:"type"`
+	Unit        string      `json:"unit"`
+	Required    bool        `json:"required"`
+	Min         interface{} `json:"min"`
+	Max         interface{} `json:"max"`
+	Enum        []string    `json:"enum"`
+	Position    int         `json:"position"`
+}
+
+// param converts the request to a parameter of the category
+func (req *CategoryParamRequest) param(categoryID string) (*model.CategoryParam, error) {
+	p := &model.CategoryParam{
+		CategoryID:  categoryID,
+		Key:         req.Key,
+		Name:        req.Name,
+		Description: req.Description,
+		Type:        req.Type,
+		Unit:        req.Unit,
+		Required:    req.Required,
+		Enum:        ops.EnumJSON(req.Enum),
+		Position:    req.Position,
+	}
+
+	var err error
+	if p.Min, err = bound(req.Min, req.Unit); err != nil {
+		return nil, err
+	}
+	if p.Max, err = bound(req.Max, req.Unit); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// bound reads a bound given as JSON number or string
+func bound(v interface{}, unit string) (*float64, error) {
+	switch b := v.(type) {
+	case nil:
+		return nil, nil
+	case float64:
+		return &b, nil
+	case string:
+		return ops.ParseBound(b, unit)
+	}
+	return nil, fmt.Errorf("%w: bounds have to be numbers or quantities", ops.ErrInvalidParam)
+}
+
+// ListCategoryParams lists the parameter schema of a category
+//
+//	GET /api/v1/categories/:id/params
+func ListCategoryParams(c *gin.Context) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	params, err := ops.CategoryParams(c, id.String())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, params)
+}
+
+// CreateCategoryParam adds a parameter to the schema of a category
+//
+//	POST /api/v1/admin/categories/:id/params
+func CreateCategoryParam(c *gin.Context) {
+	var req CategoryParamRequest
+
+	id, err := paramID(c, "id")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, err := req.param(id.String())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	param, err := ops.CreateCategoryParam(c, p)
+	if errors.Is(err, ops.ErrParamExists) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error(), "id": param.ID})
+		return
+	} else if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, param)
+}
+
+// UpdateCategoryParam replaces the definition of a parameter
+//
+//	PUT /api/v1/admin/categories/:id/params/:pid
+func UpdateCategoryParam(c *gin.Context) {
+	var req CategoryParamRequest
+
+	id, err := paramID(c, "id")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	pid, err := paramID(c, "pid")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, err := req.param(id.String())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	param, err := ops.UpdateCategoryParam(c, pid, p)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, param)
+}
+
+// DeleteCategoryParam removes a parameter from the schema of a category
+//
+//	DELETE /api/v1/admin/categories/:id/params/:pid
+func DeleteCategoryParam(c *gin.Context) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	pid, err := paramID(c, "pid")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := ops.DeleteCategoryParam(c, id.String(), pid); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
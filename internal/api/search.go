@@ -0,0 +1,24 @@
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/search"
+)
+
+// Search runs a full text search over benches and modules. The values of each facet are given
+// by its name, e.g. tags=ldo&tags=usb, hits need one value of every facet given.
+//
+//	GET /api/v1/search?q=...&type=...&category=...&author=...&tags=...&sort=...&limit=...&offset=...
+func Search(c *gin.Context) {
+	res, err := search.Find(search.QueryFromRequest(c))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
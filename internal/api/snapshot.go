@@ -0,0 +1,139 @@
+package api
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+)
+
+// SnapshotRequest names a new snapshot
+type SnapshotRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// ListSnapshots lists the snapshots of a bench, newest first
+//
+//	GET /api/v1/benches/:id/snapshots
+func ListSnapshots(c *gin.Context) {
+	var snaps []model.BenchSnapshot
+
+	bench, err := getBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	result := model.DB.WithContext(c).Scopes(paginate(c)).Where("bench_id = ?", bench.ID).Order("created_at desc").Find(&snaps)
+	if result.Error != nil {
+		abortWithError(c, result.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, snaps)
+}
+
+// CreateSnapshot freezes the current state of a bench
+//
+//	POST /api/v1/benches/:id/snapshots
+func CreateSnapshot(c *gin.Context) {
+	var req SnapshotRequest
+
+	bench, err := getOwnBench(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	snap, err := ops.CreateSnapshot(c, bench, req.Name, req.Description)
+	if errors.Is(err, ops.ErrSnapshotExists) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("Location", "/api/v1/snapshots/"+snap.ID.String())
+	c.JSON(http.StatusCreated, snap)
+}
+
+// getSnapshot loads the snapshot of the id parameter if the bench is visible to the user
+func getSnapshot(c *gin.Context) (*model.BenchSnapshot, *model.Bench, error) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ops.GetSnapshot(c, currentUser(c), id)
+}
+
+// GetSnapshot returns a snapshot including its modules
+//
+//	GET /api/v1/snapshots/:id
+func GetSnapshot(c *gin.Context) {
+	snap, _, err := getSnapshot(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, snap)
+}
+
+// MergeSnapshot queues merging a snapshot into a new project
+//
+//	POST /api/v1/snapshots/:id/merge
+func MergeSnapshot(c *gin.Context) {
+	var userID uuid.UUID
+
+	snap, _, err := getSnapshot(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if u := currentUser(c); u != nil {
+		userID = u.ID
+	}
+
+	job, err := jobs.MergeSnapshot(c, userID, snap)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	accepted(c, job)
+}
+
+// ForkSnapshot creates a new active bench for the current user from a snapshot
+//
+//	POST /api/v1/snapshots/:id/fork
+func ForkSnapshot(c *gin.Context) {
+	snap, bench, err := getSnapshot(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	fork, err := ops.ForkBench(c, currentUser(c), bench, ops.SnapshotModules(snap))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("Location", "/api/v1/benches/"+fork.ID.String())
+	c.JSON(http.StatusCreated, fork)
+}
@@ -3,6 +3,7 @@ package auth
 // SPDX-License-Identifier: EUPL-1.2
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gin-gonic/gin"
 	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
 	"gitlab.com/edea-dev/edea-server/internal/view"
 	"go.uber.org/zap"
 )
@@ -37,6 +39,11 @@ func processAuth(c *gin.Context) error {
 		return model.ErrUnauthorized
 	}
 
+	// personal access tokens are handled separately from the OIDC tokens
+	if tok, ok := isToken(auth); ok {
+		return processToken(c, tok)
+	}
+
 	if len(auth) > 0 {
 		raw = strings.Replace(auth, "Bearer ", "", 1)
 	}
@@ -89,6 +96,12 @@ func RequireAuth() gin.HandlerFunc {
 				errors.New("Authorization header/session cookie missing"),
 			)
 			view.RenderTemplate(c, "403.tmpl", "Forbidden", nil)
+			return
+		}
+
+		// pages behind this can change data, read-only tokens shouldn't get there
+		if !requireWriteScope(c) {
+			return
 		}
 
 		// auth key is set, everything is fine
@@ -96,11 +109,28 @@ func RequireAuth() gin.HandlerFunc {
 	})
 }
 
+// RequireAdmin only lets admins through, it has to run after RequireAuth
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if u, ok := c.Keys["user"].(*model.User); !ok || !u.IsAdmin {
+			c.AbortWithError(http.StatusForbidden, model.ErrUnauthorized)
+			view.RenderTemplate(c, "403.tmpl", "Forbidden", nil)
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // Authenticate checks if an authorization header or cookie is present and processes it
 func Authenticate() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		if err := processAuth(c); err != nil {
 			// only show an error if something is wrong with the token (expired tokens are not an error)
+			if errors.Is(err, ErrInvalidToken) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
 			if !errors.Is(err, model.ErrUnauthorized) && !strings.Contains(err.Error(), "expired") {
 				zap.L().Error("could not process authentication cookie/header", zap.Error(err))
 				c.Abort()
@@ -122,17 +152,13 @@ func createUser(claims *model.AuthClaims) {
 		u.Handle = claims.Nickname
 	}
 
-	if result := model.DB.Model(&u).Create(&u); result.Error != nil {
-		zap.L().Error("could not create new user", zap.Error(result.Error), zap.String("auth_uuid", claims.Subject))
-	}
-
-	p := model.Profile{DisplayName: claims.Nickname, Avatar: claims.Picture, UserID: u.ID}
+	p := model.Profile{DisplayName: claims.Nickname, Avatar: claims.Picture}
 	if p.DisplayName == "" {
 		p.DisplayName = claims.Subject
 	}
 
-	if result := model.DB.Model(&p).Create(&p); result.Error != nil {
-		zap.L().Panic("could not create new user", zap.Error(result.Error), zap.String("auth_uuid", claims.Subject))
+	if err := ops.CreateUser(context.Background(), &u, &p); err != nil {
+		zap.L().Panic("could not create new user", zap.Error(err), zap.String("auth_uuid", claims.Subject))
 	}
 
 	zap.L().Info("created a new user", zap.Object("user", &u))
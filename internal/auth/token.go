@@ -0,0 +1,141 @@
+package auth
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/view"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// TokenPrefix marks personal access tokens so we can tell them apart from JWTs
+const TokenPrefix = "edea_"
+
+var (
+	// ErrInvalidToken is returned for unknown, revoked or expired personal access tokens
+	ErrInvalidToken = errors.New("invalid or expired access token")
+	// ErrInsufficientScope is returned if a personal access token lacks the scope for a request
+	ErrInsufficientScope = errors.New("access token does not have the required scope")
+	// ErrSessionRequired is returned if a personal access token is used for something only a browser session may do
+	ErrSessionRequired = errors.New("not possible with an access token, log in with the browser")
+)
+
+// GenerateToken creates a new random personal access token and returns it together with the hash to store
+func GenerateToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = TokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex encoded sha256 sum of a token. tokens have enough
+// entropy that a slow password hash isn't necessary.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// processToken authenticates a request with a personal access token
+func processToken(c *gin.Context, raw string) error {
+	t := &model.Token{}
+
+	result := model.DB.Preload("User").Where("hash = ?", HashToken(raw)).First(t)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		return result.Error
+	}
+
+	if t.Expired() {
+		return ErrInvalidToken
+	}
+
+	user := t.User
+
+	// admin privileges need to be granted to the token explicitly
+	if !t.HasScope(model.ScopeAdmin) {
+		user.IsAdmin = false
+	}
+
+	if result := model.DB.Model(t).UpdateColumn("last_used_at", time.Now()); result.Error != nil {
+		zap.L().Warn("could not update token usage", zap.Error(result.Error), zap.String("token_id", t.ID.String()))
+	}
+
+	c.Keys = make(map[string]interface{})
+	c.Keys["auth"] = model.AuthClaims{Subject: user.AuthUUID}
+	c.Keys["user"] = &user
+	c.Keys["token"] = t
+
+	return nil
+}
+
+// isToken checks if the authorization header contains a personal access token
+func isToken(header string) (string, bool) {
+	for _, scheme := range []string{"Bearer ", "token "} {
+		if raw := strings.TrimPrefix(header, scheme); raw != header && strings.HasPrefix(raw, TokenPrefix) {
+			return raw, true
+		}
+	}
+	return "", false
+}
+
+// HasScope returns true if the request is authenticated by a session or by a token with the given scope
+func HasScope(c *gin.Context, scope string) bool {
+	t, ok := c.Keys["token"].(*model.Token)
+	if !ok {
+		// browser sessions have all the privileges of the user
+		return true
+	}
+	return t.HasScope(scope)
+}
+
+// RequireScope aborts requests authenticated by a personal access token which lacks the scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasScope(c, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrInsufficientScope.Error()})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSession aborts requests authenticated by a personal access token, so that a leaked
+// token can't create tokens or credentials which outlive its revocation
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Keys["token"].(*model.Token); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrSessionRequired.Error()})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requireWriteScope renders the forbidden page for token requests to pages which change data
+func requireWriteScope(c *gin.Context) bool {
+	if HasScope(c, model.ScopeWrite) {
+		return true
+	}
+
+	c.AbortWithError(http.StatusForbidden, ErrInsufficientScope)
+	view.RenderTemplate(c, "403.tmpl", "Forbidden", nil)
+	return false
+}
@@ -0,0 +1,224 @@
+// Package check finds and repairs inconsistencies between the repository cache on disk,
+// the database and the search index.
+package check
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"sort"
+
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"gitlab.com/edea-dev/edea-server/internal/search"
+	"go.uber.org/zap"
+)
+
+// Kinds of problems
+const (
+	OrphanedClone     = "orphaned_clone"     // a clone on disk without a repository row
+	MissingClone      = "missing_clone"      // a repository row whose clone is gone or broken
+	MissingRepository = "missing_repository" // modules whose repository isn't cached at all
+	StaleEntry        = "stale_entry"        // an index entry for a deleted object
+	OutdatedEntry     = "outdated_entry"     // an index entry whose visibility, owner or name changed
+	MissingEntry      = "missing_entry"      // an object which isn't in the index
+)
+
+// Problem is a single inconsistency, Subject is a path, repository URL or object ID
+type Problem struct {
+	Kind     string `json:"kind"`
+	Subject  string `json:"subject"`
+	Detail   string `json:"detail,omitempty"`
+	Repaired bool   `json:"repaired"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Report is the result of a check
+type Report struct {
+	Problems      []Problem `json:"problems"`
+	SearchSkipped bool      `json:"search_skipped"` // the search backend wasn't available
+}
+
+// Unresolved counts the problems which are still there
+func (r *Report) Unresolved() int {
+	n := 0
+	for _, p := range r.Problems {
+		if !p.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+// Run checks everything and repairs what it finds if repair is set.
+// Missing repositories are cloned first so that clones which are still
+// on disk are reused instead of being removed as orphans.
+func Run(ctx context.Context, repair bool) (*Report, error) {
+	r := &Report{Problems: []Problem{}}
+
+	checks := []func(context.Context, *Report, bool) error{
+		missingRepositories,
+		missingClones,
+		orphanedClones,
+		searchIndex,
+	}
+
+	for _, check := range checks {
+		if err := ctx.Err(); err != nil {
+			return r, err
+		}
+		if err := check(ctx, r, repair); err != nil {
+			return r, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Report) add(p Problem, repair bool, fix func() error) {
+	if repair {
+		if err := fix(); err != nil {
+			zap.L().Warn("could not repair", zap.String("kind", p.Kind), zap.String("subject", p.Subject), zap.Error(err))
+			p.Error = err.Error()
+		} else {
+			p.Repaired = true
+		}
+	}
+
+	r.Problems = append(r.Problems, p)
+}
+
+func missingRepositories(ctx context.Context, r *Report, repair bool) error {
+	var urls []string
+
+	result := model.DB.WithContext(ctx).Model(&model.Module{}).
+		Where("deleted_at is null and not exists (select 1 from repositories r where r.url = modules.repo_url)").
+		Distinct().Pluck("repo_url", &urls)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, url := range urls {
+		url := url
+		r.add(Problem{Kind: MissingRepository, Subject: url}, repair, func() error {
+			return repo.Add(url)
+		})
+	}
+
+	return nil
+}
+
+func missingClones(ctx context.Context, r *Report, repair bool) error {
+	repos, err := repo.MissingClones()
+	if err != nil {
+		return err
+	}
+
+	for i := range repos {
+		rp := &repos[i]
+		r.add(Problem{Kind: MissingClone, Subject: rp.URL, Detail: rp.Location}, repair, func() error {
+			return repo.Reclone(rp)
+		})
+	}
+
+	return nil
+}
+
+func orphanedClones(ctx context.Context, r *Report, repair bool) error {
+	paths, err := repo.OrphanedClones()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		path := path
+		r.add(Problem{Kind: OrphanedClone, Subject: path}, repair, func() error {
+			return repo.RemoveOrphan(path)
+		})
+	}
+
+	return nil
+}
+
+func searchIndex(ctx context.Context, r *Report, repair bool) error {
+	if !search.Enabled() {
+		r.SearchSkipped = true
+		return nil
+	}
+
+	var benches []model.Bench
+	var modules []model.Module
+
+	if result := model.DB.WithContext(ctx).Preload("User").Find(&benches); result.Error != nil {
+		return result.Error
+	}
+	if result := model.DB.WithContext(ctx).Where("deleted_at is null").Preload("Category").Preload("User").Find(&modules); result.Error != nil {
+		return result.Error
+	}
+
+	expected := make(map[string]search.Entry, len(benches)+len(modules))
+	for _, b := range benches {
+		expected[b.ID.String()] = search.BenchToEntry(b)
+	}
+	popularity, err := search.Popularity(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range modules {
+		e := search.ModuleToEntry(m)
+		e.Popularity = popularity[e.ID]
+		expected[m.ID.String()] = e
+	}
+
+	indexed, err := search.Documents()
+	if err != nil {
+		zap.L().Warn("could not fetch the search index", zap.Error(err))
+		r.SearchSkipped = true
+		return nil
+	}
+
+	for _, p := range compareIndex(expected, indexed) {
+		e := expected[p.Subject]
+		r.add(p, repair, func() error {
+			if p.Kind == StaleEntry {
+				return search.DeleteEntry(search.Entry{ID: p.Subject})
+			}
+			return search.UpdateEntry(e)
+		})
+	}
+
+	return nil
+}
+
+// compareIndex finds the differences between what should be and what is in the search index
+func compareIndex(expected map[string]search.Entry, indexed []search.Entry) []Problem {
+	var problems []Problem
+
+	seen := make(map[string]bool, len(indexed))
+
+	for _, ie := range indexed {
+		seen[ie.ID] = true
+
+		e, ok := expected[ie.ID]
+		switch {
+		case !ok:
+			problems = append(problems, Problem{Kind: StaleEntry, Subject: ie.ID, Detail: ie.Type + " " + ie.Name})
+		case e.Public != ie.Public:
+			problems = append(problems, Problem{Kind: OutdatedEntry, Subject: ie.ID, Detail: e.Type + " " + e.Name + " changed visibility"})
+		case e.UserID != ie.UserID:
+			problems = append(problems, Problem{Kind: OutdatedEntry, Subject: ie.ID, Detail: e.Type + " " + e.Name + " changed owner"})
+		case e.Type != ie.Type || e.Name != ie.Name:
+			problems = append(problems, Problem{Kind: OutdatedEntry, Subject: ie.ID, Detail: e.Type + " " + e.Name + " was renamed"})
+		}
+	}
+
+	var missing []Problem
+	for id, e := range expected {
+		if !seen[id] {
+			missing = append(missing, Problem{Kind: MissingEntry, Subject: id, Detail: e.Type + " " + e.Name})
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Subject < missing[j].Subject })
+
+	return append(problems, missing...)
+}
@@ -0,0 +1,45 @@
+package check
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"testing"
+
+	"gitlab.com/edea-dev/edea-server/internal/search"
+)
+
+func TestCompareIndex(t *testing.T) {
+	expected := map[string]search.Entry{
+		"a": {ID: "a", Type: "module", Name: "LDO", UserID: "u1", Public: true},
+		"b": {ID: "b", Type: "module", Name: "Buck", UserID: "u1", Public: false},
+		"c": {ID: "c", Type: "bench", Name: "Bench", UserID: "u2", Public: true},
+		"d": {ID: "d", Type: "module", Name: "Renamed", UserID: "u2", Public: true},
+		"e": {ID: "e", Type: "module", Name: "Missing", UserID: "u2", Public: true},
+	}
+	indexed := []search.Entry{
+		{ID: "a", Type: "module", Name: "LDO", UserID: "u1", Public: true},
+		{ID: "b", Type: "module", Name: "Buck", UserID: "u1", Public: true},
+		{ID: "c", Type: "bench", Name: "Bench", UserID: "u3", Public: true},
+		{ID: "d", Type: "module", Name: "Old", UserID: "u2", Public: true},
+		{ID: "x", Type: "module", Name: "Deleted", UserID: "u1", Public: true},
+	}
+
+	want := map[string]string{
+		"b": OutdatedEntry,
+		"c": OutdatedEntry,
+		"d": OutdatedEntry,
+		"x": StaleEntry,
+		"e": MissingEntry,
+	}
+
+	problems := compareIndex(expected, indexed)
+	if len(problems) != len(want) {
+		t.Fatalf("got %d problems, want %d: %+v", len(problems), len(want), problems)
+	}
+
+	for _, p := range problems {
+		if want[p.Subject] != p.Kind {
+			t.Errorf("%s: got %s, want %s", p.Subject, p.Kind, want[p.Subject])
+		}
+	}
+}
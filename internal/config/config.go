@@ -4,6 +4,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap"
@@ -24,7 +25,8 @@ type Config struct {
 	DSN   string `yaml:"dsn" envconfig:"DB_DSN"`
 	Cache struct {
 		Repo struct {
-			Base string `yaml:"base" envconfig:"REPO_CACHE_BASE"`
+			Base    string `yaml:"base" envconfig:"REPO_CACHE_BASE"`
+			MaxSize int64  `yaml:"max_size" envconfig:"REPO_CACHE_MAX_SIZE"` // in MiB, zero for no limit
 		} `yaml:"repo"`
 		Book struct {
 			Base string `yaml:"base" envconfig:"BOOK_CACHE_BASE"` // mdbook destination folder
@@ -32,6 +34,9 @@ type Config struct {
 		Plot struct {
 			Base string `yaml:"base" envconfig:"PLOT_CACHE_BASE"` // edea diff destination folder
 		} `yaml:"plot"`
+		Job struct {
+			Base string `yaml:"base" envconfig:"JOB_CACHE_BASE"` // job results such as merged benches
+		} `yaml:"job"`
 	} `yaml:"cache"`
 	Auth struct {
 		OIDC struct {
@@ -50,10 +55,35 @@ type Config struct {
 		} `yaml:"oidc_server"`
 	} `yaml:"auth"`
 	Search struct {
-		Host   string `yaml:"host" envconfig:"SEARCH_HOST"`
-		Index  string `yaml:"index" envconfig:"SEARCH_INDEX"`
-		APIKey string `yaml:"api_key" envconfig:"SEARCH_API_KEY"`
+		Backend string `yaml:"backend" envconfig:"SEARCH_BACKEND"` // meilisearch or database, defaults to meilisearch if a host is set
+		Host    string `yaml:"host" envconfig:"SEARCH_HOST"`
+		Index   string `yaml:"index" envconfig:"SEARCH_INDEX"`
+		APIKey  string `yaml:"api_key" envconfig:"SEARCH_API_KEY"`
 	} `yaml:"search"`
+	Jobs struct {
+		Workers int `yaml:"workers" envconfig:"JOB_WORKERS"`
+	} `yaml:"jobs"`
+	Refresh struct {
+		Interval    time.Duration `yaml:"interval" envconfig:"REFRESH_INTERVAL"` // zero disables the scheduler
+		Concurrency int           `yaml:"concurrency" envconfig:"REFRESH_CONCURRENCY"`
+	} `yaml:"refresh"`
+	Credentials struct {
+		Key        string `yaml:"key" envconfig:"CREDENTIALS_KEY"`                 // base64 encoded 32 byte key to encrypt repository credentials
+		KnownHosts string `yaml:"known_hosts" envconfig:"CREDENTIALS_KNOWN_HOSTS"` // known_hosts file for ssh, ~/.ssh/known_hosts if empty
+	} `yaml:"credentials"`
+	Webhook struct {
+		GitHubSecret string `yaml:"github_secret" envconfig:"WEBHOOK_GITHUB_SECRET"`
+		GitLabToken  string `yaml:"gitlab_token" envconfig:"WEBHOOK_GITLAB_TOKEN"`
+		GiteaSecret  string `yaml:"gitea_secret" envconfig:"WEBHOOK_GITEA_SECRET"`
+	} `yaml:"webhook"`
+	Mail struct {
+		Host     string `yaml:"host" envconfig:"MAIL_HOST"` // SMTP server, no emails are sent if empty
+		Port     int    `yaml:"port" envconfig:"MAIL_PORT"` // 587 if zero
+		Username string `yaml:"username" envconfig:"MAIL_USERNAME"`
+		Password string `yaml:"password" envconfig:"MAIL_PASSWORD"`
+		From     string `yaml:"from" envconfig:"MAIL_FROM"`
+		BaseURL  string `yaml:"base_url" envconfig:"MAIL_BASE_URL"` // public URL of the server for the links in emails
+	} `yaml:"mail"`
 }
 
 // ReadConfig reads the configuration yaml file and overrides it with any set environment variables
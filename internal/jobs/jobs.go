@@ -0,0 +1,366 @@
+// Package jobs implements a database backed job queue so that long running
+// operations like git clones and the edea tool don't block http requests.
+package jobs
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Handler runs a job, it can set Output, Result and ResultURL on the job
+type Handler func(ctx context.Context, job *model.Job) error
+
+var (
+	// ErrUnknownType is returned when a job type has no registered handler
+	ErrUnknownType = errors.New("unknown job type")
+
+	handlers        = make(map[string]Handler)
+	failureHandlers = make(map[string]Handler)
+	wake            = make(chan struct{}, 1)
+	wg              sync.WaitGroup
+
+	// running jobs outlive the context passed to Start until Wait gives up on them
+	running       = context.Background()
+	cancelRunning = func() {}
+
+	// PollInterval is the time between checks for new jobs when idle
+	PollInterval = 2 * time.Second
+	// Timeout is the maximum time a job may run before it's cancelled and
+	// after which a running job is considered abandoned
+	Timeout = 10 * time.Minute
+	// MaxAttempts is the default number of tries before a job fails
+	MaxAttempts = 3
+	// Retention is the time finished jobs are kept
+	Retention = 7 * 24 * time.Hour
+)
+
+// Register a handler for a job type
+func Register(typ string, h Handler) {
+	handlers[typ] = h
+}
+
+// OnFailure registers a handler which cleans up after a job of the type failed for good
+func OnFailure(typ string, h Handler) {
+	failureHandlers[typ] = h
+}
+
+// Enqueue adds a new job to the queue. If key is not empty and there's a pending job
+// with the same key already, the pending job is returned instead.
+func Enqueue(ctx context.Context, typ, key string, userID uuid.UUID, payload interface{}) (*model.Job, error) {
+	if _, ok := handlers[typ]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, typ)
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &model.Job{
+		UserID:      userID,
+		Type:        typ,
+		Key:         key,
+		Payload:     datatypes.JSON(b),
+		Status:      model.JobQueued,
+		MaxAttempts: MaxAttempts,
+		RunAt:       time.Now(),
+	}
+
+	err = model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if key != "" {
+			existing := new(model.Job)
+			result := tx.Where("key = ? and status in ?", key, []string{model.JobQueued, model.JobRunning}).Limit(1).Find(existing)
+			if result.Error != nil {
+				return result.Error
+			}
+			if existing.ID != uuid.Nil {
+				job = existing
+				return nil
+			}
+		}
+		return tx.Create(job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// wake up an idle worker
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+
+	zap.L().Debug("enqueued job", zap.Object("job", job))
+
+	return job, nil
+}
+
+// Get returns a job by id
+func Get(id uuid.UUID) (*model.Job, error) {
+	job := new(model.Job)
+
+	result := model.DB.First(job, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return job, nil
+}
+
+// Decode unmarshals the payload of a job
+func Decode(job *model.Job, v interface{}) error {
+	return json.Unmarshal(job.Payload, v)
+}
+
+// Start runs the given number of workers, they stop claiming jobs once the context is cancelled
+func Start(ctx context.Context, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	running, cancelRunning = context.WithCancel(context.Background())
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			worker(ctx, id)
+		}(i)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		maintenance(ctx)
+	}()
+
+	zap.L().Info("started job workers", zap.Int("workers", workers))
+}
+
+// Wait blocks until all workers finished their current job after the context passed to Start is
+// cancelled. Jobs still running after the grace period are cancelled and retried after a restart.
+func Wait(grace time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(grace):
+		zap.L().Warn("cancelling the running jobs", zap.Duration("grace", grace))
+		cancelRunning()
+		<-done
+	}
+	cancelRunning()
+}
+
+func worker(ctx context.Context, id int) {
+	for ctx.Err() == nil {
+		job, err := claim(ctx)
+		if err != nil {
+			zap.L().Error("could not claim job", zap.Error(err), zap.Int("worker", id))
+		}
+
+		if job != nil {
+			run(running, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-time.After(PollInterval):
+		}
+	}
+}
+
+// claim locks the next due job for this worker, concurrent workers skip locked rows
+func claim(ctx context.Context) (*model.Job, error) {
+	var job *model.Job
+
+	err := model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var jobs []model.Job
+
+		// sqlite has no row locks, but only one writer at a time which serializes the workers
+		if !model.SQLite(tx) {
+			tx = tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+
+		result := tx.Where("status = ? and run_at <= ?", model.JobQueued, time.Now()).
+			Order("run_at").
+			Limit(1).
+			Find(&jobs)
+		if result.Error != nil || len(jobs) == 0 {
+			return result.Error
+		}
+
+		job = &jobs[0]
+		job.Status = model.JobRunning
+		job.Attempts++
+		job.LockedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+		return tx.Model(job).Select("status", "attempts", "locked_at").Updates(job).Error
+	})
+
+	return job, err
+}
+
+// run executes a claimed job and records the outcome
+func run(ctx context.Context, job *model.Job) {
+	h, ok := handlers[job.Type]
+	if !ok {
+		finish(job, fmt.Errorf("%w: %s", ErrUnknownType, job.Type))
+		return
+	}
+
+	// jobs act on behalf of the user who queued them, authorization happened at that point
+	jctx, cancel := context.WithTimeout(model.SystemContext(ctx), Timeout)
+	defer cancel()
+
+	zap.L().Info("running job", zap.Object("job", job))
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		return h(jctx, job)
+	}()
+
+	finish(job, err)
+}
+
+// finish stores the result of a job run and schedules a retry for temporary errors
+func finish(job *model.Job, err error) {
+	var hint util.HintError
+
+	job.LockedAt = sql.NullTime{}
+
+	switch {
+	case err == nil:
+		job.Status = model.JobDone
+		job.Error = ""
+		job.FinishedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	case errors.As(err, &hint), errors.Is(err, ErrUnknownType), job.Attempts >= job.MaxAttempts:
+		// hint errors are problems with the user data, retrying won't help
+		job.Status = model.JobFailed
+		job.Error = err.Error()
+		job.FinishedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	default:
+		job.Status = model.JobQueued
+		job.Error = err.Error()
+		job.RunAt = time.Now().Add(backoff(job.Attempts))
+	}
+
+	if err != nil {
+		zap.L().Warn("job failed", zap.Error(err), zap.Object("job", job), zap.String("status", job.Status))
+	}
+
+	result := model.DB.Model(job).
+		Select("status", "error", "output", "result", "result_url", "run_at", "locked_at", "finished_at").
+		Updates(job)
+	if result.Error != nil {
+		zap.L().Error("could not update job", zap.Error(result.Error), zap.Object("job", job))
+	}
+
+	if job.Status == model.JobFailed {
+		failed(job)
+	}
+}
+
+// failed runs the failure handler of a job which won't be retried
+func failed(job *model.Job) {
+	h, ok := failureHandlers[job.Type]
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(model.SystemContext(context.Background()), Timeout)
+	defer cancel()
+
+	if err := h(ctx, job); err != nil {
+		zap.L().Error("could not clean up after a failed job", zap.Error(err), zap.Object("job", job))
+	}
+}
+
+// backoff returns the delay before the next attempt
+func backoff(attempts int) time.Duration {
+	return time.Duration(attempts*attempts) * 30 * time.Second
+}
+
+// maintenance requeues abandoned jobs (e.g. after a crash) and removes old ones
+func maintenance(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		if err := requeueAbandoned(); err != nil {
+			zap.L().Error("could not requeue abandoned jobs", zap.Error(err))
+		}
+
+		cleanup()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// requeueAbandoned retries jobs which have been running for longer than Timeout, the abandoned
+// run was counted as an attempt when it was claimed so jobs which keep crashing the server fail
+func requeueAbandoned() error {
+	var jobs []model.Job
+
+	result := model.DB.Where("status = ? and locked_at < ?", model.JobRunning, time.Now().Add(-Timeout)).Find(&jobs)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, job := range jobs {
+		update := map[string]interface{}{"locked_at": nil, "error": "abandoned while running"}
+		if job.Attempts >= job.MaxAttempts {
+			update["status"] = model.JobFailed
+			update["finished_at"] = time.Now()
+		} else {
+			update["status"] = model.JobQueued
+			update["run_at"] = time.Now().Add(backoff(job.Attempts))
+		}
+
+		// a worker which finished or reclaimed the job in the meantime changed locked_at
+		result := model.DB.Model(&model.Job{}).
+			Where("id = ? and status = ? and locked_at = ?", job.ID, model.JobRunning, job.LockedAt).
+			Updates(update)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			zap.L().Warn("abandoned job", zap.Object("job", &job), zap.Any("status", update["status"]))
+			if update["status"] == model.JobFailed {
+				failed(&job)
+			}
+		}
+	}
+
+	return nil
+}
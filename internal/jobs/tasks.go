@@ -0,0 +1,373 @@
+package jobs
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/config"
+	"gitlab.com/edea-dev/edea-server/internal/lint"
+	"gitlab.com/edea-dev/edea-server/internal/merge"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Job types
+const (
+	TypeModuleImport = "module.import"
+	TypeModulePull   = "module.pull"
+	TypeModuleDiff   = "module.diff"
+	TypeRepoScan     = "repo.scan"
+	TypeRepoLint     = "repo.lint"
+	TypeBenchMerge   = "bench.merge"
+	TypeMail         = "mail"
+)
+
+// ModulePayload references the module an import or pull job acts on
+type ModulePayload struct {
+	ModuleID uuid.UUID `json:"module_id"`
+}
+
+// DiffPayload references the module and revisions to diff
+type DiffPayload struct {
+	ModuleID uuid.UUID `json:"module_id"`
+	A        string    `json:"a"`
+	B        string    `json:"b"`
+}
+
+// RepoPayload references the repository to read and for lints the revision, HEAD if empty
+type RepoPayload struct {
+	RepoURL  string `json:"repo_url"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// BenchPayload references the bench to merge and optionally one of its snapshots
+type BenchPayload struct {
+	BenchID    uuid.UUID `json:"bench_id"`
+	SnapshotID uuid.UUID `json:"snapshot_id,omitempty"`
+}
+
+// MailPayload references the notification or the profile whose address is confirmed to send an email about
+type MailPayload struct {
+	NotificationID uuid.UUID `json:"notification_id,omitempty"`
+	ProfileID      string    `json:"profile_id,omitempty"`
+}
+
+// ScanResult is stored in the result of a finished repository scan
+type ScanResult struct {
+	RepoURL    string                `json:"repo_url"`
+	Candidates []ops.ImportCandidate `json:"modules"`
+	Lint       *lint.Result          `json:"lint,omitempty"` // set if edea.yml has problems
+}
+
+// MergeResult is stored in the result of a finished merge job
+type MergeResult struct {
+	File string `json:"file"` // path of the zip archive in the job cache
+	Name string `json:"name"` // file name for the download
+}
+
+func init() {
+	Register(TypeModuleImport, importModule)
+	OnFailure(TypeModuleImport, abandonImport)
+	Register(TypeModulePull, pullModule)
+	Register(TypeModuleDiff, diffModule)
+	Register(TypeRepoScan, scanRepository)
+	Register(TypeRepoLint, lintRepository)
+	Register(TypeBenchMerge, mergeBench)
+	Register(TypeMail, sendMail)
+
+	ops.QueueEmail = func(ctx context.Context, n *model.Notification) error {
+		_, err := MailNotification(ctx, n)
+		return err
+	}
+}
+
+// ImportModule queues the initial import of a registered module
+func ImportModule(ctx context.Context, userID uuid.UUID, module *model.Module) (*model.Job, error) {
+	return Enqueue(ctx, TypeModuleImport, "module:"+module.ID.String(), userID, ModulePayload{ModuleID: module.ID})
+}
+
+// PullModule queues an update of a module from its repository
+func PullModule(ctx context.Context, userID uuid.UUID, module *model.Module) (*model.Job, error) {
+	return Enqueue(ctx, TypeModulePull, "module:"+module.ID.String(), userID, ModulePayload{ModuleID: module.ID})
+}
+
+// DiffModule queues rendering the visual diff of two module revisions
+func DiffModule(ctx context.Context, userID uuid.UUID, module *model.Module, a, b string) (*model.Job, error) {
+	key := fmt.Sprintf("diff:%s:%s", module.ID, ops.DiffDir(module, a, b))
+	return Enqueue(ctx, TypeModuleDiff, key, userID, DiffPayload{ModuleID: module.ID, A: a, B: b})
+}
+
+// ScanRepository queues listing the sub-modules of a repository so they can be imported
+func ScanRepository(ctx context.Context, userID uuid.UUID, url string) (*model.Job, error) {
+	key := fmt.Sprintf("scan:%s:%s", userID, url)
+	return Enqueue(ctx, TypeRepoScan, key, userID, RepoPayload{RepoURL: url})
+}
+
+// LintRepository queues checking the edea.yml of a repository at a revision
+func LintRepository(ctx context.Context, userID uuid.UUID, url, revision string) (*model.Job, error) {
+	key := fmt.Sprintf("lint:%s:%s@%s", userID, url, revision)
+	return Enqueue(ctx, TypeRepoLint, key, userID, RepoPayload{RepoURL: url, Revision: revision})
+}
+
+// MergeBench queues merging a bench into a new project
+func MergeBench(ctx context.Context, userID uuid.UUID, bench *model.Bench) (*model.Job, error) {
+	key := fmt.Sprintf("merge:%s:%s", bench.ID, userID)
+	return Enqueue(ctx, TypeBenchMerge, key, userID, BenchPayload{BenchID: bench.ID})
+}
+
+// MergeSnapshot queues merging a bench snapshot into a new project
+func MergeSnapshot(ctx context.Context, userID uuid.UUID, snap *model.BenchSnapshot) (*model.Job, error) {
+	key := fmt.Sprintf("merge:%s:%s", snap.ID, userID)
+	return Enqueue(ctx, TypeBenchMerge, key, userID, BenchPayload{BenchID: snap.BenchID, SnapshotID: snap.ID})
+}
+
+// MailNotification queues sending a notification by email, it's a job of the server and not
+// listed for the user
+func MailNotification(ctx context.Context, n *model.Notification) (*model.Job, error) {
+	return Enqueue(ctx, TypeMail, "mail:"+n.ID.String(), uuid.Nil, MailPayload{NotificationID: n.ID})
+}
+
+// ConfirmEmail queues sending a link to confirm the email address of a profile
+func ConfirmEmail(ctx context.Context, p *model.Profile) (*model.Job, error) {
+	return Enqueue(ctx, TypeMail, "mail:"+p.ID, uuid.Nil, MailPayload{ProfileID: p.ID})
+}
+
+func loadModule(ctx context.Context, job *model.Job) (*model.Module, error) {
+	var p ModulePayload
+	if err := Decode(job, &p); err != nil {
+		return nil, err
+	}
+
+	module := new(model.Module)
+	if err := model.DB.WithContext(ctx).First(module, p.ModuleID).Error; err != nil {
+		return nil, err
+	}
+
+	return module, nil
+}
+
+func importModule(ctx context.Context, job *model.Job) error {
+	module, err := loadModule(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	job.ResultURL = fmt.Sprintf("/module/%s", module.ID)
+
+	return ops.ImportModule(ctx, module)
+}
+
+// abandonImport removes a module which could not be imported, so that it can be registered again
+func abandonImport(ctx context.Context, job *model.Job) error {
+	var p ModulePayload
+	if err := Decode(job, &p); err != nil {
+		return err
+	}
+
+	return ops.RemoveUnimportedModule(ctx, p.ModuleID)
+}
+
+func pullModule(ctx context.Context, job *model.Job) error {
+	module, err := loadModule(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	job.ResultURL = fmt.Sprintf("/module/%s", module.ID)
+
+	return ops.RefreshModule(ctx, module)
+}
+
+func diffModule(ctx context.Context, job *model.Job) error {
+	var p DiffPayload
+	if err := Decode(job, &p); err != nil {
+		return err
+	}
+
+	module := new(model.Module)
+	if err := model.DB.WithContext(ctx).First(module, p.ModuleID).Error; err != nil {
+		return err
+	}
+
+	job.ResultURL = fmt.Sprintf("/module/diff/%s?a=%s&b=%s", module.ID, url.QueryEscape(p.A), url.QueryEscape(p.B))
+
+	err := ops.PlotDiff(ctx, module, p.A, p.B)
+	if hint, ok := err.(util.HintError); ok {
+		job.Output = hint.Hint
+	}
+
+	return err
+}
+
+func scanRepository(ctx context.Context, job *model.Job) error {
+	var p RepoPayload
+	if err := Decode(job, &p); err != nil {
+		return err
+	}
+
+	list, err := ops.ScanRepository(ctx, p.RepoURL)
+	if hint, ok := err.(util.HintError); ok {
+		job.Output = hint.Hint
+	}
+	if err != nil {
+		return err
+	}
+
+	res := ScanResult{RepoURL: p.RepoURL, Candidates: list}
+
+	// the scan only needs edea.yml to parse, point out anything else that's wrong with it too
+	if l, err := lint.Repository(p.RepoURL, ""); err == nil && len(l.Problems) > 0 {
+		res.Lint = &l
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	job.Result = datatypes.JSON(b)
+	job.ResultURL = fmt.Sprintf("/module/import/scan/%s", job.ID)
+
+	return nil
+}
+
+func lintRepository(ctx context.Context, job *model.Job) error {
+	var p RepoPayload
+	if err := Decode(job, &p); err != nil {
+		return err
+	}
+
+	res, err := lint.Repository(p.RepoURL, p.Revision)
+	if hint, ok := err.(util.HintError); ok {
+		job.Output = hint.Hint
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	job.Result = datatypes.JSON(b)
+	job.ResultURL = fmt.Sprintf("/module/lint/%s", job.ID)
+
+	return nil
+}
+
+func mergeBench(ctx context.Context, job *model.Job) error {
+	var p BenchPayload
+	if err := Decode(job, &p); err != nil {
+		return err
+	}
+
+	bench := new(model.Bench)
+
+	result := model.DB.WithContext(ctx).Preload("Modules", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Preload("Modules.Module").First(bench, p.BenchID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	name, mods := bench.Name, bench.Modules
+
+	if p.SnapshotID != uuid.Nil {
+		snap := new(model.BenchSnapshot)
+
+		result := model.DB.WithContext(ctx).Preload("Modules", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		}).Preload("Modules.Module").Where("bench_id = ?", bench.ID).First(snap, p.SnapshotID)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		name = fmt.Sprintf("%s-%s", bench.Name, snap.Name)
+		mods = ops.SnapshotModules(snap)
+	}
+
+	b, err := merge.Merge(name, mods)
+	if err != nil {
+		// on errors the tool output is returned so the user can debug the issue
+		job.Output = string(b)
+		return err
+	}
+
+	dir := jobDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("could not create job result dir, check job cache setting: %w", err)
+	}
+
+	file := filepath.Join(dir, fmt.Sprintf("%s.zip", job.ID))
+	if err := os.WriteFile(file, b, 0600); err != nil {
+		return err
+	}
+
+	res, err := json.Marshal(MergeResult{File: file, Name: fmt.Sprintf("%s.zip", name)})
+	if err != nil {
+		return err
+	}
+
+	job.Result = datatypes.JSON(res)
+	job.ResultURL = fmt.Sprintf("/jobs/%s/download", job.ID)
+
+	return nil
+}
+
+// jobDir returns the folder for job results
+func jobDir() string {
+	if config.Cfg.Cache.Job.Base != "" {
+		return config.Cfg.Cache.Job.Base
+	}
+	return filepath.Join(os.TempDir(), "edea-jobs")
+}
+
+// cleanup removes finished jobs and their result files after the retention period
+func cleanup() {
+	var jobs []model.Job
+
+	cutoff := time.Now().Add(-Retention)
+
+	result := model.DB.Where("status in ? and finished_at < ?", []string{model.JobDone, model.JobFailed}, cutoff).Find(&jobs)
+	if result.Error != nil {
+		zap.L().Error("could not query old jobs", zap.Error(result.Error))
+		return
+	}
+
+	for i := range jobs {
+		var res MergeResult
+		if jobs[i].Type == TypeBenchMerge && json.Unmarshal(jobs[i].Result, &res) == nil && res.File != "" {
+			if err := os.Remove(res.File); err != nil && !os.IsNotExist(err) {
+				zap.L().Warn("could not remove job result", zap.Error(err), zap.String("file", res.File))
+			}
+		}
+		if err := model.DB.Delete(&jobs[i]).Error; err != nil {
+			zap.L().Error("could not delete old job", zap.Error(err), zap.Object("job", &jobs[i]))
+		}
+	}
+}
+
+func sendMail(ctx context.Context, job *model.Job) error {
+	var p MailPayload
+	if err := Decode(job, &p); err != nil {
+		return err
+	}
+
+	if p.ProfileID != "" {
+		return ops.EmailConfirmation(ctx, p.ProfileID)
+	}
+	return ops.EmailNotification(ctx, p.NotificationID)
+}
@@ -0,0 +1,463 @@
+// Package lint validates edea.yml files and reports problems with their line numbers.
+package lint
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.com/edea-dev/edea-server/internal/units"
+	"gopkg.in/yaml.v3"
+)
+
+// Severities of a problem, only errors make a file invalid
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Problem is an issue found in an edea.yml
+type Problem struct {
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Key      string `json:"key"` // dotted path of the offending key, e.g. modules.ldo.dir
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", p.Line, p.Column, p.Severity, p.Message)
+}
+
+// Result of validating an edea.yml
+type Result struct {
+	Valid    bool      `json:"valid"`
+	Problems []Problem `json:"problems"`
+}
+
+// Tree answers whether a path exists in the repository, paths are slash separated and relative to the root.
+// A nil Tree skips all checks which need the repository contents.
+type Tree interface {
+	Has(path string) bool
+	IsDir(path string) bool
+}
+
+// FileTree is a Tree made from a list of file paths
+type FileTree map[string]bool // path -> is a directory
+
+// NewFileTree creates a tree from file paths, the parent directories are added automatically
+func NewFileTree(files []string) FileTree {
+	t := make(FileTree)
+	for _, f := range files {
+		t[f] = false
+		for dir := path.Dir(f); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			t[dir] = true
+		}
+	}
+	return t
+}
+
+// Has returns true if the file or directory exists
+func (t FileTree) Has(p string) bool {
+	_, ok := t[p]
+	return ok || p == "."
+}
+
+// IsDir returns true if the path is a directory
+func (t FileTree) IsDir(p string) bool {
+	return t[p] || p == "."
+}
+
+var (
+	projectKeys = []string{"name", "modules"}
+	moduleKeys  = []string{"readme", "dir", "doc", "params", "tags", "dependencies"}
+	depKeys     = []string{"repo", "module", "revision"}
+
+	// yaml.v3 only puts the line into the message of syntax errors
+	lineRe = regexp.MustCompile(`line (\d+)`)
+	// a number followed by something that might be a unit
+	quantityRe = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)\s*[^\d\s.-]+$`)
+)
+
+type validator struct {
+	tree     Tree
+	modules  map[string]bool // sub-module keys, for dependencies in the same repository
+	problems []Problem
+}
+
+func (v *validator) add(n *yaml.Node, severity, key, format string, args ...interface{}) {
+	p := Problem{Key: key, Severity: severity, Message: fmt.Sprintf(format, args...)}
+	if n != nil {
+		p.Line, p.Column = n.Line, n.Column
+	}
+	v.problems = append(v.problems, p)
+}
+
+// Validate checks the contents of an edea.yml. With a tree, the paths are checked against the repository too.
+func Validate(data []byte, tree Tree) Result {
+	v := &validator{tree: tree}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		v.syntaxError(err)
+		return v.result()
+	}
+
+	if len(doc.Content) == 0 {
+		v.add(nil, SeverityError, "", "the file is empty")
+		return v.result()
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		v.add(root, SeverityError, "", "expected a mapping with the keys %s", strings.Join(projectKeys, ", "))
+		return v.result()
+	}
+
+	var modules *yaml.Node
+
+	v.mapping(root, "", projectKeys, func(key string, kn, vn *yaml.Node) {
+		switch key {
+		case "name":
+			if vn.Kind != yaml.ScalarNode {
+				v.add(vn, SeverityError, key, "name has to be a string")
+			}
+		case "modules":
+			modules = vn
+		}
+	})
+
+	if modules == nil {
+		v.add(root, SeverityError, "modules", "no modules defined")
+		return v.result()
+	}
+	if modules.Kind != yaml.MappingNode {
+		v.add(modules, SeverityError, "modules", "modules has to be a mapping of sub-module keys to modules")
+		return v.result()
+	}
+	if len(modules.Content) == 0 {
+		v.add(modules, SeverityError, "modules", "no modules defined")
+	}
+
+	v.modules = make(map[string]bool)
+	for i := 0; i+1 < len(modules.Content); i += 2 {
+		v.modules[modules.Content[i].Value] = true
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(modules.Content); i += 2 {
+		kn := modules.Content[i]
+		if seen[kn.Value] {
+			v.add(kn, SeverityError, join("modules", kn.Value), "duplicate sub-module %q", kn.Value)
+			continue
+		}
+		seen[kn.Value] = true
+
+		v.module(kn, modules.Content[i+1])
+	}
+
+	return v.result()
+}
+
+// mapping calls fn for every key of a mapping node and reports unknown and duplicate keys
+func (v *validator) mapping(n *yaml.Node, prefix string, known []string, fn func(key string, kn, vn *yaml.Node)) {
+	seen := make(map[string]bool)
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		kn, vn := n.Content[i], n.Content[i+1]
+		key := join(prefix, kn.Value)
+
+		if seen[kn.Value] {
+			v.add(kn, SeverityError, key, "duplicate key %q", kn.Value)
+			continue
+		}
+		seen[kn.Value] = true
+
+		if !contains(known, kn.Value) {
+			v.add(kn, SeverityWarning, key, "unknown key %q, expected one of %s", kn.Value, strings.Join(known, ", "))
+			continue
+		}
+
+		fn(kn.Value, kn, vn)
+	}
+}
+
+func (v *validator) module(kn, n *yaml.Node) {
+	prefix := join("modules", kn.Value)
+
+	if kn.Value == "" {
+		v.add(kn, SeverityError, prefix, "sub-module keys must not be empty")
+	}
+	if n.Kind != yaml.MappingNode {
+		v.add(n, SeverityError, prefix, "module %q has to be a mapping with the keys %s", kn.Value, strings.Join(moduleKeys, ", "))
+		return
+	}
+
+	var dir string
+	var dirOK bool
+	var readme, doc *yaml.Node
+
+	v.mapping(n, prefix, moduleKeys, func(key string, _, vn *yaml.Node) {
+		switch key {
+		case "dir":
+			if p, ok := v.path(vn, join(prefix, key)); ok {
+				dir, dirOK = p, true
+				if v.tree == nil {
+					return
+				}
+				// dir can also point to the project file itself
+				if !v.tree.Has(p) {
+					v.add(vn, SeverityError, join(prefix, key), "%q does not exist in the repository", vn.Value)
+					dirOK = false
+				} else if !v.tree.IsDir(p) {
+					dir = path.Dir(p)
+				}
+			}
+		case "readme":
+			readme = vn
+		case "doc":
+			doc = vn
+		case "params":
+			v.params(vn, join(prefix, key))
+		case "tags":
+			v.tags(vn, join(prefix, key))
+		case "dependencies":
+			v.dependencies(vn, kn.Value, join(prefix, key))
+		}
+	})
+
+	if _, ok := find(n, "dir"); !ok {
+		v.add(kn, SeverityError, join(prefix, "dir"), "module %q has no dir", kn.Value)
+	}
+
+	// readme and doc are relative to the module directory, so they can only be looked up if it exists
+	if !dirOK {
+		return
+	}
+	if readme != nil {
+		if p, ok := v.path(readme, join(prefix, "readme")); ok && v.tree != nil && !v.exists(dir, p, "readme.md") {
+			v.add(readme, SeverityError, join(prefix, "readme"), "%q does not exist in the module directory", readme.Value)
+		}
+	}
+	if doc != nil {
+		if p, ok := v.path(doc, join(prefix, "doc")); ok && v.tree != nil && !v.exists(dir, p, "book.toml") {
+			v.add(doc, SeverityError, join(prefix, "doc"), "%q does not exist in the module directory", doc.Value)
+		}
+	}
+}
+
+// path checks that a node is a relative path which stays inside the repository and returns it cleaned
+func (v *validator) path(n *yaml.Node, key string) (string, bool) {
+	if n.Kind != yaml.ScalarNode || n.Tag == "!!null" {
+		v.add(n, SeverityError, key, "expected a path")
+		return "", false
+	}
+	if n.Value == "" {
+		v.add(n, SeverityError, key, "the path must not be empty")
+		return "", false
+	}
+
+	p := strings.ReplaceAll(n.Value, "\\", "/")
+	if path.IsAbs(p) || (len(p) > 1 && p[1] == ':') {
+		v.add(n, SeverityError, key, "%q has to be relative to the repository", n.Value)
+		return "", false
+	}
+
+	p = path.Clean(p)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		v.add(n, SeverityError, key, "%q points outside of the repository", n.Value)
+		return "", false
+	}
+
+	return p, true
+}
+
+// exists looks for a file relative to the module directory, a directory has to contain the default file name
+func (v *validator) exists(dir, p, def string) bool {
+	for _, candidate := range []string{path.Join(dir, p), p} {
+		if !v.tree.Has(candidate) {
+			continue
+		}
+		if !v.tree.IsDir(candidate) {
+			return true
+		}
+		for _, name := range []string{def, strings.ToUpper(def), strings.Title(def)} {
+			if v.tree.Has(path.Join(candidate, name)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// params have to be scalars or lists of scalars so they can be searched
+func (v *validator) params(n *yaml.Node, key string) {
+	if n.Kind != yaml.MappingNode {
+		v.add(n, SeverityError, key, "params has to be a mapping of parameter names to values")
+		return
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		kn, vn := n.Content[i], n.Content[i+1]
+		pkey := join(key, kn.Value)
+
+		switch vn.Kind {
+		case yaml.ScalarNode:
+			if vn.Tag == "!!null" {
+				v.add(vn, SeverityWarning, pkey, "parameter %q has no value", kn.Value)
+			}
+			v.quantity(vn, pkey, kn.Value)
+		case yaml.SequenceNode:
+			unit := ""
+			for _, item := range vn.Content {
+				if item.Kind != yaml.ScalarNode {
+					v.add(item, SeverityError, pkey, "parameter %q can only contain plain values", kn.Value)
+					continue
+				}
+				u := v.quantity(item, pkey, kn.Value)
+				if u != "" && unit != "" && u != unit {
+					v.add(item, SeverityWarning, pkey, "parameter %q mixes %s and %s, its values are compared as text", kn.Value, unit, u)
+				}
+				if unit == "" {
+					unit = u
+				}
+			}
+		default:
+			v.add(vn, SeverityError, pkey, "parameter %q has to be a value or a list of values", kn.Value)
+		}
+	}
+}
+
+// tags have to be a list of words for the search facets
+func (v *validator) tags(n *yaml.Node, key string) {
+	if n.Kind != yaml.SequenceNode {
+		v.add(n, SeverityError, key, "tags has to be a list of words")
+		return
+	}
+
+	for _, item := range n.Content {
+		if item.Kind != yaml.ScalarNode || item.Value == "" {
+			v.add(item, SeverityError, key, "tags can only contain plain words")
+		}
+	}
+}
+
+// quantity returns the unit of a parameter value and warns about values which look like a
+// quantity but can't be compared as one, e.g. because of an unknown unit
+func (v *validator) quantity(n *yaml.Node, key, name string) string {
+	q, err := units.Parse(n.Value)
+	if err == nil {
+		return q.Unit
+	}
+	if quantityRe.MatchString(n.Value) {
+		v.add(n, SeverityWarning, key, "parameter %q has the value %q which is compared as text, known units are %s",
+			name, n.Value, strings.Join(units.Units, ", "))
+	}
+	return ""
+}
+
+// dependencies are a list of sub-module keys in the same repository or mappings referencing another repository
+func (v *validator) dependencies(n *yaml.Node, self, key string) {
+	if n.Kind != yaml.SequenceNode {
+		v.add(n, SeverityError, key, "dependencies has to be a list")
+		return
+	}
+
+	for _, item := range n.Content {
+		var repo, sub *yaml.Node
+
+		switch item.Kind {
+		case yaml.ScalarNode:
+			sub = item
+		case yaml.MappingNode:
+			v.mapping(item, key, depKeys, func(dkey string, _, vn *yaml.Node) {
+				if vn.Kind != yaml.ScalarNode {
+					v.add(vn, SeverityError, join(key, dkey), "%s has to be a string", dkey)
+					return
+				}
+				switch dkey {
+				case "repo":
+					repo = vn
+				case "module":
+					sub = vn
+				}
+			})
+		default:
+			v.add(item, SeverityError, key, "a dependency has to be a sub-module key or a mapping with the keys %s", strings.Join(depKeys, ", "))
+			continue
+		}
+
+		// only dependencies in the same repository can be checked here
+		if repo != nil && repo.Value != "" {
+			continue
+		}
+		if sub == nil || sub.Value == "" {
+			v.add(item, SeverityError, key, "a dependency needs a repo or a module")
+		} else if sub.Value == self {
+			v.add(sub, SeverityError, key, "module %q depends on itself", self)
+		} else if !v.modules[sub.Value] {
+			v.add(sub, SeverityError, key, "module %q does not exist in this edea.yml", sub.Value)
+		}
+	}
+}
+
+func (v *validator) syntaxError(err error) {
+	p := Problem{Severity: SeverityError, Message: err.Error()}
+
+	var te *yaml.TypeError
+	if !errors.As(err, &te) {
+		if m := lineRe.FindStringSubmatch(err.Error()); m != nil {
+			p.Line, _ = strconv.Atoi(m[1])
+		}
+	}
+
+	v.problems = append(v.problems, p)
+}
+
+func (v *validator) result() Result {
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		return v.problems[i].Line < v.problems[j].Line
+	})
+
+	r := Result{Valid: true, Problems: v.problems}
+	if r.Problems == nil {
+		r.Problems = []Problem{}
+	}
+	for _, p := range v.problems {
+		if p.Severity == SeverityError {
+			r.Valid = false
+		}
+	}
+	return r
+}
+
+func find(n *yaml.Node, key string) (*yaml.Node, bool) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1], true
+		}
+	}
+	return nil, false
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
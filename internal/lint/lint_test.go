@@ -0,0 +1,91 @@
+package lint
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tree := NewFileTree([]string{
+		"ldo/ldo.kicad_pro",
+		"ldo/readme.md",
+		"ldo/docs/book.toml",
+		"buck/buck.kicad_pro",
+	})
+
+	tests := []struct {
+		name  string
+		yml   string
+		valid bool
+		lines []int // lines of the expected problems
+	}{
+		{"ok", `
+name: power
+modules:
+  ldo:
+    dir: ldo
+    readme: readme.md
+    doc: docs
+    params:
+      vin: 5V
+      vout: [3.3V, 1.8V]
+    tags: [ldo, power]
+  buck:
+    dir: buck
+`, true, nil},
+		{"syntax error", "modules:\n  ldo:\n    dir: [ldo\n", false, []int{2}},
+		{"empty", "", false, []int{0}},
+		{"no modules", "name: power\n", false, []int{1}},
+		{"unknown keys", "name: x\nauthor: me\nmodules:\n  ldo:\n    dir: ldo\n    pcb: ldo.kicad_pcb\n", true, []int{2, 6}},
+		{"missing dir", "modules:\n  ldo:\n    readme: readme.md\n", false, []int{2}},
+		{"dir does not exist", "modules:\n  ldo:\n    dir: nope\n", false, []int{3}},
+		{"traversal", "modules:\n  ldo:\n    dir: ../../etc\n  buck:\n    dir: /buck\n", false, []int{3, 5}},
+		{"readme does not exist", "modules:\n  buck:\n    dir: buck\n    readme: readme.md\n", false, []int{4}},
+		{"doc without book", "modules:\n  buck:\n    dir: ldo\n    doc: .\n", false, []int{4}},
+		{"nested params", "modules:\n  ldo:\n    dir: ldo\n    params:\n      vin:\n        min: 3\n", false, []int{6}},
+		{"unknown units", "modules:\n  ldo:\n    dir: ldo\n    params:\n      vin: 5VDC\n      diode: 1N4148\n      vout: [3.3V, 500mA]\n", true, []int{5, 7}},
+		{"tags not a list", "modules:\n  ldo:\n    dir: ldo\n    tags: ldo\n", false, []int{4}},
+		{"nested tags", "modules:\n  ldo:\n    dir: ldo\n    tags: [ldo, [power]]\n", false, []int{4}},
+		{"params not a mapping", "modules:\n  ldo:\n    dir: ldo\n    params: [a, b]\n", false, []int{4}},
+		{"dependencies", `
+modules:
+  ldo:
+    dir: ldo
+    dependencies:
+      - buck
+      - repo: https://example.com/other.git
+        revision: v1.0
+      - module: buck
+  buck:
+    dir: buck
+`, true, nil},
+		{"unknown dependency", "modules:\n  ldo:\n    dir: ldo\n    dependencies: [nope, ldo, {revision: v1}]\n", false, []int{4, 4, 4}},
+		{"duplicate module", "modules:\n  ldo:\n    dir: ldo\n  ldo:\n    dir: ldo\n", false, []int{4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Validate([]byte(tt.yml), tree)
+			if r.Valid != tt.valid {
+				t.Errorf("valid = %v, want %v: %v", r.Valid, tt.valid, r.Problems)
+			}
+			if len(r.Problems) != len(tt.lines) {
+				t.Fatalf("got %d problems, want %d: %v", len(r.Problems), len(tt.lines), r.Problems)
+			}
+			for i, p := range r.Problems {
+				if p.Line != tt.lines[i] {
+					t.Errorf("problem %d on line %d, want %d: %s", i, p.Line, tt.lines[i], p)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateWithoutTree(t *testing.T) {
+	// paths can't be checked without the repository, everything else still is
+	r := Validate([]byte("modules:\n  ldo:\n    dir: missing\n    readme: missing.md\n"), nil)
+	if !r.Valid || len(r.Problems) != 0 {
+		t.Errorf("expected no problems, got %v", r.Problems)
+	}
+}
@@ -0,0 +1,59 @@
+package lint
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+)
+
+// Repository validates the edea.yml of a repository at the given revision, HEAD if empty.
+// The repository is added to the cache if it isn't there yet.
+func Repository(url, revision string) (Result, error) {
+	if revision == "" {
+		revision = "HEAD"
+	}
+
+	if err := repo.CheckPublic(url); err != nil {
+		return Result{}, err
+	}
+
+	if err := repo.New(url); err != nil && !errors.Is(err, repo.ErrExists) {
+		return Result{}, util.HintError{
+			Hint: "Could not clone the repository, check that the URL is correct and that it is publicly accessible.",
+			Err:  err,
+		}
+	}
+
+	g := &repo.Git{URL: url}
+	if err := g.Pull(); err != nil {
+		return Result{}, err
+	}
+
+	if _, err := g.ResolveRevision(revision); err != nil {
+		return Result{}, util.HintError{
+			Hint: "The revision \"" + revision + "\" does not exist in the repository.",
+			Err:  err,
+		}
+	}
+
+	b, err := g.FileAt("edea.yml", false, revision)
+	if errors.Is(err, repo.ErrNoFile) {
+		// repositories without an edea.yml are a single module in the top-level directory
+		return Result{Valid: true, Problems: []Problem{{
+			Severity: SeverityWarning,
+			Message:  "the repository does not contain an edea.yml, the top-level directory is used as a single module",
+		}}}, nil
+	} else if err != nil {
+		return Result{}, err
+	}
+
+	files, err := g.FilesAt(revision)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Validate(b, NewFileTree(files)), nil
+}
@@ -0,0 +1,114 @@
+// Package mail sends plain text emails over SMTP, such as the notifications of saved searches.
+package mail
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/edea-dev/edea-server/internal/config"
+)
+
+// ErrDisabled is returned when sending without a configured SMTP server
+var ErrDisabled = errors.New("no mail server configured")
+
+// Enabled returns true if an SMTP server is configured
+func Enabled() bool {
+	return config.Cfg.Mail.Host != ""
+}
+
+// Send delivers a plain text email to a single recipient, it gives up when the context is done
+func Send(ctx context.Context, to, subject, body string) error {
+	cfg := config.Cfg.Mail
+	if cfg.Host == "" {
+		return ErrDisabled
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// smtp doesn't take a context, the deadline bounds the whole conversation instead
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: cfg.Host}); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(cfg.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(Message(cfg.From, to, subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// Message formats an email with the headers, the subject is encoded if it isn't plain ASCII
+func Message(from, to, subject, body string) []byte {
+	var b bytes.Buffer
+
+	// the addresses come from the configuration and validated profiles, line breaks would add headers
+	strip := strings.NewReplacer("\r", "", "\n", "")
+
+	fmt.Fprintf(&b, "From: %s\r\n", strip.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", strip.Replace(to))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strip.Replace(subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+
+	// SMTP wants CRLF line endings
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return b.Bytes()
+}
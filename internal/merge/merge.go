@@ -16,15 +16,14 @@ import (
 
 	"gitlab.com/edea-dev/edea-server/internal/model"
 	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"gitlab.com/edea-dev/edea-server/internal/units"
 	"gitlab.com/edea-dev/edea-server/internal/util"
 	"go.uber.org/zap"
 )
 
-// TODO: we need to finish defining the file format so that we can put multiple
-// modules into a single repository. we should make it possible to use user-defined
-// IDs for sub-modules too and later on allow to reference dependencies.
-//
-// For now we only support the first module out of a project.
+// Modules declare their dependencies in edea.yml, see repo.Dependency. They're stored
+// in the metadata so that they can be offered when adding a module to a bench, Merge
+// itself only merges the modules it is given.
 
 // Merge bench modules together
 func Merge(benchName string, modules []model.BenchModule) ([]byte, error) {
@@ -48,11 +47,26 @@ func Merge(benchName string, modules []model.BenchModule) ([]byte, error) {
 	var moduleSpec []string
 
 	for _, mod := range modules {
-		dir, err := repo.GetModulePath(&mod.Module)
+		g := &repo.Git{URL: mod.Module.RepoURL}
+
+		// modules are pinned to the revision they had when they were added to the bench,
+		// the repository only needs to be fetched if the clone doesn't have it
+		revision := mod.Revision
+		if revision == "" {
+			revision = "HEAD"
+		}
+
+		if _, err := g.ResolveRevision(revision); mod.Revision == "" || err != nil {
+			if err := g.Pull(); err != nil {
+				return nil, fmt.Errorf("could not pull latest changes of %s: %w", mod.Module.RepoURL, err)
+			}
+		}
+
+		modDir, err := repo.ExportModuleAt(&mod.Module, revision, filepath.Join(dir, "modules", mod.ID.String()))
 		if err != nil {
 			return nil, err
 		}
-		moduleSpec = append(moduleSpec, dir)
+		moduleSpec = append(moduleSpec, modDir)
 	}
 
 	argv := []string{"-m", "edea", "--output", projectDir}
@@ -167,7 +181,16 @@ func Metadata(module *model.Module) (map[string]interface{}, error) {
 
 	// read the params from edea.yml too
 	g := &repo.Git{URL: module.RepoURL}
-	m["params"], _ = g.EdeaParams(module.Sub)
+	if params, _ := g.EdeaParams(module.Sub); params != nil {
+		// quantities are stored as numbers in their base unit so they can be compared
+		m["params"], m["units"] = units.NormalizeParams(params)
+	}
+	if deps, _ := g.EdeaDependencies(module.Sub); len(deps) > 0 {
+		m["dependencies"] = deps
+	}
+	if tags, _ := g.EdeaTags(module.Sub); len(tags) > 0 {
+		m["tags"] = tags
+	}
 
 	zap.S().Infof("metadata: %#v", m)
 
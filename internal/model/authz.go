@@ -3,7 +3,12 @@ package model
 // SPDX-License-Identifier: EUPL-1.2
 
 import (
+	"context"
 	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
 // AuthClaims used
@@ -19,3 +24,28 @@ var (
 	// ErrNoSuchSubject is returned on empty sub parameter or if no user with a matching subject exists
 	ErrNoSuchSubject = errors.New("no subject given or subject does not exist")
 )
+
+type contextKey int
+
+const systemKey contextKey = iota
+
+// SystemContext marks changes as done by the server itself, e.g. for webhooks or
+// background tasks where there's no user in the request context
+func SystemContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, systemKey, true)
+}
+
+// authorizeContext checks the user in the query context against the owner of a row
+func authorizeContext(ctx context.Context, userID uuid.UUID) error {
+	if system, ok := ctx.Value(systemKey).(bool); ok && system {
+		zap.L().Debug("information changed by the system", zap.String("owner", userID.String()))
+		return nil
+	}
+
+	c, ok := ctx.(*gin.Context)
+	if !ok {
+		return errors.New("no user in query context")
+	}
+
+	return IsAuthorized(c, userID)
+}
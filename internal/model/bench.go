@@ -5,7 +5,6 @@ package model
 import (
 	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"go.uber.org/zap/zapcore"
 	"gorm.io/gorm"
@@ -14,7 +13,7 @@ import (
 // Bench contains a number of modules with their configuration
 type Bench struct {
 	gorm.Model
-	ID          uuid.UUID     `gorm:"type:uuid;primarykey;default:uuid_generate_v4()" form:"id"`
+	ID          uuid.UUID     `gorm:"type:uuid;primarykey" form:"id"`
 	UserID      uuid.UUID     `gorm:"type:uuid" form:"-"`
 	ShortCode   string        `form:"short_code"`
 	User        User          `form:"-"`
@@ -35,13 +34,22 @@ func (b *Bench) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 
 // BeforeUpdate checks if the current user is allowed to do that
 func (b *Bench) BeforeUpdate(tx *gorm.DB) (err error) {
-	ctx := tx.Statement.Context.(*gin.Context)
-
 	var tb Bench
 	result := tx.First(&tb, b.ID)
 	if result.Error != nil {
 		return err
 	}
 
-	return isAuthorized(ctx, tb.UserID)
+	return authorizeContext(tx.Statement.Context, tb.UserID)
+}
+
+// BeforeDelete checks if the current user is allowed to do that
+func (b *Bench) BeforeDelete(tx *gorm.DB) error {
+	var tb Bench
+	result := tx.First(&tb, b.ID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return authorizeContext(tx.Statement.Context, tb.UserID)
 }
@@ -13,7 +13,7 @@ import (
 
 // BenchModule contains the configuration for a Module as part of a Bench
 type BenchModule struct {
-	ID          uuid.UUID `gorm:"type:uuid;primarykey;default:uuid_generate_v4()"`
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
 	Name        string
 	Description string
 	Conf        datatypes.JSON
@@ -21,6 +21,8 @@ type BenchModule struct {
 	Module      Module
 	BenchID     uuid.UUID `gorm:"type:uuid"`
 	Bench       Bench
+	Position    int    // order of the module on the bench
+	Revision    string // commit hash of the module the bench is pinned to
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
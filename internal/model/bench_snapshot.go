@@ -0,0 +1,81 @@
+package model
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap/zapcore"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ErrImmutable is returned when trying to change a snapshot
+var ErrImmutable = errors.New("snapshots can't be changed")
+
+// BenchSnapshot is a named version of a bench which freezes its modules, their
+// configuration and revisions. Snapshots can't be changed once created.
+type BenchSnapshot struct {
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
+	BenchID     uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_bench_snapshot_name"`
+	Name        string    `gorm:"uniqueIndex:idx_bench_snapshot_name"`
+	Description string
+	Modules     []BenchSnapshotModule `gorm:"foreignKey:SnapshotID"`
+
+	CreatedAt time.Time
+}
+
+// BenchSnapshotModule is the frozen copy of a BenchModule in a snapshot
+type BenchSnapshotModule struct {
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
+	SnapshotID  uuid.UUID `gorm:"type:uuid;index"`
+	ModuleID    uuid.UUID `gorm:"type:uuid"`
+	Module      Module
+	RepoURL     string // copied from the module, snapshots can still be merged after it was deleted
+	Sub         string
+	Name        string
+	Description string
+	Conf        datatypes.JSON
+	Position    int
+	Revision    string // always set, modules which followed HEAD are pinned when the snapshot is taken
+}
+
+// BeforeUpdate prevents changes to snapshots
+func (s *BenchSnapshot) BeforeUpdate(tx *gorm.DB) error {
+	return ErrImmutable
+}
+
+// BeforeUpdate prevents changes to snapshot modules
+func (m *BenchSnapshotModule) BeforeUpdate(tx *gorm.DB) error {
+	return ErrImmutable
+}
+
+// BenchModule returns the module as it was on the bench when the snapshot was taken
+func (m *BenchSnapshotModule) BenchModule() BenchModule {
+	module := m.Module
+	if module.ID == uuid.Nil {
+		// the module was deleted since, the repository is all that's needed to merge it
+		module = Module{ID: m.ModuleID, Name: m.Name, RepoURL: m.RepoURL, Sub: m.Sub}
+	}
+
+	return BenchModule{
+		ID:          m.ID,
+		Name:        m.Name,
+		Description: m.Description,
+		Conf:        m.Conf,
+		ModuleID:    m.ModuleID,
+		Module:      module,
+		Position:    m.Position,
+		Revision:    m.Revision,
+	}
+}
+
+// MarshalLogObject provides the object representation for logging
+func (s *BenchSnapshot) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("snapshot_uuid", s.ID.String())
+	enc.AddString("bench_uuid", s.BenchID.String())
+
+	return nil
+}
@@ -4,7 +4,7 @@ package model
 
 // Category model
 type Category struct {
-	ID          string `gorm:"type:uuid;primarykey;default:uuid_generate_v4()"`
+	ID          string `gorm:"type:uuid;primarykey"`
 	Name        string `gorm:"unique"`
 	Description string
 }
@@ -0,0 +1,134 @@
+package model
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/units"
+	"gorm.io/datatypes"
+)
+
+// Types of category parameters
+const (
+	ParamNumber = "number" // a number, optionally with a unit
+	ParamText   = "text"   // anything else
+)
+
+// ParamTypes lists the valid types of category parameters
+var ParamTypes = []string{ParamNumber, ParamText}
+
+// CategoryParam is a parameter in the schema of a category which the modules in it are validated against
+type CategoryParam struct {
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
+	CategoryID  string    `gorm:"type:uuid;uniqueIndex:idx_category_param"`
+	Category    Category  `json:"-"`
+	Key         string    `gorm:"uniqueIndex:idx_category_param"`
+	Name        string
+	Description string
+	Type        string
+	Unit        string         // unit of numbers, see units.Units
+	Required    bool           // modules have to set it
+	Min         *float64       // lower bound of numbers in their base unit
+	Max         *float64       // upper bound of numbers in their base unit
+	Enum        datatypes.JSON // list of the allowed texts, any text if empty
+	Position    int            // order in the search fields
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// EnumValues returns the allowed texts
+func (p *CategoryParam) EnumValues() []string {
+	var values []string
+	if len(p.Enum) > 0 {
+		_ = json.Unmarshal(p.Enum, &values)
+	}
+	return values
+}
+
+// Check validates a parameter value, or each value of a list, and returns what's wrong with it
+func (p *CategoryParam) Check(value interface{}, unit string) error {
+	if list, ok := value.([]interface{}); ok {
+		for _, v := range list {
+			if err := p.Check(v, unit); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if p.Type == ParamText {
+		enum := p.EnumValues()
+		if len(enum) == 0 {
+			return nil
+		}
+		s := fmt.Sprint(value)
+		for _, e := range enum {
+			if strings.EqualFold(s, e) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s has to be one of %s, not %q", p.Key, strings.Join(enum, ", "), s)
+	}
+
+	n, ok := number(value)
+	if !ok {
+		return fmt.Errorf("%s has to be a number, not %q", p.Key, fmt.Sprint(value))
+	}
+	// plain numbers are taken to be in the unit of the parameter
+	if p.Unit != "" && unit != "" && unit != p.Unit {
+		return fmt.Errorf("%s has to be in %s, not %s", p.Key, p.Unit, unit)
+	}
+	if p.Min != nil && n < *p.Min {
+		return fmt.Errorf("%s has to be at least %s, not %s", p.Key, units.Format(*p.Min, p.Unit), units.Format(n, p.Unit))
+	}
+	if p.Max != nil && n > *p.Max {
+		return fmt.Errorf("%s has to be at most %s, not %s", p.Key, units.Format(*p.Max, p.Unit), units.Format(n, p.Unit))
+	}
+
+	return nil
+}
+
+// number converts the numbers of decoded YAML or JSON to float64
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// CheckParams validates the parameters of a module against the schema of its category
+func CheckParams(schema []CategoryParam, params map[string]interface{}, paramUnits map[string]string) []error {
+	var problems []error
+
+	for i := range schema {
+		p := &schema[i]
+
+		value, ok := params[p.Key]
+		if !ok || value == nil {
+			if p.Required {
+				problems = append(problems, fmt.Errorf("%s is required", p.Key))
+			}
+			continue
+		}
+
+		if err := p.Check(value, paramUnits[p.Key]); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	return problems
+}
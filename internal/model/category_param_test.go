@@ -0,0 +1,46 @@
+package model
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckParams(t *testing.T) {
+	min, max := 3.0, 24.0
+	schema := []CategoryParam{
+		{Key: "v_in", Type: ParamNumber, Unit: "V", Required: true, Min: &min, Max: &max},
+		{Key: "package", Type: ParamText, Enum: []byte(`["SOT-23", "QFN-16"]`)},
+		{Key: "note", Type: ParamText},
+	}
+
+	tests := []struct {
+		name     string
+		params   map[string]interface{}
+		units    map[string]string
+		problems []string
+	}{
+		{"valid", map[string]interface{}{"v_in": 12.0, "package": "sot-23", "note": "x"}, map[string]string{"v_in": "V"}, nil},
+		{"plain number", map[string]interface{}{"v_in": 5}, nil, nil},
+		{"list", map[string]interface{}{"v_in": []interface{}{5.0, 12.0}}, map[string]string{"v_in": "V"}, nil},
+		{"missing", map[string]interface{}{"package": "QFN-16"}, nil, []string{"v_in is required"}},
+		{"range", map[string]interface{}{"v_in": []interface{}{5.0, 30.0}}, map[string]string{"v_in": "V"}, []string{"at most 24V, not 30V"}},
+		{"unit", map[string]interface{}{"v_in": 0.5}, map[string]string{"v_in": "A"}, []string{"in V, not A"}},
+		{"text", map[string]interface{}{"v_in": "high"}, nil, []string{"has to be a number"}},
+		{"enum", map[string]interface{}{"v_in": 5.0, "package": "DIP-8"}, nil, []string{"one of SOT-23, QFN-16"}},
+	}
+
+	for _, tt := range tests {
+		problems := CheckParams(schema, tt.params, tt.units)
+		if len(problems) != len(tt.problems) {
+			t.Errorf("%s: got %v, want %v", tt.name, problems, tt.problems)
+			continue
+		}
+		for i, p := range problems {
+			if !strings.Contains(p.Error(), tt.problems[i]) {
+				t.Errorf("%s: got %q, want it to contain %q", tt.name, p, tt.problems[i])
+			}
+		}
+	}
+}
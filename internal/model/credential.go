@@ -0,0 +1,36 @@
+package model
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of repository credentials
+const (
+	CredentialToken  = "token" // username and access token or password for https
+	CredentialSSHKey = "ssh"   // private deploy key for ssh
+)
+
+// Credential gives access to private repositories, the secret is encrypted at rest
+// and never leaves the server again
+type Credential struct {
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
+	UserID      uuid.UUID `gorm:"type:uuid;index"`
+	User        User      `json:"-" yaml:"-"`
+	Name        string
+	Kind        string
+	Username    string
+	Secret      []byte `json:"-" yaml:"-"` // see the secret package
+	Fingerprint string // of the public key for ssh keys, so users can tell them apart
+	LastUsedAt  sql.NullTime
+	CreatedAt   time.Time
+}
+
+// ValidCredentialKind returns true for known credential kinds
+func ValidCredentialKind(kind string) bool {
+	return kind == CredentialToken || kind == CredentialSSHKey
+}
@@ -0,0 +1,61 @@
+package model
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"reflect"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// SQLite reports whether the database is SQLite rather than PostgreSQL
+func SQLite(tx *gorm.DB) bool {
+	return tx.Dialector.Name() == "sqlite"
+}
+
+// RegisterCallbacks sets up what all our models need independent of the database,
+// it has to be called once after opening it
+func RegisterCallbacks(db *gorm.DB) error {
+	return db.Callback().Create().Before("gorm:create").Register("edea:assign_ids", assignIDs)
+}
+
+// assignIDs generates the uuid primary keys of new rows, so the database doesn't need uuid-ossp
+func assignIDs(tx *gorm.DB) {
+	if tx.Statement.Schema == nil {
+		return
+	}
+
+	rv := tx.Statement.ReflectValue
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			assignID(tx, reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		assignID(tx, rv)
+	}
+}
+
+func assignID(tx *gorm.DB, rv reflect.Value) {
+	for _, field := range tx.Statement.Schema.PrimaryFields {
+		if _, zero := field.ValueOf(tx.Statement.Context, rv); !zero {
+			continue
+		}
+
+		var err error
+
+		switch {
+		case field.FieldType == reflect.TypeOf(uuid.UUID{}):
+			err = field.Set(tx.Statement.Context, rv, uuid.New())
+		case field.FieldType.Kind() == reflect.String && field.DataType == schema.DataType("uuid"):
+			err = field.Set(tx.Statement.Context, rv, uuid.NewString())
+		}
+
+		if err != nil {
+			_ = tx.AddError(err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package model
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap/zapcore"
+	"gorm.io/datatypes"
+)
+
+// Job states
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is a unit of work for the background workers
+type Job struct {
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
+	UserID      uuid.UUID `gorm:"type:uuid;index"` // user who queued the job, uuid.Nil for anonymous or system jobs
+	Type        string    `gorm:"index"`
+	Key         string    `gorm:"index"` // deduplication key, only one pending job per key
+	Payload     datatypes.JSON
+	Status      string `gorm:"index"`
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time `gorm:"index"` // earliest time the job should (re-)run
+	LockedAt    sql.NullTime
+	FinishedAt  sql.NullTime
+	Error       string
+	Output      string         // tool output to help users debug failed jobs
+	Result      datatypes.JSON // job type specific result data
+	ResultURL   string         // where to find the result once the job is done
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Pending returns true if the job is still waiting or running
+func (j *Job) Pending() bool {
+	return j.Status == JobQueued || j.Status == JobRunning
+}
+
+// MarshalLogObject provides the object representation for logging
+func (j *Job) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("job_uuid", j.ID.String())
+	enc.AddString("job_type", j.Type)
+	enc.AddInt("job_attempts", j.Attempts)
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package model
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ErrSchemaAhead is returned if the database has migrations applied which this binary doesn't know about,
+// most likely because a newer version of edea-server ran against it
+var ErrSchemaAhead = errors.New("the database schema is newer than this version of edea-server")
+
+// ErrIrreversible is returned when rolling back a migration without a down step
+var ErrIrreversible = errors.New("migration can't be rolled back")
+
+// migrationLock is the postgres advisory lock which keeps two instances from migrating at the same time
+const migrationLock = 0xedea
+
+// Migration is a single, ordered change of the database schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // nil if it can't be rolled back
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	Version   int `gorm:"primarykey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// MigrationState tells whether a migration has been applied, Unknown ones are
+// applied but not part of this binary
+type MigrationState struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Unknown   bool
+}
+
+// LatestVersion is the schema version this binary expects
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrations returns the state of every known and applied migration, ordered by version
+func Migrations(ctx context.Context) ([]MigrationState, error) {
+	applied, err := appliedMigrations(DB.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+
+	for _, m := range migrations {
+		s := MigrationState{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			s.Applied, s.AppliedAt = true, a.AppliedAt
+			delete(applied, m.Version)
+		}
+		states = append(states, s)
+	}
+
+	for _, a := range applied {
+		states = append(states, MigrationState{Version: a.Version, Name: a.Name, Applied: true, AppliedAt: a.AppliedAt, Unknown: true})
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+
+	return states, nil
+}
+
+// CheckSchema returns ErrSchemaAhead if migrations were applied which this binary doesn't know
+func CheckSchema(ctx context.Context) error {
+	applied, err := appliedMigrations(DB.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	return checkApplied(applied)
+}
+
+// MigrateUp applies all pending migrations up to and including target, zero means all of them.
+// Everything runs in a single transaction so a failing migration leaves the schema as it was.
+func MigrateUp(ctx context.Context, target int) ([]Migration, error) {
+	if target == 0 {
+		target = LatestVersion()
+	}
+
+	var done []Migration
+
+	err := DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		applied, err := lockMigrations(tx)
+		if err != nil {
+			return err
+		}
+		if err := checkApplied(applied); err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if m.Version > target {
+				break
+			}
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+
+			zap.L().Info("applying migration", zap.Int("version", m.Version), zap.String("name", m.Name))
+
+			if err := m.Up(tx); err != nil {
+				return fmt.Errorf("migration %d %s failed: %w", m.Version, m.Name, err)
+			}
+			if err := tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error; err != nil {
+				return err
+			}
+
+			done = append(done, m)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return done, nil
+}
+
+// MigrateDown rolls back all applied migrations newer than target, newest first
+func MigrateDown(ctx context.Context, target int) ([]Migration, error) {
+	var done []Migration
+
+	err := DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		applied, err := lockMigrations(tx)
+		if err != nil {
+			return err
+		}
+		if err := checkApplied(applied); err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if m.Version <= target {
+				break
+			}
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == nil {
+				return fmt.Errorf("%d %s: %w", m.Version, m.Name, ErrIrreversible)
+			}
+
+			zap.L().Info("rolling back migration", zap.Int("version", m.Version), zap.String("name", m.Name))
+
+			if err := m.Down(tx); err != nil {
+				return fmt.Errorf("rolling back migration %d %s failed: %w", m.Version, m.Name, err)
+			}
+			if err := tx.Delete(&SchemaMigration{Version: m.Version}).Error; err != nil {
+				return err
+			}
+
+			done = append(done, m)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return done, nil
+}
+
+// lockMigrations waits until no one else migrates the database and returns the applied migrations,
+// the lock is released with the transaction
+func lockMigrations(tx *gorm.DB) (map[int]SchemaMigration, error) {
+	// sqlite transactions lock the whole database anyway
+	if !SQLite(tx) {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLock).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	return appliedMigrations(tx)
+}
+
+func appliedMigrations(tx *gorm.DB) (map[int]SchemaMigration, error) {
+	applied := make(map[int]SchemaMigration)
+
+	if !tx.Migrator().HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+
+	var rows []SchemaMigration
+	if err := tx.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+
+	return applied, nil
+}
+
+func checkApplied(applied map[int]SchemaMigration) error {
+	latest := LatestVersion()
+
+	for v := range applied {
+		if v > latest {
+			return fmt.Errorf("%w: database has migration %d applied, this binary only knows up to %d", ErrSchemaAhead, v, latest)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package model
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMigrationsOrdered(t *testing.T) {
+	names := make(map[string]bool)
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %q has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if m.Name == "" || names[m.Name] {
+			t.Errorf("migration %d needs a unique name, got %q", m.Version, m.Name)
+		}
+		if m.Up == nil {
+			t.Errorf("migration %d has no up step", m.Version)
+		}
+		names[m.Name] = true
+	}
+}
+
+func TestCheckApplied(t *testing.T) {
+	latest := LatestVersion()
+
+	if err := checkApplied(map[int]SchemaMigration{latest: {Version: latest}}); err != nil {
+		t.Errorf("current schema: %v", err)
+	}
+
+	err := checkApplied(map[int]SchemaMigration{latest + 1: {Version: latest + 1}})
+	if !errors.Is(err, ErrSchemaAhead) {
+		t.Errorf("newer schema: got %v, want ErrSchemaAhead", err)
+	}
+}
+
+func openSQLite(t *testing.T) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "edea.db")+"?_pragma=foreign_keys(1)"),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterCallbacks(db); err != nil {
+		t.Fatal(err)
+	}
+
+	old := DB
+	DB = db
+	t.Cleanup(func() { DB = old })
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	openSQLite(t)
+	ctx := SystemContext(context.Background())
+
+	if _, err := MigrateUp(ctx, 3); err != nil {
+		t.Fatalf("migrating up: %v", err)
+	}
+
+	// ids are generated without the database's help
+	u := &User{Handle: "alice", AuthUUID: "alice"}
+	if err := DB.Create(u).Error; err != nil {
+		t.Fatal(err)
+	}
+	if u.ID == uuid.Nil {
+		t.Fatal("user has no id")
+	}
+
+	var category Category
+	if err := DB.Where("name = ?", "Power").First(&category).Error; err != nil {
+		t.Fatalf("default categories: %v", err)
+	}
+	if _, err := uuid.Parse(category.ID); err != nil {
+		t.Errorf("category id %q: %v", category.ID, err)
+	}
+
+	m := &Module{UserID: u.ID, Name: "LDO", RepoURL: "https://example.com/ldo", CategoryID: category.ID,
+		Metadata: datatypes.JSONMap{"params": map[string]interface{}{"v_out_typ": "3.3V", "i_out": []interface{}{"100mA", "1A"}, "package": "SOT-23"}}}
+	if err := DB.Omit("RepoKey").Create(m).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// search entries used to keep the category in their tags
+	err := DB.Table("search_entries").Create(map[string]interface{}{"id": m.ID.String(), "type": "module", "name": "LDO",
+		"tags": datatypes.JSON(`{"category": "Power"}`)}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// snapshots used to read the repository from the module
+	bench, snap, sm := uuid.New(), uuid.New(), uuid.New()
+	rows := []struct {
+		table string
+		row   map[string]interface{}
+	}{
+		{"benches", map[string]interface{}{"id": bench, "user_id": u.ID, "name": "bench"}},
+		{"bench_snapshots", map[string]interface{}{"id": snap, "bench_id": bench, "name": "v1"}},
+		{"bench_snapshot_modules", map[string]interface{}{"id": sm, "snapshot_id": snap, "module_id": m.ID, "name": "LDO", "revision": "abc"}},
+	}
+	for _, r := range rows {
+		if err := DB.Table(r.table).Create(r.row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// parameters with units are stored as numbers
+	if _, err := MigrateUp(ctx, 0); err != nil {
+		t.Fatalf("migrating up: %v", err)
+	}
+	if err := DB.First(m, m.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]interface{}{"v_out_typ": 3.3, "i_out": []interface{}{0.1, 1.0}, "package": "SOT-23"}
+	if !reflect.DeepEqual(m.Metadata["params"], params) {
+		t.Errorf("params: got %v, want %v", m.Metadata["params"], params)
+	}
+	if !reflect.DeepEqual(m.Metadata["units"], map[string]interface{}{"v_out_typ": "V", "i_out": "A"}) {
+		t.Errorf("units: got %v", m.Metadata["units"])
+	}
+
+	if m.RepoKey != "example.com/ldo" {
+		t.Errorf("repo key: got %q", m.RepoKey)
+	}
+
+	var snapMod BenchSnapshotModule
+	if err := DB.First(&snapMod, sm).Error; err != nil {
+		t.Fatal(err)
+	}
+	if snapMod.RepoURL != m.RepoURL || snapMod.Sub != m.Sub {
+		t.Errorf("snapshot module: got repository %q and sub %q", snapMod.RepoURL, snapMod.Sub)
+	}
+
+	if !DB.Migrator().HasTable(&SavedSearch{}) || !DB.Migrator().HasColumn(&Profile{}, "email") {
+		t.Error("saved searches are missing after migrating up")
+	}
+
+	var entry SearchEntry
+	if err := DB.First(&entry, "id = ?", m.ID.String()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if entry.Category != "Power" || entry.Tags != nil {
+		t.Errorf("search entry: got category %q and tags %s", entry.Category, entry.Tags)
+	}
+
+	if _, err := MigrateDown(ctx, 3); err != nil {
+		t.Fatalf("migrating down to 3: %v", err)
+	}
+	if err := DB.First(m, m.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	params = map[string]interface{}{"v_out_typ": "3.3V", "i_out": []interface{}{"100mA", "1A"}, "package": "SOT-23"}
+	if !reflect.DeepEqual(m.Metadata["params"], params) || m.Metadata["units"] != nil {
+		t.Errorf("got %v after migrating down", m.Metadata)
+	}
+	if DB.Migrator().HasColumn(&Module{}, "repo_key") {
+		t.Error("modules still have a repo key after migrating down")
+	}
+	if DB.Migrator().HasColumn(&BenchSnapshotModule{}, "repo_url") {
+		t.Error("snapshot modules still have a repository after migrating down")
+	}
+	if DB.Migrator().HasColumn(&SearchEntry{}, "category") {
+		t.Error("search entries still have a category after migrating down")
+	}
+	if DB.Migrator().HasTable(&SavedSearch{}) || DB.Migrator().HasTable(&Notification{}) {
+		t.Error("saved searches still exist after migrating down")
+	}
+	var tags string
+	if err := DB.Table("search_entries").Select("tags").Where("id = ?", m.ID.String()).Scan(&tags).Error; err != nil || tags != `{"category":"Power"}` {
+		t.Errorf("search entry tags after migrating down: %s, %v", tags, err)
+	}
+
+	if _, err := MigrateDown(ctx, 0); err != nil {
+		t.Fatalf("migrating down: %v", err)
+	}
+	if DB.Migrator().HasTable(&Module{}) {
+		t.Error("modules table still exists after migrating down")
+	}
+}
+
+// the initial schema is frozen, every column the models have since needs a migration
+func TestMigrationsCoverModels(t *testing.T) {
+	openSQLite(t)
+
+	if _, err := MigrateUp(SystemContext(context.Background()), 0); err != nil {
+		t.Fatalf("migrating up: %v", err)
+	}
+
+	models := []interface{}{
+		&User{}, &Profile{}, &Module{}, &Repository{}, &BenchModule{}, &Category{}, &Bench{}, &Filter{},
+		&Token{}, &Credential{}, &Job{}, &BenchSnapshot{}, &BenchSnapshotModule{}, &SearchEntry{},
+		&CategoryParam{}, &SavedSearch{}, &SavedSearchMatch{}, &Notification{},
+	}
+	for _, m := range models {
+		stmt := &gorm.Statement{DB: DB}
+		if err := stmt.Parse(m); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range stmt.Schema.DBNames {
+			if !DB.Migrator().HasColumn(m, name) {
+				t.Errorf("%s.%s has no migration", stmt.Schema.Table, name)
+			}
+		}
+	}
+}
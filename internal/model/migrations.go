@@ -0,0 +1,371 @@
+package model
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/units"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migrations of the database schema, append new ones with the next version and never change
+// one which has been released. Migration 1 creates the tables from frozen copies of the models,
+// so every later change of the models needs a migration of its own.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(tables...)
+		},
+		Down: func(tx *gorm.DB) error {
+			// sqlite checks the foreign keys while dropping, everything is gone at the commit
+			if SQLite(tx) {
+				if err := tx.Exec("PRAGMA defer_foreign_keys = ON").Error; err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropTable(tables...)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "default_categories_and_filters",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(defaultCategories()).Error; err != nil {
+				return err
+			}
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(defaultFilters()).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			var names, keys []string
+			for _, c := range *defaultCategories() {
+				names = append(names, c.Name)
+			}
+			for _, f := range *defaultFilters() {
+				keys = append(keys, f.Key)
+			}
+
+			if err := tx.Unscoped().Where("key IN ?", keys).Delete(&Filter{}).Error; err != nil {
+				return err
+			}
+			// categories which are in use stay
+			return tx.Where("name IN ? AND NOT EXISTS (SELECT 1 FROM modules WHERE modules.category_id = categories.id)", names).
+				Delete(&Category{}).Error
+		},
+	},
+	{
+		Version: 3,
+		Name:    "search_entries",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&SearchEntry{}); err != nil {
+				return err
+			}
+			if SQLite(tx) {
+				return nil
+			}
+
+			// names weigh more than authors and authors more than descriptions, the simple
+			// configuration doesn't stem, part numbers and such are better left alone
+			err := tx.Exec(`ALTER TABLE search_entries ADD COLUMN IF NOT EXISTS document tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+				setweight(to_tsvector('simple', coalesce(author, '')), 'B') ||
+				setweight(to_tsvector('simple', coalesce(description, '')), 'C')) STORED`).Error
+			if err != nil {
+				return err
+			}
+			return tx.Exec("CREATE INDEX IF NOT EXISTS idx_search_entries_document ON search_entries USING GIN (document)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&SearchEntry{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "param_units",
+		Up: func(tx *gorm.DB) error {
+			return updateParams(tx, func(params map[string]interface{}, paramUnits map[string]string) {
+				normalized, found := units.NormalizeParams(params)
+				for key, value := range normalized {
+					params[key] = value
+				}
+				for key, unit := range found {
+					paramUnits[key] = unit
+				}
+			})
+		},
+		Down: func(tx *gorm.DB) error {
+			return updateParams(tx, func(params map[string]interface{}, paramUnits map[string]string) {
+				for key, unit := range paramUnits {
+					params[key] = formatParam(params[key], unit)
+					delete(paramUnits, key)
+				}
+			})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "category_params",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&CategoryParam{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&CategoryParam{})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "search_facets",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&SearchEntry{}); err != nil {
+				return err
+			}
+
+			// the category was the only tag, tags are a list now
+			return updateSearchTags(tx, func(category string, tags map[string]interface{}) (string, interface{}) {
+				if c, ok := tags["category"].(string); ok {
+					category = c
+				}
+				return category, nil
+			})
+		},
+		Down: func(tx *gorm.DB) error {
+			err := updateSearchTags(tx, func(category string, _ map[string]interface{}) (string, interface{}) {
+				return category, map[string]string{"category": category}
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, column := range []string{"category", "popularity"} {
+				if tx.Migrator().HasColumn(&SearchEntry{}, column) {
+					if err := tx.Migrator().DropColumn(&SearchEntry{}, column); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 7,
+		Name:    "saved_searches",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(&v7Profile{}, "email") {
+				if err := tx.Migrator().AddColumn(&v7Profile{}, "Email"); err != nil {
+					return err
+				}
+			}
+			return tx.AutoMigrate(&SavedSearch{}, &SavedSearchMatch{}, &Notification{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&Notification{}, &SavedSearchMatch{}, &SavedSearch{}); err != nil {
+				return err
+			}
+			if tx.Migrator().HasColumn(&v7Profile{}, "email") {
+				return tx.Migrator().DropColumn(&v7Profile{}, "email")
+			}
+			return nil
+		},
+	},
+	{
+		Version: 8,
+		Name:    "module_repo_keys",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&v8Module{}, "RepoKey"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().CreateIndex(&v8Module{}, "RepoKey"); err != nil {
+				return err
+			}
+
+			var modules []v8Module
+			if err := tx.Select("id", "repo_url").Find(&modules).Error; err != nil {
+				return err
+			}
+			for _, m := range modules {
+				if err := tx.Model(&v8Module{}).Where("id = ?", m.ID).UpdateColumn("repo_key", NormalizeRepoURL(m.RepoURL)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&v8Module{}, "RepoKey"); err != nil {
+				return err
+			}
+			// the sqlite migrator copies the table to drop a column, which breaks the references to modules
+			if SQLite(tx) {
+				return tx.Exec("ALTER TABLE modules DROP COLUMN repo_key").Error
+			}
+			return tx.Migrator().DropColumn(&v8Module{}, "repo_key")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "email_confirmation",
+		Up: func(tx *gorm.DB) error {
+			for _, field := range []string{"EmailConfirmedAt", "EmailToken"} {
+				if err := tx.Migrator().AddColumn(&v9Profile{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"email_confirmed_at", "email_token"} {
+				if err := tx.Migrator().DropColumn(&v9Profile{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 10,
+		Name:    "snapshot_module_repos",
+		Up: func(tx *gorm.DB) error {
+			for _, field := range []string{"RepoURL", "Sub"} {
+				if err := tx.Migrator().AddColumn(&v10SnapshotModule{}, field); err != nil {
+					return err
+				}
+			}
+			// modules of existing snapshots which were deleted already stay without a repository
+			return tx.Exec(`UPDATE bench_snapshot_modules SET
+				repo_url = (SELECT repo_url FROM modules WHERE modules.id = bench_snapshot_modules.module_id),
+				sub = (SELECT sub FROM modules WHERE modules.id = bench_snapshot_modules.module_id)
+				WHERE module_id IN (SELECT id FROM modules)`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"repo_url", "sub"} {
+				if err := tx.Migrator().DropColumn(&v10SnapshotModule{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// v7Profile has the columns of the profiles which migration 7 adds
+type v7Profile struct {
+	Email string
+}
+
+// v8Module has the columns of the modules which migration 8 needs
+type v8Module struct {
+	ID      uuid.UUID `gorm:"type:uuid;primarykey"`
+	RepoURL string
+	RepoKey string `gorm:"index"`
+}
+
+// v9Profile has the columns of the profiles which migration 9 adds
+type v9Profile struct {
+	EmailConfirmedAt sql.NullTime
+	EmailToken       string
+}
+
+// v10SnapshotModule has the columns of the snapshot modules which migration 10 adds
+type v10SnapshotModule struct {
+	RepoURL string
+	Sub     string
+}
+
+func (v7Profile) TableName() string         { return "profiles" }
+func (v8Module) TableName() string          { return "modules" }
+func (v9Profile) TableName() string         { return "profiles" }
+func (v10SnapshotModule) TableName() string { return "bench_snapshot_modules" }
+
+// updateParams rewrites the parameters and their units in the metadata of every module
+func updateParams(tx *gorm.DB, update func(params map[string]interface{}, paramUnits map[string]string)) error {
+	var modules []Module
+	if err := tx.Select("id", "metadata").Where("metadata IS NOT NULL").Find(&modules).Error; err != nil {
+		return err
+	}
+
+	for _, m := range modules {
+		params, _ := m.Metadata["params"].(map[string]interface{})
+		if params == nil {
+			continue
+		}
+
+		paramUnits := make(map[string]string)
+		if u, ok := m.Metadata["units"].(map[string]interface{}); ok {
+			for key, unit := range u {
+				paramUnits[key], _ = unit.(string)
+			}
+		}
+
+		update(params, paramUnits)
+
+		if len(paramUnits) > 0 {
+			m.Metadata["units"] = paramUnits
+		} else {
+			delete(m.Metadata, "units")
+		}
+
+		// the metadata isn't the user's change, so neither the hooks nor updated_at apply
+		err := tx.Session(&gorm.Session{SkipHooks: true}).Model(&Module{ID: m.ID}).UpdateColumn("metadata", m.Metadata).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateSearchTags rewrites the category and tags of every search entry, tags is nil unless they
+// are an object. The index is rebuilt by the reindex command, this only keeps it usable until then.
+func updateSearchTags(tx *gorm.DB, update func(category string, tags map[string]interface{}) (string, interface{})) error {
+	var rows []struct {
+		ID       string
+		Category string
+		Tags     datatypes.JSON
+	}
+	if err := tx.Table("search_entries").Select("id", "category", "tags").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		var tags map[string]interface{}
+		_ = json.Unmarshal(r.Tags, &tags)
+
+		category, newTags := update(r.Category, tags)
+
+		var b []byte
+		if newTags != nil {
+			var err error
+			if b, err = json.Marshal(newTags); err != nil {
+				return err
+			}
+		}
+
+		err := tx.Table("search_entries").Where("id = ?", r.ID).
+			UpdateColumns(map[string]interface{}{"category": category, "tags": datatypes.JSON(b)}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// formatParam turns a normalized value or list of values back into text with its unit
+func formatParam(value interface{}, unit string) interface{} {
+	switch v := value.(type) {
+	case float64:
+		return units.Format(v, unit)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = formatParam(item, unit)
+		}
+		return values
+	}
+	return value
+}
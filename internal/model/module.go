@@ -4,10 +4,10 @@ package model
 
 import (
 	"database/sql"
-	"errors"
+	"net/url"
+	"strings"
 	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
@@ -15,12 +15,13 @@ import (
 
 // Module model
 type Module struct {
-	ID          uuid.UUID `gorm:"type:uuid;primarykey;default:uuid_generate_v4()"`
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
 	UserID      uuid.UUID `gorm:"type:uuid"`
 	ShortCode   string    `form:"short_code"`
 	User        User
 	Private     bool   `gorm:"default:false" form:"private"`
 	RepoURL     string `gorm:"uniqueIndex:idx_repo_sub" form:"repourl,required"`
+	RepoKey     string `gorm:"index" form:"-"` // normalized RepoURL, see NormalizeRepoURL
 	Name        string `form:"name,required"`
 	Sub         string `gorm:"uniqueIndex:idx_repo_sub" form:"sub"`
 	Description string `form:"description"`
@@ -28,23 +29,76 @@ type Module struct {
 	Category    Category
 	Metadata    datatypes.JSONMap
 
+	CredentialID *uuid.UUID `gorm:"type:uuid" form:"-"` // credentials to access a private repository
+
+	RefreshedAt    sql.NullTime // last successful pull of the repository
+	RefreshError   string       // error of the last pull, empty if it succeeded
+	RefreshErrorAt sql.NullTime
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt sql.NullTime `gorm:"index"`
 }
 
+// BeforeSave keeps the normalized repository url up to date
+func (m *Module) BeforeSave(tx *gorm.DB) error {
+	if m.RepoURL != "" {
+		m.RepoKey = NormalizeRepoURL(m.RepoURL)
+	}
+	return nil
+}
+
 // BeforeUpdate checks if the current user is allowed to do that
 func (m *Module) BeforeUpdate(tx *gorm.DB) (err error) {
-	ctx, ok := tx.Statement.Context.(*gin.Context)
-	if !ok {
-		return errors.New("no user in query context")
+	var tm Module
+	result := tx.First(&tm, m.ID)
+	if result.Error != nil {
+		return err
 	}
 
+	return authorizeContext(tx.Statement.Context, tm.UserID)
+}
+
+// BeforeDelete checks if the current user is allowed to do that
+func (m *Module) BeforeDelete(tx *gorm.DB) (err error) {
 	var tm Module
 	result := tx.First(&tm, m.ID)
 	if result.Error != nil {
-		return err
+		return result.Error
 	}
 
-	return isAuthorized(ctx, tm.UserID)
+	return authorizeContext(tx.Statement.Context, tm.UserID)
+}
+
+// ModulesVisibleTo limits a query to public modules and the private modules of the given user, if any
+func ModulesVisibleTo(u *User) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if u == nil {
+			return db.Where("private = false")
+		}
+		return db.Where("(private = false or user_id = ?)", u.ID)
+	}
+}
+
+// NormalizeRepoURL reduces a repository url to host and path so that the different
+// forms (https, ssh, with or without .git) compare equal
+func NormalizeRepoURL(s string) string {
+	s = strings.TrimSpace(s)
+
+	// scp-like ssh urls, e.g. git@github.com:owner/repo.git
+	if !strings.Contains(s, "://") {
+		if i := strings.Index(s, ":"); i > 0 {
+			s = "ssh://" + strings.Replace(s, ":", "/", 1)
+		}
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(s)
+	}
+
+	path := strings.Trim(u.Path, "/")
+	path = strings.TrimSuffix(path, ".git")
+
+	return strings.ToLower(u.Hostname()) + "/" + strings.ToLower(path)
 }
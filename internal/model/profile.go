@@ -6,20 +6,23 @@ import (
 	"database/sql"
 	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 // Profile data for Users
 type Profile struct {
-	ID          string    `gorm:"type:uuid;primarykey;default:uuid_generate_v4()" form:"id" binding:"required,uuid"`
+	ID          string    `gorm:"type:uuid;primarykey" form:"id" binding:"required,uuid"`
 	UserID      uuid.UUID `gorm:"type:uuid"`
 	User        User
 	DisplayName string `form:"display_name" binding:"required"`
 	Location    string `form:"location"`
 	Biography   string `form:"biography"`
 	Avatar      string `form:"avatar"`
+	Email       string `form:"email" binding:"omitempty,email"` // where notifications are sent to, none if empty
+
+	EmailConfirmedAt sql.NullTime `form:"-"`                   // notifications are only sent to confirmed addresses
+	EmailToken       string       `form:"-" json:"-" yaml:"-"` // hash of the token in the confirmation link
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -28,7 +31,5 @@ type Profile struct {
 
 // BeforeUpdate checks if the current user is allowed to do that
 func (p *Profile) BeforeUpdate(tx *gorm.DB) (err error) {
-	ctx := tx.Statement.Context.(*gin.Context)
-
-	return isAuthorized(ctx, p.UserID)
+	return authorizeContext(tx.Statement.Context, p.UserID)
 }
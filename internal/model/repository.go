@@ -3,6 +3,7 @@ package model
 // SPDX-License-Identifier: EUPL-1.2
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,10 +11,12 @@ import (
 
 // Repository model for the repo cache
 type Repository struct {
-	ID        uuid.UUID `gorm:"type:uuid;primarykey;default:uuid_generate_v4()"`
-	URL       string    // fetch/clone URL
-	Type      string    // VCS type (e.g. git)
-	Location  string    // filesystem path
-	UpdatedAt time.Time // time of last fetch
-	CreatedAt time.Time // entry added
+	ID        uuid.UUID    `gorm:"type:uuid;primarykey"`
+	URL       string       // fetch/clone URL
+	Type      string       // VCS type (e.g. git)
+	Location  string       // filesystem path
+	Size      int64        // bytes used on disk by the checkout
+	UsedAt    sql.NullTime `gorm:"index"` // last time it was read, the least recently used ones are evicted first
+	UpdatedAt time.Time    // time of last fetch
+	CreatedAt time.Time    // entry added
 }
@@ -0,0 +1,57 @@
+package model
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Kinds of saved searches
+const (
+	SavedSearchText   = "text"   // full text search of /search
+	SavedSearchParams = "params" // parametric search of /module/search
+)
+
+// SavedSearch is a search of a user who wants to be notified when a module starts matching it
+type SavedSearch struct {
+	ID         uuid.UUID `gorm:"type:uuid;primarykey"`
+	UserID     uuid.UUID `gorm:"type:uuid;index"`
+	User       User      `json:"-" yaml:"-"`
+	Name       string
+	Kind       string
+	Text       string         // words of a full text search or the query of a parametric search
+	Filters    datatypes.JSON // facet values of a full text search
+	Params     datatypes.JSON // parameter comparisons of a parametric search
+	CategoryID string         // category of a parametric search, any if empty
+	Email      bool           // also send the notifications by email
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// SavedSearchMatch records that a module matches a saved search, so only new matches are notified
+type SavedSearchMatch struct {
+	SavedSearchID uuid.UUID `gorm:"type:uuid;primarykey"`
+	ModuleID      uuid.UUID `gorm:"type:uuid;primarykey;index"`
+	CreatedAt     time.Time
+}
+
+// Notification is a message shown to a user in the app
+type Notification struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primarykey"`
+	UserID        uuid.UUID  `gorm:"type:uuid;index"`
+	User          User       `json:"-" yaml:"-"`
+	SavedSearchID *uuid.UUID `gorm:"type:uuid"` // saved search which a module started matching
+	ModuleID      *uuid.UUID `gorm:"type:uuid"`
+	Message       string
+	ReadAt        sql.NullTime
+	CreatedAt     time.Time
+}
+
+// ValidSavedSearchKind returns true for known kinds of saved searches
+func ValidSavedSearchKind(kind string) bool {
+	return kind == SavedSearchText || kind == SavedSearchParams
+}
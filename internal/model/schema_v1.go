@@ -0,0 +1,208 @@
+package model
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Frozen copies of the models as they were at migration 1, which creates the initial schema
+// from them. Never change these, a change of the models needs a migration of its own.
+
+type v1User struct {
+	ID        uuid.UUID `gorm:"type:uuid;primarykey"`
+	AuthUUID  string    `gorm:"unique"`
+	Handle    string    `gorm:"unique"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	IsAdmin   bool `gorm:"default:false"`
+}
+
+type v1Profile struct {
+	ID          string    `gorm:"type:uuid;primarykey"`
+	UserID      uuid.UUID `gorm:"type:uuid"`
+	User        v1User
+	DisplayName string
+	Location    string
+	Biography   string
+	Avatar      string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt sql.NullTime `gorm:"index"`
+}
+
+type v1Module struct {
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
+	UserID      uuid.UUID `gorm:"type:uuid"`
+	ShortCode   string
+	User        v1User
+	Private     bool   `gorm:"default:false"`
+	RepoURL     string `gorm:"uniqueIndex:idx_repo_sub"`
+	Name        string
+	Sub         string `gorm:"uniqueIndex:idx_repo_sub"`
+	Description string
+	CategoryID  string `gorm:"type:uuid"`
+	Category    v1Category
+	Metadata    datatypes.JSONMap
+
+	CredentialID *uuid.UUID `gorm:"type:uuid"`
+
+	RefreshedAt    sql.NullTime
+	RefreshError   string
+	RefreshErrorAt sql.NullTime
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt sql.NullTime `gorm:"index"`
+}
+
+type v1Repository struct {
+	ID        uuid.UUID `gorm:"type:uuid;primarykey"`
+	URL       string
+	Type      string
+	Location  string
+	Size      int64
+	UsedAt    sql.NullTime `gorm:"index"`
+	UpdatedAt time.Time
+	CreatedAt time.Time
+}
+
+type v1BenchModule struct {
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
+	Name        string
+	Description string
+	Conf        datatypes.JSON
+	ModuleID    uuid.UUID `gorm:"type:uuid"`
+	Module      v1Module
+	BenchID     uuid.UUID `gorm:"type:uuid"`
+	Bench       v1Bench
+	Position    int
+	Revision    string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt sql.NullTime `gorm:"index"`
+}
+
+type v1Category struct {
+	ID          string `gorm:"type:uuid;primarykey"`
+	Name        string `gorm:"unique"`
+	Description string
+}
+
+type v1Bench struct {
+	gorm.Model
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
+	UserID      uuid.UUID `gorm:"type:uuid"`
+	ShortCode   string
+	User        v1User
+	Active      bool
+	Public      bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Modules     []v1BenchModule `gorm:"foreignKey:BenchID"`
+	Name        string
+	Description string
+}
+
+type v1Filter struct {
+	gorm.Model
+	Key         string `gorm:"unique"`
+	Name        string `gorm:"unique"`
+	Description string
+}
+
+type v1Token struct {
+	ID         uuid.UUID `gorm:"type:uuid;primarykey"`
+	UserID     uuid.UUID `gorm:"type:uuid;index"`
+	User       v1User
+	Name       string
+	Prefix     string
+	Hash       string `gorm:"uniqueIndex"`
+	Scopes     string
+	LastUsedAt sql.NullTime
+	ExpiresAt  sql.NullTime
+	CreatedAt  time.Time
+}
+
+type v1Credential struct {
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
+	UserID      uuid.UUID `gorm:"type:uuid;index"`
+	User        v1User
+	Name        string
+	Kind        string
+	Username    string
+	Secret      []byte
+	Fingerprint string
+	LastUsedAt  sql.NullTime
+	CreatedAt   time.Time
+}
+
+type v1Job struct {
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
+	UserID      uuid.UUID `gorm:"type:uuid;index"`
+	Type        string    `gorm:"index"`
+	Key         string    `gorm:"index"`
+	Payload     datatypes.JSON
+	Status      string `gorm:"index"`
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time `gorm:"index"`
+	LockedAt    sql.NullTime
+	FinishedAt  sql.NullTime
+	Error       string
+	Output      string
+	Result      datatypes.JSON
+	ResultURL   string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type v1BenchSnapshot struct {
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
+	BenchID     uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_bench_snapshot_name"`
+	Name        string    `gorm:"uniqueIndex:idx_bench_snapshot_name"`
+	Description string
+	Modules     []v1BenchSnapshotModule `gorm:"foreignKey:SnapshotID"`
+
+	CreatedAt time.Time
+}
+
+type v1BenchSnapshotModule struct {
+	ID          uuid.UUID `gorm:"type:uuid;primarykey"`
+	SnapshotID  uuid.UUID `gorm:"type:uuid;index"`
+	ModuleID    uuid.UUID `gorm:"type:uuid"`
+	Module      v1Module
+	Name        string
+	Description string
+	Conf        datatypes.JSON
+	Position    int
+	Revision    string
+}
+
+func (v1User) TableName() string                { return "users" }
+func (v1Profile) TableName() string             { return "profiles" }
+func (v1Module) TableName() string              { return "modules" }
+func (v1Repository) TableName() string          { return "repositories" }
+func (v1BenchModule) TableName() string         { return "bench_modules" }
+func (v1Category) TableName() string            { return "categories" }
+func (v1Bench) TableName() string               { return "benches" }
+func (v1Filter) TableName() string              { return "filters" }
+func (v1Token) TableName() string               { return "tokens" }
+func (v1Credential) TableName() string          { return "credentials" }
+func (v1Job) TableName() string                 { return "jobs" }
+func (v1BenchSnapshot) TableName() string       { return "bench_snapshots" }
+func (v1BenchSnapshotModule) TableName() string { return "bench_snapshot_modules" }
+
+// tables of the initial schema
+var tables = []interface{}{
+	&v1User{}, &v1Profile{}, &v1Module{}, &v1Repository{}, &v1BenchModule{}, &v1Category{}, &v1Bench{}, &v1Filter{},
+	&v1Token{}, &v1Credential{}, &v1Job{}, &v1BenchSnapshot{}, &v1BenchSnapshotModule{},
+}
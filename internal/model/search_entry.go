@@ -1,13 +1,26 @@
 package model
 
-type Entry struct {
-	ID          string                 `json:"id"`
-	Type        string                 `json:"type"`
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	Author      string                 `json:"author"`
-	UserID      string                 `json:"user_id"`
-	Public      bool                   `json:"public"`
-	Tags        map[string]string      `json:"tags"`
-	Metadata    map[string]interface{} `json:"metadata"`
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// SearchEntry is a bench or module in the search index of the database search backend,
+// on PostgreSQL the table also has a generated tsvector column for the full text search
+type SearchEntry struct {
+	ID          string `gorm:"primarykey"`
+	Type        string
+	Name        string
+	Description string
+	Author      string
+	UserID      string `gorm:"index"`
+	Public      bool
+	Category    string
+	Tags        datatypes.JSON // list of strings
+	Popularity  int64
+	Metadata    datatypes.JSONMap
+	UpdatedAt   time.Time `gorm:"autoUpdateTime:false"` // of the bench or module, not the entry
 }
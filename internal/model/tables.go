@@ -7,7 +7,6 @@ import (
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 // Model interface defines which methods our models need to implement
@@ -21,32 +20,19 @@ type Model interface {
 // DB is the global instance of the database connection
 var DB *gorm.DB
 
-// CreateTables initially creates the tables in the database
-func CreateTables() {
-	err := DB.AutoMigrate(&User{}, &Profile{}, &Module{}, &Repository{}, &BenchModule{}, &Category{}, &Bench{}, &Filter{})
-	if err != nil {
-		zap.L().Fatal("could not run automigrations", zap.Error(err))
-	}
-
-}
-
-func CreateCategories() {
-	var categories = []Category{
+func defaultCategories() *[]Category {
+	return &[]Category{
 		{Name: "Uncategorized", Description: "Not yet categorized"},
 		{Name: "Power", Description: "Power electronics such as LDOs or DC/DC modules"},
 		{Name: "MCU", Description: "Microcontroller modules"},
 		{Name: "Test", Description: "Test modules - do not use"},
 		{Name: "Connector", Description: "Connector modules"},
 	}
-	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&categories)
-	if result.Error != nil {
-		zap.L().Fatal("could not create categories", zap.Error(result.Error))
-	}
 }
 
-func CreateFilters() {
-	// set up a few default filters
-	var categories = []Filter{
+// a few default filters
+func defaultFilters() *[]Filter {
+	return &[]Filter{
 		{Key: "v_in_min", Name: "Vin Min", Description: "Minimum Input Voltage"},
 		{Key: "v_in_max", Name: "Vin Max", Description: "Maximum Input Voltage"},
 		{Key: "v_out_min", Name: "Vout Min", Description: "Minimum Output Voltage"},
@@ -60,13 +46,10 @@ func CreateFilters() {
 
 		{Key: "i_q_typ", Name: "Iq Typ", Description: "Typical Quiescent Current"},
 	}
-	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&categories)
-	if result.Error != nil {
-		zap.L().Fatal("could not create categories", zap.Error(result.Error))
-	}
 }
 
-func isAuthorized(c *gin.Context, userID uuid.UUID) error {
+// IsAuthorized returns ErrUnauthorized if the current user neither owns the row nor is an admin
+func IsAuthorized(c *gin.Context, userID uuid.UUID) error {
 	u := c.Keys["user"].(*User)
 
 	// log if it's done by an admin
@@ -0,0 +1,75 @@
+package model
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes of personal access tokens, every scope includes the ones before it
+const (
+	ScopeRead  = "read"  // read private modules and benches
+	ScopeWrite = "write" // create, change and delete modules and benches
+	ScopeAdmin = "admin" // use admin privileges, only for admin users
+)
+
+// Scopes lists all valid token scopes in ascending order
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// Token is a personal access token for scripts and other non-browser clients
+type Token struct {
+	ID         uuid.UUID `gorm:"type:uuid;primarykey"`
+	UserID     uuid.UUID `gorm:"type:uuid;index"`
+	User       User      `json:"-" yaml:"-"`
+	Name       string
+	Prefix     string // first few characters of the token so users can tell them apart
+	Hash       string `gorm:"uniqueIndex" json:"-" yaml:"-"` // sha256 of the token, the token itself is never stored
+	Scopes     string // space separated list of scopes
+	LastUsedAt sql.NullTime
+	ExpiresAt  sql.NullTime
+	CreatedAt  time.Time
+}
+
+// ScopeList returns the scopes of the token as slice
+func (t *Token) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// HasScope checks if the token grants the given scope, a higher scope includes the lower ones
+func (t *Token) HasScope(scope string) bool {
+	want := scopeLevel(scope)
+	if want < 0 {
+		return false
+	}
+
+	for _, s := range t.ScopeList() {
+		if scopeLevel(s) >= want {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Expired returns true if the token has an expiry date in the past
+func (t *Token) Expired() bool {
+	return t.ExpiresAt.Valid && t.ExpiresAt.Time.Before(time.Now())
+}
+
+// ValidScope returns true for known scope names
+func ValidScope(scope string) bool {
+	return scopeLevel(scope) >= 0
+}
+
+func scopeLevel(scope string) int {
+	for i, s := range Scopes {
+		if s == scope {
+			return i
+		}
+	}
+	return -1
+}
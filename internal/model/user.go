@@ -6,7 +6,6 @@ import (
 	"errors"
 	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -19,7 +18,7 @@ import (
 
 // User mapping from IDs to the authentication provider data
 type User struct {
-	ID        uuid.UUID `gorm:"type:uuid;primarykey;default:uuid_generate_v4()"`
+	ID        uuid.UUID `gorm:"type:uuid;primarykey"`
 	AuthUUID  string    `gorm:"unique" json:"-"` // unique id from authentication provider, omit when serializing by default
 	Handle    string    `gorm:"unique"`          // user handle as it will be used in the url
 	CreatedAt time.Time `json:"-"`
@@ -38,9 +37,7 @@ func (u *User) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 
 // BeforeUpdate checks if the current user is allowed to do that
 func (u *User) BeforeUpdate(tx *gorm.DB) (err error) {
-	ctx := tx.Statement.Context.(*gin.Context)
-
-	return isAuthorized(ctx, u.ID)
+	return authorizeContext(tx.Statement.Context, u.ID)
 }
 
 // UserExists returns true if a user with the given auth uuid exists
@@ -0,0 +1,204 @@
+package ops
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"gitlab.com/edea-dev/edea-server/internal/search"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// CreateBench inserts a new bench for the user, an active bench deactivates all the other benches of the user
+func CreateBench(ctx context.Context, user *model.User, bench *model.Bench) error {
+	bench.ID = uuid.Nil // prevent the client setting an id
+	bench.UserID = user.ID
+
+	err := model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if bench.Active {
+			if err := tx.Model(&model.Bench{}).Where("user_id = ? and active = true", user.ID).Update("active", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(bench).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return search.UpdateEntry(search.BenchToEntry(*bench))
+}
+
+// DeleteBench removes a bench and its search index entry, the owner or an admin may do that
+func DeleteBench(ctx context.Context, id uuid.UUID) error {
+	var moduleIDs []uuid.UUID
+	result := model.DB.WithContext(ctx).Model(&model.BenchModule{}).Where("bench_id = ? and deleted_at is null", id).Pluck("module_id", &moduleIDs)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	result = model.DB.WithContext(ctx).Delete(&model.Bench{ID: id})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	if err := search.DeleteEntry(search.Entry{ID: id.String()}); err != nil {
+		return err
+	}
+
+	indexPopularity(ctx, moduleIDs...)
+
+	return nil
+}
+
+// indexPopularity updates the search index entries of modules which were added to or removed from
+// a bench, if that fails their popularity is only outdated until they are indexed again
+func indexPopularity(ctx context.Context, moduleIDs ...uuid.UUID) {
+	seen := make(map[uuid.UUID]bool, len(moduleIDs))
+
+	for _, id := range moduleIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if err := IndexModule(ctx, &model.Module{ID: id}); err != nil {
+			zap.L().Warn("could not update the popularity of a module", zap.Error(err), zap.String("module_id", id.String()))
+		}
+	}
+}
+
+// AddBenchModule appends a module to the end of a bench
+func AddBenchModule(ctx context.Context, bench *model.Bench, module *model.Module, conf datatypes.JSON) (*model.BenchModule, error) {
+	var pos int
+
+	// place new modules after the last one
+	result := model.DB.WithContext(ctx).Model(&model.BenchModule{}).
+		Select("coalesce(max(position), -1) + 1").
+		Where("bench_id = ? and deleted_at is null", bench.ID).
+		Scan(&pos)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	// pin the module to its current revision so the bench doesn't change with upstream
+	g := &repo.Git{URL: module.RepoURL}
+	rev, err := g.Head()
+	if err != nil {
+		zap.L().Warn("could not get module revision, bench module will follow HEAD", zap.Error(err), zap.String("module_id", module.ID.String()))
+	}
+
+	bm := &model.BenchModule{
+		BenchID:     bench.ID,
+		ModuleID:    module.ID,
+		Name:        module.Name,
+		Description: module.Description,
+		Conf:        conf,
+		Position:    pos,
+		Revision:    rev,
+	}
+
+	result = model.DB.WithContext(ctx).Create(bm)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	indexPopularity(ctx, module.ID)
+
+	return bm, nil
+}
+
+// RemoveBenchModule removes a module from a bench
+func RemoveBenchModule(ctx context.Context, bench *model.Bench, benchModuleID uuid.UUID) error {
+	bm := new(model.BenchModule)
+	result := model.DB.WithContext(ctx).Where("id = ? and bench_id = ?", benchModuleID, bench.ID).First(bm)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	result = model.DB.WithContext(ctx).Delete(bm)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	indexPopularity(ctx, bm.ModuleID)
+
+	return nil
+}
+
+// ReorderBenchModules sets the position of the bench modules to the order of the ids given,
+// all modules of the bench need to be part of the list
+func ReorderBenchModules(ctx context.Context, bench *model.Bench, ids []uuid.UUID) error {
+	return model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+
+		if err := tx.Model(&model.BenchModule{}).Where("bench_id = ? and deleted_at is null", bench.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(ids) {
+			return ErrIncompleteOrder
+		}
+
+		seen := make(map[uuid.UUID]bool, len(ids))
+
+		for i, id := range ids {
+			if seen[id] {
+				return ErrIncompleteOrder
+			}
+			seen[id] = true
+
+			result := tx.Model(&model.BenchModule{}).Where("id = ? and bench_id = ?", id, bench.ID).Update("position", i)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrIncompleteOrder
+			}
+		}
+
+		return nil
+	})
+}
+
+// PinBenchModule sets the revision of a module on a bench, an empty revision
+// updates it to the latest commit of the module repository
+func PinBenchModule(ctx context.Context, bench *model.Bench, bmID uuid.UUID, revision string) (*model.BenchModule, error) {
+	bm := new(model.BenchModule)
+
+	result := model.DB.WithContext(ctx).Preload("Module").Where("bench_id = ?", bench.ID).First(bm, bmID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	g := &repo.Git{URL: bm.Module.RepoURL}
+
+	// fetch new commits first, they're what people usually want to bump to
+	if err := g.Pull(); err != nil {
+		return nil, fmt.Errorf("could not pull latest changes: %w", err)
+	}
+
+	if revision == "" {
+		revision = "HEAD"
+	}
+
+	hash, err := g.ResolveRevision(revision)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRevision, revision)
+	}
+
+	result = model.DB.WithContext(ctx).Model(bm).Update("revision", hash)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return bm, nil
+}
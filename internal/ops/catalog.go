@@ -0,0 +1,278 @@
+package ops
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DefaultCategory is the name of the category new modules are put in if none was chosen
+const DefaultCategory = "Uncategorized"
+
+var (
+	// ErrCategoryExists is returned when another category already has the name
+	ErrCategoryExists = errors.New("a category with this name already exists")
+	// ErrDefaultCategory is returned when the default category would be renamed or removed
+	ErrDefaultCategory = errors.New("the default category can't be renamed or removed")
+	// ErrSameCategory is returned when a category would be merged into itself
+	ErrSameCategory = errors.New("a category can't be merged into itself")
+	// ErrFilterExists is returned when another filter already has the key or name
+	ErrFilterExists = errors.New("a filter with this key or name already exists")
+	// ErrInvalidFilterKey is returned when a filter key is empty or contains spaces
+	ErrInvalidFilterKey = errors.New("the filter key has to be a parameter name without spaces")
+)
+
+// CategoryUsage is a category with the number of its modules
+type CategoryUsage struct {
+	model.Category
+	Modules int64
+}
+
+// Categories lists all categories by name with the number of modules in them
+func Categories(ctx context.Context) ([]CategoryUsage, error) {
+	var categories []CategoryUsage
+
+	result := model.DB.WithContext(ctx).Model(&model.Category{}).
+		Select("categories.*, (SELECT COUNT(*) FROM modules WHERE modules.category_id = categories.id AND modules.deleted_at IS NULL) AS modules").
+		Order("name").Scan(&categories)
+
+	return categories, result.Error
+}
+
+// CreateCategory adds a new category, if the name is taken the existing one is returned with ErrCategoryExists
+func CreateCategory(ctx context.Context, category *model.Category) (*model.Category, error) {
+	category.ID = ""
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return nil, ErrEmptyName
+	}
+
+	var existing model.Category
+	result := model.DB.WithContext(ctx).Where("name = ?", category.Name).First(&existing)
+	if result.Error == nil {
+		return &existing, ErrCategoryExists
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, result.Error
+	}
+
+	if result := model.DB.WithContext(ctx).Create(category); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return category, nil
+}
+
+// UpdateCategory changes the name and description of a category and updates the search index
+// of its modules if the name changed
+func UpdateCategory(ctx context.Context, id string, fields *model.Category) (*model.Category, error) {
+	category := new(model.Category)
+	if result := model.DB.WithContext(ctx).First(category, "id = ?", id); result.Error != nil {
+		return nil, result.Error
+	}
+
+	name := strings.TrimSpace(fields.Name)
+	if name == "" {
+		return nil, ErrEmptyName
+	}
+
+	renamed := name != category.Name
+	if renamed {
+		if category.Name == DefaultCategory {
+			return nil, ErrDefaultCategory
+		}
+
+		var count int64
+		if result := model.DB.WithContext(ctx).Model(&model.Category{}).Where("name = ? AND id <> ?", name, id).Count(&count); result.Error != nil {
+			return nil, result.Error
+		}
+		if count > 0 {
+			return nil, ErrCategoryExists
+		}
+	}
+
+	category.Name = name
+	category.Description = fields.Description
+
+	if result := model.DB.WithContext(ctx).Save(category); result.Error != nil {
+		return nil, result.Error
+	}
+
+	if renamed {
+		reindexCategory(ctx, category.ID)
+	}
+
+	return category, nil
+}
+
+// DeleteCategory removes a category and moves its modules into another one, or the default category
+// if into is empty. It returns how many modules were moved.
+func DeleteCategory(ctx context.Context, id, into string) (int64, error) {
+	category := new(model.Category)
+	if result := model.DB.WithContext(ctx).First(category, "id = ?", id); result.Error != nil {
+		return 0, result.Error
+	}
+	if category.Name == DefaultCategory {
+		return 0, ErrDefaultCategory
+	}
+
+	if into == "" {
+		var err error
+		if into, err = DefaultCategoryID(); err != nil {
+			return 0, err
+		}
+	} else if into == id {
+		return 0, ErrSameCategory
+	}
+
+	target := new(model.Category)
+	if result := model.DB.WithContext(ctx).First(target, "id = ?", into); result.Error != nil {
+		return 0, result.Error
+	}
+
+	var moved int64
+
+	err := model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// deleted modules still reference the category, they're moved too; the modules
+		// aren't changed by their owners so neither the hooks nor updated_at apply
+		result := tx.Session(&gorm.Session{SkipHooks: true}).Unscoped().Model(&model.Module{}).
+			Where("category_id = ?", id).UpdateColumn("category_id", into)
+		if result.Error != nil {
+			return result.Error
+		}
+		moved = result.RowsAffected
+
+		// the modules are checked against the schema of their new category from now on
+		if err := tx.Where("category_id = ?", id).Delete(&model.CategoryParam{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(category).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if moved > 0 {
+		reindexCategory(ctx, into)
+	}
+
+	return moved, nil
+}
+
+// reindexCategory updates the search entries and saved search matches of the modules in a
+// category, the category is only a tag there so failures are logged instead of undoing the change.
+// Deleted modules are moved along with the others but must not come back into the index.
+func reindexCategory(ctx context.Context, id string) {
+	var ids []uuid.UUID
+	if result := model.DB.WithContext(ctx).Model(&model.Module{}).Where("category_id = ? AND deleted_at IS NULL", id).Pluck("id", &ids); result.Error != nil {
+		zap.L().Error("could not list the modules of a category", zap.Error(result.Error), zap.String("category", id))
+		return
+	}
+
+	for _, mid := range ids {
+		if err := indexChangedModule(ctx, &model.Module{ID: mid}); err != nil {
+			zap.L().Error("could not update the search index", zap.Error(err), zap.String("module", mid.String()))
+		}
+	}
+}
+
+// Filters lists all filters by key
+func Filters(ctx context.Context) ([]model.Filter, error) {
+	var filters []model.Filter
+	result := model.DB.WithContext(ctx).Order("key").Find(&filters)
+	return filters, result.Error
+}
+
+// CreateFilter adds a filter for a parameter, if the key or name is taken the existing filter
+// is returned with ErrFilterExists
+func CreateFilter(ctx context.Context, filter *model.Filter) (*model.Filter, error) {
+	filter.ID = 0
+	if err := cleanFilter(filter); err != nil {
+		return nil, err
+	}
+
+	// soft deleted filters of older versions would still block the key and name
+	result := model.DB.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL AND (key = ? OR name = ?)", filter.Key, filter.Name).Delete(&model.Filter{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var existing model.Filter
+	result = model.DB.WithContext(ctx).Where("key = ? OR name = ?", filter.Key, filter.Name).First(&existing)
+	if result.Error == nil {
+		return &existing, ErrFilterExists
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, result.Error
+	}
+
+	if result := model.DB.WithContext(ctx).Create(filter); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return filter, nil
+}
+
+// UpdateFilter changes the key, name and description of a filter
+func UpdateFilter(ctx context.Context, id uint, fields *model.Filter) (*model.Filter, error) {
+	filter := new(model.Filter)
+	if result := model.DB.WithContext(ctx).First(filter, id); result.Error != nil {
+		return nil, result.Error
+	}
+
+	if err := cleanFilter(fields); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	result := model.DB.WithContext(ctx).Model(&model.Filter{}).Where("(key = ? OR name = ?) AND id <> ?", fields.Key, fields.Name, id).Count(&count)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if count > 0 {
+		return nil, ErrFilterExists
+	}
+
+	filter.Key = fields.Key
+	filter.Name = fields.Name
+	filter.Description = fields.Description
+
+	if result := model.DB.WithContext(ctx).Save(filter); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return filter, nil
+}
+
+// DeleteFilter removes a filter, for good so that its key and name can be used again
+func DeleteFilter(ctx context.Context, id uint) error {
+	result := model.DB.WithContext(ctx).Unscoped().Delete(&model.Filter{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// cleanFilter trims the fields of a filter and checks them, the name defaults to the key
+func cleanFilter(f *model.Filter) error {
+	f.Key = strings.TrimSpace(f.Key)
+	f.Name = strings.TrimSpace(f.Name)
+
+	if f.Key == "" || strings.ContainsAny(f.Key, " \t\r\n") {
+		return ErrInvalidFilterKey
+	}
+	if f.Name == "" {
+		f.Name = f.Key
+	}
+
+	return nil
+}
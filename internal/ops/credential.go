@@ -0,0 +1,131 @@
+package ops
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"gitlab.com/edea-dev/edea-server/internal/secret"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidCredential is returned for credentials with a missing name, unknown kind or unparseable key
+	ErrInvalidCredential = errors.New("invalid credential")
+	// ErrPrivateRepository is returned when registering a module of a private repository without credentials
+	ErrPrivateRepository = repo.ErrPrivateRepository
+)
+
+// CreateCredential encrypts and stores repository credentials of the user
+func CreateCredential(ctx context.Context, user *model.User, cred *model.Credential, plaintext string) error {
+	cred.ID = uuid.Nil
+	cred.UserID = user.ID
+	cred.Name = strings.TrimSpace(cred.Name)
+	cred.Username = strings.TrimSpace(cred.Username)
+
+	if cred.Name == "" {
+		return util.HintError{Hint: "Please give the credentials a name", Err: ErrInvalidCredential}
+	}
+	if !model.ValidCredentialKind(cred.Kind) {
+		return util.HintError{Hint: "Credentials have to be an access token or an ssh key", Err: ErrInvalidCredential}
+	}
+	if strings.TrimSpace(plaintext) == "" {
+		return util.HintError{Hint: "The token or key must not be empty", Err: ErrInvalidCredential}
+	}
+
+	if cred.Kind == model.CredentialSSHKey {
+		// keys pasted into a textarea tend to lose their trailing newline
+		plaintext = strings.TrimSpace(plaintext) + "\n"
+
+		signer, err := ssh.ParsePrivateKey([]byte(plaintext))
+		if err != nil {
+			return util.HintError{Hint: "Could not read the ssh key, it has to be an unencrypted private key", Err: ErrInvalidCredential}
+		}
+		cred.Fingerprint = ssh.FingerprintSHA256(signer.PublicKey())
+	} else {
+		plaintext = strings.TrimSpace(plaintext)
+	}
+
+	sealed, err := secret.Seal([]byte(plaintext))
+	if errors.Is(err, secret.ErrNoKey) {
+		return util.HintError{Hint: "Storing credentials is not enabled on this instance", Err: err}
+	} else if err != nil {
+		return err
+	}
+	cred.Secret = sealed
+
+	return model.DB.WithContext(ctx).Create(cred).Error
+}
+
+// DeleteCredential removes credentials of the user, modules using them fall back to anonymous access
+func DeleteCredential(ctx context.Context, user *model.User, id uuid.UUID) error {
+	return model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? and user_id = ?", id, user.ID).Delete(&model.Credential{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		// skip the hooks, the modules of other users can't reference them anyway
+		return tx.Model(&model.Module{}).Where("credential_id = ?", id).UpdateColumn("credential_id", nil).Error
+	})
+}
+
+// UserCredentials lists the credentials of a user, the secrets stay encrypted
+func UserCredentials(ctx context.Context, user *model.User) ([]model.Credential, error) {
+	var creds []model.Credential
+
+	result := model.DB.WithContext(ctx).Where("user_id = ?", user.ID).Order("name").Find(&creds)
+	return creds, result.Error
+}
+
+// checkRepositoryAccess makes sure modules of private repositories are only registered with credentials
+// of the module owner which can actually access the repository, as the cached repository is shared
+func checkRepositoryAccess(ctx context.Context, owner uuid.UUID, url string, credentialID *uuid.UUID) error {
+	if credentialID == nil {
+		// other forms of the url share the clone
+		private, err := repo.Private(url)
+		if err != nil {
+			return err
+		}
+		if private {
+			return util.HintError{Hint: "The repository is private, select credentials which can access it", Err: ErrPrivateRepository}
+		}
+		return nil
+	}
+
+	cred := new(model.Credential)
+
+	result := model.DB.WithContext(ctx).Where("id = ? and user_id = ?", *credentialID, owner).First(cred)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return util.HintError{Hint: "The selected credentials do not exist", Err: ErrInvalidCredential}
+	} else if result.Error != nil {
+		return result.Error
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if err := repo.CheckAccess(ctx, url, cred); err != nil {
+		return util.HintError{Hint: "Could not access the repository with the selected credentials", Err: err}
+	}
+
+	return nil
+}
+
+func sameCredential(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,172 @@
+package ops
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// maximum depth of the dependency graph, anything deeper is most likely a mistake
+const maxDependencyDepth = 8
+
+// DependencyNode is a declared dependency and the module it resolves to
+type DependencyNode struct {
+	repo.Dependency
+	RepoURL  string            `json:"repo_url"`           // repository of the dependency, also set for ones in the same repository
+	Module   *model.Module     `json:"resolved,omitempty"` // nil if no module visible to the user is registered for it
+	Cycle    bool              `json:"cycle,omitempty"`    // the module already appears further up in the graph
+	Children []*DependencyNode `json:"dependencies,omitempty"`
+}
+
+// ModuleDependencies returns the dependencies of a module as stored in its metadata
+func ModuleDependencies(module *model.Module) []repo.Dependency {
+	v, ok := module.Metadata["dependencies"]
+	if !ok {
+		return nil
+	}
+
+	// the metadata went through json already, go back to the struct the same way
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	var deps []repo.Dependency
+	if err := json.Unmarshal(b, &deps); err != nil {
+		zap.L().Warn("invalid dependencies in module metadata", zap.Error(err), zap.String("module_id", module.ID.String()))
+		return nil
+	}
+
+	return deps
+}
+
+// ResolveDependencies builds the dependency graph of a module out of the registered modules visible to the user
+func ResolveDependencies(ctx context.Context, user *model.User, module *model.Module) ([]*DependencyNode, error) {
+	return resolveDependencies(ctx, user, module, map[uuid.UUID]bool{module.ID: true}, 0)
+}
+
+func resolveDependencies(ctx context.Context, user *model.User, module *model.Module, path map[uuid.UUID]bool, depth int) ([]*DependencyNode, error) {
+	var nodes []*DependencyNode
+
+	for _, dep := range ModuleDependencies(module) {
+		node := &DependencyNode{Dependency: dep, RepoURL: dep.Repo}
+		if node.RepoURL == "" {
+			node.RepoURL = module.RepoURL
+		}
+		nodes = append(nodes, node)
+
+		dm := new(model.Module)
+
+		result := model.DB.WithContext(ctx).Scopes(model.ModulesVisibleTo(user)).
+			Where("repo_key = ? and sub = ?", model.NormalizeRepoURL(node.RepoURL), dep.Module).First(dm)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			continue
+		} else if result.Error != nil {
+			return nil, result.Error
+		}
+
+		node.Module = dm
+
+		if path[dm.ID] || depth >= maxDependencyDepth {
+			node.Cycle = path[dm.ID]
+			continue
+		}
+
+		path[dm.ID] = true
+		children, err := resolveDependencies(ctx, user, dm, path, depth+1)
+		delete(path, dm.ID)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = children
+	}
+
+	return nodes, nil
+}
+
+// MissingDependencies returns the resolved dependencies of a module, including the transitive ones,
+// which aren't on the bench yet. Dependencies come before the modules needing them.
+func MissingDependencies(ctx context.Context, user *model.User, bench *model.Bench, module *model.Module) ([]*DependencyNode, error) {
+	graph, err := ResolveDependencies(ctx, user, module)
+	if err != nil {
+		return nil, err
+	}
+
+	var present []uuid.UUID
+
+	result := model.DB.WithContext(ctx).Model(&model.BenchModule{}).
+		Where("bench_id = ? and deleted_at is null", bench.ID).
+		Pluck("module_id", &present)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	seen := map[uuid.UUID]bool{module.ID: true}
+	for _, id := range present {
+		seen[id] = true
+	}
+
+	var missing []*DependencyNode
+	var walk func(nodes []*DependencyNode)
+
+	walk = func(nodes []*DependencyNode) {
+		for _, n := range nodes {
+			if n.Module == nil || n.Cycle || seen[n.Module.ID] {
+				continue
+			}
+			seen[n.Module.ID] = true
+
+			walk(n.Children)
+			missing = append(missing, n)
+		}
+	}
+	walk(graph)
+
+	return missing, nil
+}
+
+// AddBenchDependencies adds the missing dependencies of a module to a bench, those declared
+// with a revision are pinned to it. Only the dependencies whose module id is in include are
+// added, a nil include adds all of them.
+func AddBenchDependencies(ctx context.Context, user *model.User, bench *model.Bench, module *model.Module, include []uuid.UUID) ([]*model.BenchModule, error) {
+	missing, err := MissingDependencies(ctx, user, bench, module)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[uuid.UUID]bool, len(include))
+	for _, id := range include {
+		wanted[id] = true
+	}
+
+	var added []*model.BenchModule
+
+	for _, dep := range missing {
+		if include != nil && !wanted[dep.Module.ID] {
+			continue
+		}
+
+		bm, err := AddBenchModule(ctx, bench, dep.Module, nil)
+		if err != nil {
+			return added, err
+		}
+
+		if dep.Revision != "" {
+			if bm, err = PinBenchModule(ctx, bench, bm.ID, dep.Revision); err != nil {
+				return added, err
+			}
+		}
+
+		added = append(added, bm)
+	}
+
+	return added, nil
+}
@@ -0,0 +1,98 @@
+package ops
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gitlab.com/edea-dev/edea-server/internal/config"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"go.uber.org/zap"
+)
+
+// DiffDir returns the folder of a visual diff relative to the plot cache
+func DiffDir(module *model.Module, a, b string) string {
+	// revisions can contain slashes (e.g. origin/main), keep them in a single folder
+	clean := func(rev string) string {
+		return strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(rev)
+	}
+	return filepath.Join(module.ID.String(), fmt.Sprintf("%s-%s", clean(a), clean(b)))
+}
+
+// HasDiff returns true if the visual diff of the two revisions is already cached
+func HasDiff(module *model.Module, a, b string) bool {
+	s, err := os.Stat(filepath.Join(config.Cfg.Cache.Plot.Base, DiffDir(module, a, b)))
+	return err == nil && s.IsDir()
+}
+
+// PlotDiff renders the visual diff between two revisions of a module into the plot cache
+func PlotDiff(ctx context.Context, module *model.Module, a, b string) error {
+	if HasDiff(module, a, b) {
+		zap.L().Debug("plot diff cache already exists", zap.String("module", module.ID.String()))
+		return nil
+	}
+
+	zap.S().Debugf("diffing %s and %s", a, b)
+
+	g := &repo.Git{URL: module.RepoURL}
+
+	subPlotDir := filepath.Join(module.Sub, "plot")
+
+	tmpDest, err := os.MkdirTemp("", "plot-diff")
+	if err != nil {
+		return fmt.Errorf("could not create temp dir for diff: %w", err)
+	}
+	defer os.RemoveAll(tmpDest)
+
+	plotA, err := g.ExportPlotDirAt(tmpDest, subPlotDir, a)
+	if err != nil {
+		return fmt.Errorf("failed to export plots of %s: %w", a, err)
+	}
+
+	plotB, err := g.ExportPlotDirAt(tmpDest, subPlotDir, b)
+	if err != nil {
+		return fmt.Errorf("failed to export plots of %s: %w", b, err)
+	}
+
+	return plotDiff(ctx, plotA, plotB, filepath.Join(config.Cfg.Cache.Plot.Base, DiffDir(module, a, b)))
+}
+
+func plotDiff(ctx context.Context, dirA, dirB, dest string) error {
+	err := os.MkdirAll(dest, 0700)
+	if err != nil {
+		return fmt.Errorf("could not create plot diff output dir, check plot cache setting: %w", err)
+	}
+
+	// processing projects should not take longer than a minute
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	argv := []string{"-m", "edea", "--diff", "--output", dest, dirA, dirB}
+
+	zap.L().Debug("edea diff", zap.String("command", strings.Join(argv, " ")))
+
+	plotCmd := exec.CommandContext(ctx, "python3", argv...)
+
+	// run the plotting operation
+	logOutput, err := plotCmd.CombinedOutput()
+
+	// return the output of the tool and the error for the user to debug issues
+	if err != nil {
+		zap.L().Debug("plot pcb output", zap.ByteString("output", logOutput))
+		_ = os.RemoveAll(dest)
+		return util.HintError{
+			Hint: fmt.Sprintf("Error while running edea diff:\n%s", logOutput),
+			Err:  err,
+		}
+	}
+
+	return nil
+}
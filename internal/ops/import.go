@@ -0,0 +1,115 @@
+package ops
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"gorm.io/gorm"
+)
+
+// ErrUnknownSubModule is returned when a sub-module key is not part of the edea.yml of a repository
+var ErrUnknownSubModule = errors.New("sub-module does not exist in edea.yml")
+
+// ImportCandidate is a sub-module listed in the edea.yml of a repository
+type ImportCandidate struct {
+	Sub       string    `json:"sub"`
+	Directory string    `json:"dir"`
+	ModuleID  uuid.UUID `json:"module_id"` // set if the sub-module is already registered
+}
+
+// Registered returns true if there already is a module for the sub-module
+func (ic ImportCandidate) Registered() bool {
+	return ic.ModuleID != uuid.Nil
+}
+
+// ScanRepository lists the sub-modules of a repository in alphabetical order
+func ScanRepository(ctx context.Context, url string) ([]ImportCandidate, error) {
+	p, err := repo.ReadProject(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing []model.Module
+
+	result := model.DB.WithContext(ctx).Where("repo_key = ?", model.NormalizeRepoURL(url)).Find(&existing)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	registered := make(map[string]uuid.UUID, len(existing))
+	for _, m := range existing {
+		registered[m.Sub] = m.ID
+	}
+
+	list := make([]ImportCandidate, 0, len(p.Modules))
+	for sub, m := range p.Modules {
+		list = append(list, ImportCandidate{Sub: sub, Directory: m.Directory, ModuleID: registered[sub]})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Sub < list[j].Sub })
+
+	return list, nil
+}
+
+// RegisterModules adds several sub-modules of a repository in one transaction,
+// if any of them is unknown or already exists none of them are registered
+func RegisterModules(ctx context.Context, user *model.User, url string, modules []*model.Module) error {
+	// edea.yml can only be read from public repositories before any module exists
+	if err := checkRepositoryAccess(ctx, user.ID, url, nil); err != nil {
+		return err
+	}
+
+	// the repository was fetched by the scan, registering doesn't go to the network again
+	p, err := repo.CachedProject(url)
+	if errors.Is(err, repo.ErrUncachedRepo) {
+		return util.HintError{Hint: "Scan the repository before importing its modules.", Err: err}
+	} else if err != nil {
+		return err
+	}
+
+	defaultCategory, err := DefaultCategoryID()
+	if err != nil {
+		return err
+	}
+
+	return model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, module := range modules {
+			if _, ok := p.Modules[module.Sub]; !ok {
+				return fmt.Errorf("%w: %s", ErrUnknownSubModule, module.Sub)
+			}
+
+			var count int64
+			if err := tx.Model(&model.Module{}).Where("repo_key = ? and sub = ?", model.NormalizeRepoURL(url), module.Sub).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("%w: %s", ErrModuleExists, module.Sub)
+			}
+
+			module.ID = uuid.Nil // prevent the client setting an id
+			module.UserID = user.ID
+			module.RepoURL = url
+
+			if module.Name == "" {
+				module.Name = module.Sub
+			}
+			if module.CategoryID == "" {
+				module.CategoryID = defaultCategory
+			}
+
+			if err := tx.Create(module).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,292 @@
+// Package ops implements the module and bench operations shared between the
+// html views, the json api and anything else which needs to change them.
+package ops
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/config"
+	"gitlab.com/edea-dev/edea-server/internal/merge"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"gitlab.com/edea-dev/edea-server/internal/search"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrModuleExists is returned when a module with the same repository and sub-module key is already registered
+	ErrModuleExists = errors.New("module already exists")
+	// ErrIncompleteOrder is returned when a new module order does not contain exactly the modules of a bench
+	ErrIncompleteOrder = errors.New("the order has to contain every module of the bench exactly once")
+	// ErrUnknownRevision is returned when a revision can't be found in the module repository
+	ErrUnknownRevision = errors.New("unknown revision")
+)
+
+// CreateModule registers a new module and imports it right away, see RegisterModule and ImportModule
+func CreateModule(ctx context.Context, user *model.User, module *model.Module) (*model.Module, error) {
+	module, err := RegisterModule(ctx, user, module)
+	if err != nil {
+		return module, err
+	}
+
+	return module, ImportModule(ctx, module)
+}
+
+// RegisterModule adds a new module to the database without fetching the repository yet.
+// If the module already exists, the existing module is returned together with ErrModuleExists
+// if the user can see it, nil otherwise.
+func RegisterModule(ctx context.Context, user *model.User, module *model.Module) (*model.Module, error) {
+	// check if it already exists
+	tm := model.Module{}
+	result := model.DB.Where("repo_key = ? and sub = ?", model.NormalizeRepoURL(module.RepoURL), module.Sub).First(&tm)
+	if result.Error == nil {
+		result = model.DB.WithContext(ctx).Scopes(model.ModulesVisibleTo(user)).First(&tm, tm.ID)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrModuleExists
+		} else if result.Error != nil {
+			return nil, result.Error
+		}
+		return &tm, ErrModuleExists
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, result.Error
+	}
+
+	if err := checkRepositoryAccess(ctx, user.ID, module.RepoURL, module.CredentialID); err != nil {
+		return nil, err
+	}
+
+	module.ID = uuid.Nil // prevent the client setting an id
+	module.UserID = user.ID
+
+	if module.CategoryID == "" {
+		id, err := DefaultCategoryID()
+		if err != nil {
+			return nil, err
+		}
+		module.CategoryID = id
+	}
+
+	result = model.DB.WithContext(ctx).Create(module)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return module, nil
+}
+
+// ImportModule fetches the repository of a registered module, extracts its metadata and adds it to the search index
+func ImportModule(ctx context.Context, module *model.Module) error {
+	if err := repo.New(module.RepoURL); err != nil && !errors.Is(err, repo.ErrExists) {
+		return fmt.Errorf("could not fetch the repository: %w", err)
+	}
+
+	meta, err := merge.Metadata(module)
+	if err != nil {
+		return err
+	}
+	if err := ValidateParams(ctx, module.CategoryID, meta); err != nil {
+		return err
+	}
+
+	module.Metadata = meta
+
+	result := model.DB.WithContext(ctx).Model(module).Update("metadata", module.Metadata)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return indexChangedModule(ctx, module)
+}
+
+// RemoveUnimportedModule deletes a registered module whose import failed, modules which
+// have been imported before are kept
+func RemoveUnimportedModule(ctx context.Context, id uuid.UUID) error {
+	module := new(model.Module)
+
+	result := model.DB.WithContext(ctx).Where("id = ?", id).Limit(1).Find(module)
+	if result.Error != nil || result.RowsAffected == 0 || len(module.Metadata) > 0 {
+		return result.Error
+	}
+
+	zap.L().Info("removing module which could not be imported", zap.String("module_id", id.String()), zap.String("repo_url", module.RepoURL))
+
+	return DeleteModule(ctx, id)
+}
+
+// UpdateModule changes the user editable fields of a module
+func UpdateModule(ctx context.Context, id uuid.UUID, fields *model.Module) (*model.Module, error) {
+	module := new(model.Module)
+
+	result := model.DB.First(module, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if !sameCredential(module.CredentialID, fields.CredentialID) {
+		if err := checkRepositoryAccess(ctx, module.UserID, module.RepoURL, fields.CredentialID); err != nil {
+			return nil, err
+		}
+	}
+
+	module.Name = fields.Name
+	module.Description = fields.Description
+	module.Private = fields.Private
+	module.CategoryID = fields.CategoryID
+	module.CredentialID = fields.CredentialID
+
+	result = model.DB.WithContext(ctx).Save(module)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return module, indexChangedModule(ctx, module)
+}
+
+// DeleteModule removes a module from the database and the search index
+func DeleteModule(ctx context.Context, id uuid.UUID) error {
+	result := model.DB.WithContext(ctx).Delete(&model.Module{ID: id})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result := model.DB.WithContext(ctx).Where("module_id = ?", id).Delete(&model.SavedSearchMatch{}); result.Error != nil {
+		return result.Error
+	}
+
+	return search.DeleteEntry(search.Entry{ID: id.String()})
+}
+
+// PullModule fetches the latest changes of the module repository, drops the
+// visual diff caches for HEAD and updates the metadata and search index
+func PullModule(ctx context.Context, module *model.Module) error {
+	g := &repo.Git{URL: module.RepoURL}
+	if err := g.Pull(); err != nil {
+		return fmt.Errorf("could not pull latest changes: %w", err)
+	}
+
+	// new head, delete all visual diff caches referencing this
+	destCacheDir := filepath.Join(config.Cfg.Cache.Plot.Base, module.ID.String())
+
+	err := filepath.WalkDir(destCacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() && strings.Contains(d.Name(), "HEAD") {
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+			return fs.SkipDir
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not remove visual diff cache: %w", err)
+	}
+
+	meta, err := merge.Metadata(module)
+	if err != nil {
+		zap.L().Error("metadata extraction unsuccessful", zap.Error(err))
+		return err
+	}
+	if err := ValidateParams(ctx, module.CategoryID, meta); err != nil {
+		return err
+	}
+
+	module.Metadata = meta
+
+	result := model.DB.WithContext(ctx).Save(module)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	zap.L().Info("pulled repo for module", zap.String("repo_url", module.RepoURL), zap.String("module_id", module.ID.String()))
+
+	return indexChangedModule(ctx, module)
+}
+
+// RefreshModule pulls a module like PullModule and records the outcome on the module
+func RefreshModule(ctx context.Context, module *model.Module) error {
+	err := PullModule(ctx, module)
+
+	RecordRefresh(ctx, module, err)
+
+	return err
+}
+
+// RecordRefresh stores the time of a successful refresh or the error of a failed one.
+// It doesn't touch UpdatedAt as nothing about the module itself changed.
+func RecordRefresh(ctx context.Context, module *model.Module, err error) {
+	now := time.Now()
+
+	fields := map[string]interface{}{"refreshed_at": now, "refresh_error": ""}
+	if err != nil {
+		fields = map[string]interface{}{"refresh_error": err.Error(), "refresh_error_at": now}
+	}
+
+	result := model.DB.WithContext(ctx).Model(&model.Module{ID: module.ID}).UpdateColumns(fields)
+	if result.Error != nil {
+		zap.L().Error("could not record module refresh", zap.Error(result.Error), zap.String("module_id", module.ID.String()))
+	}
+}
+
+// IndexModule loads the full module from the database and updates its search index entry
+func IndexModule(ctx context.Context, module *model.Module) error {
+	result := model.DB.WithContext(ctx).Preload("User").Preload("Category").First(module, module.ID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	popularity, err := search.Popularity(ctx, module.ID)
+	if err != nil {
+		return err
+	}
+
+	e := search.ModuleToEntry(*module)
+	e.Popularity = popularity[e.ID]
+
+	if err := search.UpdateEntry(e); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// indexChangedModule indexes a new or changed module and notifies the users whose saved searches
+// it starts matching, failing to notify them doesn't fail the change
+func indexChangedModule(ctx context.Context, module *model.Module) error {
+	if err := IndexModule(ctx, module); err != nil {
+		return err
+	}
+
+	if err := CheckSavedSearches(ctx, module); err != nil {
+		zap.L().Error("could not check the saved searches", zap.Error(err), zap.String("module_id", module.ID.String()))
+	}
+
+	return nil
+}
+
+// DefaultCategoryID returns the id of the category new modules are put in if none was chosen
+func DefaultCategoryID() (string, error) {
+	var cat model.Category
+
+	result := model.DB.Where("name = ?", DefaultCategory).First(&cat)
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	return cat.ID, nil
+}
@@ -0,0 +1,425 @@
+package ops
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/config"
+	"gitlab.com/edea-dev/edea-server/internal/mail"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/search"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidSavedSearch is returned for saved searches without a name or without anything to search for
+var ErrInvalidSavedSearch = errors.New("invalid saved search")
+
+// SavedSearches lists the saved searches of a user by name
+func SavedSearches(ctx context.Context, user *model.User) ([]model.SavedSearch, error) {
+	var searches []model.SavedSearch
+
+	result := model.DB.WithContext(ctx).Where("user_id = ?", user.ID).Order("name").Find(&searches)
+	return searches, result.Error
+}
+
+// CreateSavedSearch stores a search of the user, the modules which match it already are
+// recorded so that only the ones which start matching later are notified
+func CreateSavedSearch(ctx context.Context, user *model.User, s *model.SavedSearch) error {
+	s.ID = uuid.Nil
+	s.UserID = user.ID
+	if err := cleanSavedSearch(s); err != nil {
+		return err
+	}
+
+	return model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(s).Error; err != nil {
+			return err
+		}
+		return recordMatches(tx, s)
+	})
+}
+
+// UpdateSavedSearch replaces the name, query and email setting of a saved search of the user,
+// the matches start over with the modules which match it now
+func UpdateSavedSearch(ctx context.Context, user *model.User, id uuid.UUID, fields *model.SavedSearch) (*model.SavedSearch, error) {
+	s := new(model.SavedSearch)
+	if result := model.DB.WithContext(ctx).Where("id = ? AND user_id = ?", id, user.ID).First(s); result.Error != nil {
+		return nil, result.Error
+	}
+
+	fields.ID, fields.UserID, fields.CreatedAt = s.ID, s.UserID, s.CreatedAt
+	if err := cleanSavedSearch(fields); err != nil {
+		return nil, err
+	}
+
+	err := model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(fields).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("saved_search_id = ?", id).Delete(&model.SavedSearchMatch{}).Error; err != nil {
+			return err
+		}
+		return recordMatches(tx, fields)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// DeleteSavedSearch removes a saved search of the user, its notifications stay
+func DeleteSavedSearch(ctx context.Context, user *model.User, id uuid.UUID) error {
+	return model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, user.ID).Delete(&model.SavedSearch{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Where("saved_search_id = ?", id).Delete(&model.SavedSearchMatch{}).Error
+	})
+}
+
+// cleanSavedSearch trims the fields of a saved search, drops what its kind doesn't use and
+// checks that there is something to search for
+func cleanSavedSearch(s *model.SavedSearch) error {
+	s.Name = strings.TrimSpace(s.Name)
+	s.Text = strings.TrimSpace(s.Text)
+	s.CategoryID = strings.TrimSpace(s.CategoryID)
+
+	if s.Name == "" {
+		return util.HintError{Hint: "Please give the search a name", Err: ErrInvalidSavedSearch}
+	}
+
+	switch s.Kind {
+	case model.SavedSearchText:
+		var filters map[string][]string
+		if len(s.Filters) > 0 {
+			if err := json.Unmarshal(s.Filters, &filters); err != nil {
+				return util.HintError{Hint: "The filters have to map facets to lists of values", Err: ErrInvalidSavedSearch}
+			}
+		}
+
+		clean := make(map[string][]string)
+		for _, f := range search.Facets {
+			for _, v := range filters[f] {
+				if v = strings.TrimSpace(v); v != "" {
+					clean[f] = append(clean[f], v)
+				}
+			}
+			delete(filters, f)
+		}
+		if len(filters) > 0 {
+			return util.HintError{Hint: fmt.Sprintf("Filters have to be one of %s", strings.Join(search.Facets, ", ")), Err: ErrInvalidSavedSearch}
+		}
+
+		s.Filters = nil
+		if len(clean) > 0 {
+			s.Filters, _ = json.Marshal(clean)
+		}
+		s.Params, s.CategoryID = nil, ""
+
+		if s.Text == "" && len(clean) == 0 {
+			return util.HintError{Hint: "The search needs words or filters", Err: ErrInvalidSavedSearch}
+		}
+	case model.SavedSearchParams:
+		s.Filters = nil
+		if s.CategoryID != "" {
+			if _, err := uuid.Parse(s.CategoryID); err != nil {
+				return util.HintError{Hint: "The category of the search does not exist", Err: ErrInvalidSavedSearch}
+			}
+		}
+
+		mq, err := moduleQuery(s)
+		if err != nil {
+			return util.HintError{Hint: "The parameters have to be a list of fields with an op and values", Err: ErrInvalidSavedSearch}
+		}
+		if _, err := mq.Expr(); err != nil {
+			return util.HintError{Hint: err.Error(), Err: ErrInvalidSavedSearch}
+		}
+
+		s.Params = nil
+		if len(mq.Params) > 0 {
+			s.Params, _ = json.Marshal(mq.Params)
+		}
+
+		if s.Text == "" && len(mq.Params) == 0 && s.CategoryID == "" {
+			return util.HintError{Hint: "The search needs a query, parameters or a category", Err: ErrInvalidSavedSearch}
+		}
+	default:
+		return util.HintError{Hint: "Saved searches are either full text or parametric searches", Err: ErrInvalidSavedSearch}
+	}
+
+	return nil
+}
+
+// textQuery is the full text search of a saved search. Only public modules are notified, so it's anonymous.
+func textQuery(s *model.SavedSearch) search.Query {
+	q := search.Query{Text: s.Text}
+	if len(s.Filters) > 0 {
+		_ = json.Unmarshal(s.Filters, &q.Filters)
+	}
+	return q
+}
+
+// moduleQuery is the parametric search of a saved search
+func moduleQuery(s *model.SavedSearch) (search.ModuleQuery, error) {
+	mq := search.ModuleQuery{Query: s.Text, Category: s.CategoryID}
+	if len(s.Params) > 0 {
+		if err := json.Unmarshal(s.Params, &mq.Params); err != nil {
+			return mq, err
+		}
+	}
+	return mq, nil
+}
+
+// savedSearchMatches checks a module and its search entry against a saved search
+func savedSearchMatches(s *model.SavedSearch, module *model.Module, entry search.Entry) (bool, error) {
+	if s.Kind == model.SavedSearchText {
+		return search.MatchEntry(textQuery(s), entry), nil
+	}
+
+	mq, err := moduleQuery(s)
+	if err != nil {
+		return false, err
+	}
+	return mq.Match(module)
+}
+
+// recordMatches stores which public modules of other users match a saved search, parametric
+// searches are matched in SQL and full text searches batch by batch
+func recordMatches(tx *gorm.DB, s *model.SavedSearch) error {
+	modules := tx.Model(&model.Module{}).Where("private = false AND deleted_at IS NULL AND user_id <> ?", s.UserID)
+
+	if s.Kind == model.SavedSearchParams {
+		mq, err := moduleQuery(s)
+		if err != nil {
+			return err
+		}
+		if modules, err = mq.Where(modules); err != nil {
+			return err
+		}
+		modules = modules.Select("modules.id")
+	} else {
+		modules = modules.Preload("Category").Preload("User")
+	}
+
+	q := textQuery(s)
+
+	var batch []model.Module
+	result := modules.FindInBatches(&batch, 100, func(_ *gorm.DB, _ int) error {
+		matches := make([]model.SavedSearchMatch, 0, len(batch))
+		for _, m := range batch {
+			if s.Kind == model.SavedSearchText && !search.MatchEntry(q, search.ModuleToEntry(m)) {
+				continue
+			}
+			matches = append(matches, model.SavedSearchMatch{SavedSearchID: s.ID, ModuleID: m.ID})
+		}
+
+		if len(matches) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&matches).Error
+	})
+
+	return result.Error
+}
+
+// CheckSavedSearches notifies the users whose saved searches a new or changed module starts matching,
+// the module needs its user and category preloaded. Only public modules of other users are notified,
+// one which stops matching a search is notified again when it matches again.
+func CheckSavedSearches(ctx context.Context, module *model.Module) error {
+	db := model.DB.WithContext(ctx)
+
+	// private modules match nothing
+	if module.Private {
+		return db.Where("module_id = ?", module.ID).Delete(&model.SavedSearchMatch{}).Error
+	}
+
+	var matched []uuid.UUID
+	if result := db.Model(&model.SavedSearchMatch{}).Where("module_id = ?", module.ID).Pluck("saved_search_id", &matched); result.Error != nil {
+		return result.Error
+	}
+	wasMatching := make(map[uuid.UUID]bool, len(matched))
+	for _, id := range matched {
+		wasMatching[id] = true
+	}
+
+	entry := search.ModuleToEntry(*module)
+
+	// parametric searches in another category can't match, unless the module was moved out of it
+	searches := db.Where("user_id <> ?", module.UserID).
+		Where("(kind = ? OR category_id = '' OR category_id = ? OR id IN (?))", model.SavedSearchText, module.CategoryID,
+			db.Model(&model.SavedSearchMatch{}).Select("saved_search_id").Where("module_id = ?", module.ID))
+
+	var stopped []uuid.UUID
+	var batch []model.SavedSearch
+	result := searches.FindInBatches(&batch, 100, func(_ *gorm.DB, _ int) error {
+		for i := range batch {
+			s := &batch[i]
+
+			matches, err := savedSearchMatches(s, module, entry)
+			if err != nil {
+				// one broken search shouldn't keep the others from being notified
+				zap.L().Error("could not check saved search", zap.Error(err), zap.String("saved_search_id", s.ID.String()))
+				continue
+			}
+
+			switch {
+			case matches && !wasMatching[s.ID]:
+				if err := notifyMatch(ctx, s, module); err != nil {
+					return err
+				}
+			case !matches && wasMatching[s.ID]:
+				stopped = append(stopped, s.ID)
+			}
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if len(stopped) == 0 {
+		return nil
+	}
+	return db.Where("module_id = ? AND saved_search_id IN ?", module.ID, stopped).Delete(&model.SavedSearchMatch{}).Error
+}
+
+// notifyMatch records that a module matches a saved search and notifies its user
+func notifyMatch(ctx context.Context, s *model.SavedSearch, module *model.Module) error {
+	n := &model.Notification{
+		UserID:        s.UserID,
+		SavedSearchID: &s.ID,
+		ModuleID:      &module.ID,
+		Message:       fmt.Sprintf("%s matches your saved search %q", module.Name, s.Name),
+	}
+
+	notified := false
+	err := model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// a concurrent pull of the same repository might have been faster
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.SavedSearchMatch{SavedSearchID: s.ID, ModuleID: module.ID})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		notified = true
+		return tx.Create(n).Error
+	})
+	if err != nil || !notified {
+		return err
+	}
+
+	zap.L().Info("notified saved search", zap.String("saved_search_id", s.ID.String()), zap.String("module_id", module.ID.String()))
+
+	if s.Email {
+		emailNotification(ctx, n)
+	}
+
+	return nil
+}
+
+// QueueEmail queues sending a notification by email, the jobs package sets it as its handlers
+// use ops and it can't be imported here
+var QueueEmail func(ctx context.Context, n *model.Notification) error
+
+// emailNotification queues sending a notification by email, it's skipped without a mail server
+func emailNotification(ctx context.Context, n *model.Notification) {
+	if !mail.Enabled() {
+		return
+	}
+
+	if QueueEmail == nil {
+		zap.L().Error("no job queue to send email notifications", zap.String("notification_id", n.ID.String()))
+		return
+	}
+	if err := QueueEmail(ctx, n); err != nil {
+		zap.L().Error("could not queue email notification", zap.Error(err), zap.String("notification_id", n.ID.String()))
+	}
+}
+
+// EmailNotification sends a notification to the email address on the profile of its user, it's
+// skipped without a mail server or confirmed address and if the notification is gone
+func EmailNotification(ctx context.Context, id uuid.UUID) error {
+	if !mail.Enabled() {
+		return nil
+	}
+
+	n := new(model.Notification)
+	if result := model.DB.WithContext(ctx).First(n, id); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return result.Error
+	}
+
+	var p model.Profile
+	if result := model.DB.WithContext(ctx).Where("user_id = ?", n.UserID).First(&p); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return result.Error
+	}
+	if p.Email == "" || !p.EmailConfirmedAt.Valid {
+		return nil
+	}
+
+	base := strings.TrimSuffix(config.Cfg.Mail.BaseURL, "/")
+	body := fmt.Sprintf("%s\n\n%s/module/%s\n\nYou get this email as you enabled it for the saved search, change it on your profile: %s/profile\n",
+		n.Message, base, n.ModuleID, base)
+
+	return mail.Send(ctx, p.Email, "EDeA: "+n.Message, body)
+}
+
+// Notifications lists the latest notifications of a user, the newest first
+func Notifications(ctx context.Context, user *model.User, limit int) ([]model.Notification, error) {
+	var notifications []model.Notification
+
+	result := model.DB.WithContext(ctx).Where("user_id = ?", user.ID).Order("created_at DESC").Limit(limit).Find(&notifications)
+	return notifications, result.Error
+}
+
+// UnreadNotifications counts the notifications the user hasn't read yet
+func UnreadNotifications(ctx context.Context, user *model.User) (int64, error) {
+	var count int64
+
+	result := model.DB.WithContext(ctx).Model(&model.Notification{}).Where("user_id = ? AND read_at IS NULL", user.ID).Count(&count)
+	return count, result.Error
+}
+
+// ReadNotification marks a notification of the user as read and returns it
+func ReadNotification(ctx context.Context, user *model.User, id uuid.UUID) (*model.Notification, error) {
+	n := new(model.Notification)
+	if result := model.DB.WithContext(ctx).Where("id = ? AND user_id = ?", id, user.ID).First(n); result.Error != nil {
+		return nil, result.Error
+	}
+
+	if !n.ReadAt.Valid {
+		n.ReadAt = sql.NullTime{Time: time.Now(), Valid: true}
+		if result := model.DB.WithContext(ctx).Model(n).Update("read_at", n.ReadAt); result.Error != nil {
+			return nil, result.Error
+		}
+	}
+
+	return n, nil
+}
+
+// ReadAllNotifications marks every notification of the user as read
+func ReadAllNotifications(ctx context.Context, user *model.User) error {
+	return model.DB.WithContext(ctx).Model(&model.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", user.ID).
+		Update("read_at", sql.NullTime{Time: time.Now(), Valid: true}).Error
+}
@@ -0,0 +1,218 @@
+package ops
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/units"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrParamExists is returned when the category already has a parameter with the key
+	ErrParamExists = errors.New("the category already has a parameter with this key")
+	// ErrInvalidParam is returned for parameter definitions which don't make sense
+	ErrInvalidParam = errors.New("invalid parameter")
+	// ErrParamsMismatch is returned when the parameters of a module don't match the schema of its category
+	ErrParamsMismatch = errors.New("the parameters don't match the category")
+)
+
+// CategoryParams returns the parameter schema of a category in order
+func CategoryParams(ctx context.Context, categoryID string) ([]model.CategoryParam, error) {
+	var params []model.CategoryParam
+	result := model.DB.WithContext(ctx).Where("category_id = ?", categoryID).Order("position, key").Find(&params)
+	return params, result.Error
+}
+
+// CreateCategoryParam adds a parameter to the schema of a category, if the key is taken the
+// existing parameter is returned with ErrParamExists
+func CreateCategoryParam(ctx context.Context, param *model.CategoryParam) (*model.CategoryParam, error) {
+	param.ID = uuid.Nil
+	if err := cleanParam(param); err != nil {
+		return nil, err
+	}
+
+	if result := model.DB.WithContext(ctx).First(&model.Category{}, "id = ?", param.CategoryID); result.Error != nil {
+		return nil, result.Error
+	}
+
+	var existing model.CategoryParam
+	result := model.DB.WithContext(ctx).Where("category_id = ? AND key = ?", param.CategoryID, param.Key).First(&existing)
+	if result.Error == nil {
+		return &existing, ErrParamExists
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, result.Error
+	}
+
+	if result := model.DB.WithContext(ctx).Create(param); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return param, nil
+}
+
+// UpdateCategoryParam replaces the definition of a parameter, it stays in its category
+func UpdateCategoryParam(ctx context.Context, id uuid.UUID, fields *model.CategoryParam) (*model.CategoryParam, error) {
+	param := new(model.CategoryParam)
+	if result := model.DB.WithContext(ctx).First(param, id); result.Error != nil {
+		return nil, result.Error
+	}
+
+	if fields.CategoryID != "" && fields.CategoryID != param.CategoryID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if err := cleanParam(fields); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	result := model.DB.WithContext(ctx).Model(&model.CategoryParam{}).
+		Where("category_id = ? AND key = ? AND id <> ?", param.CategoryID, fields.Key, id).Count(&count)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if count > 0 {
+		return nil, ErrParamExists
+	}
+
+	fields.ID = param.ID
+	fields.CategoryID = param.CategoryID
+	fields.CreatedAt = param.CreatedAt
+
+	if result := model.DB.WithContext(ctx).Save(fields); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return fields, nil
+}
+
+// DeleteCategoryParam removes a parameter from the schema of its category
+func DeleteCategoryParam(ctx context.Context, categoryID string, id uuid.UUID) error {
+	result := model.DB.WithContext(ctx).Where("category_id = ?", categoryID).Delete(&model.CategoryParam{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ParseBound reads the lower or upper bound of a number parameter, e.g. "4.5V" for a
+// parameter in V. An empty string means there is no bound.
+func ParseBound(s, unit string) (*float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	q, err := units.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+	}
+	if err := q.Compatible(unit); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+	}
+
+	return &q.Value, nil
+}
+
+// cleanParam trims the fields of a parameter definition and checks that they fit together
+func cleanParam(p *model.CategoryParam) error {
+	p.Key = strings.TrimSpace(p.Key)
+	p.Name = strings.TrimSpace(p.Name)
+
+	if p.Key == "" || strings.ContainsAny(p.Key, " \t\r\n") {
+		return fmt.Errorf("%w: the key has to be a parameter name without spaces", ErrInvalidParam)
+	}
+	if p.Name == "" {
+		p.Name = p.Key
+	}
+	if p.Type == "" {
+		p.Type = model.ParamNumber
+	}
+
+	switch p.Type {
+	case model.ParamNumber:
+		if p.Unit != "" && !units.Known(p.Unit) {
+			return fmt.Errorf("%w: unknown unit %q, known units are %s", ErrInvalidParam, p.Unit, strings.Join(units.Units, ", "))
+		}
+		if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+			return fmt.Errorf("%w: the minimum is larger than the maximum", ErrInvalidParam)
+		}
+		if len(p.EnumValues()) > 0 {
+			return fmt.Errorf("%w: only text parameters can have a list of allowed values", ErrInvalidParam)
+		}
+		p.Enum = nil
+	case model.ParamText:
+		if p.Unit != "" || p.Min != nil || p.Max != nil {
+			return fmt.Errorf("%w: text parameters can't have a unit or range", ErrInvalidParam)
+		}
+	default:
+		return fmt.Errorf("%w: the type has to be one of %s", ErrInvalidParam, strings.Join(model.ParamTypes, ", "))
+	}
+
+	return nil
+}
+
+// EnumJSON encodes the allowed values of a text parameter, empty values are dropped
+func EnumJSON(values []string) []byte {
+	var enum []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			enum = append(enum, v)
+		}
+	}
+	if len(enum) == 0 {
+		return nil
+	}
+
+	b, _ := json.Marshal(enum)
+	return b
+}
+
+// ValidateParams checks the parameters in the metadata of a module against the schema of
+// its category, the problems are returned as hint for the owner of the module
+func ValidateParams(ctx context.Context, categoryID string, metadata map[string]interface{}) error {
+	if categoryID == "" {
+		return nil
+	}
+
+	schema, err := CategoryParams(ctx, categoryID)
+	if err != nil || len(schema) == 0 {
+		return err
+	}
+
+	params, _ := metadata["params"].(map[string]interface{})
+
+	// units are a map of strings straight from the extraction and of interfaces from the database
+	paramUnits := make(map[string]string)
+	switch u := metadata["units"].(type) {
+	case map[string]string:
+		paramUnits = u
+	case map[string]interface{}:
+		for k, v := range u {
+			paramUnits[k], _ = v.(string)
+		}
+	}
+
+	problems := model.CheckParams(schema, params, paramUnits)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	lines := []string{"The params in edea.yml don't match what the category of the module expects:"}
+	for _, p := range problems {
+		lines = append(lines, "- "+p.Error())
+	}
+
+	return util.HintError{Hint: strings.Join(lines, "\n"), Err: ErrParamsMismatch}
+}
@@ -0,0 +1,167 @@
+package ops
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"gitlab.com/edea-dev/edea-server/internal/search"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSnapshotExists is returned when a bench already has a snapshot with the same name
+	ErrSnapshotExists = errors.New("a snapshot with this name already exists")
+	// ErrEmptyName is returned when a snapshot has no name
+	ErrEmptyName = errors.New("a name is required")
+)
+
+// CreateSnapshot freezes the current modules of a bench under the given name.
+// Modules which follow the latest commit are pinned to it in the snapshot.
+func CreateSnapshot(ctx context.Context, bench *model.Bench, name, description string) (*model.BenchSnapshot, error) {
+	if name == "" {
+		return nil, ErrEmptyName
+	}
+
+	var mods []model.BenchModule
+
+	result := model.DB.WithContext(ctx).Preload("Module").Where("bench_id = ?", bench.ID).Order("position").Find(&mods)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	snap := &model.BenchSnapshot{
+		BenchID:     bench.ID,
+		Name:        name,
+		Description: description,
+	}
+
+	for _, bm := range mods {
+		rev := bm.Revision
+		if rev == "" {
+			g := &repo.Git{URL: bm.Module.RepoURL}
+			h, err := g.Head()
+			if err != nil {
+				return nil, err
+			}
+			rev = h
+		}
+
+		snap.Modules = append(snap.Modules, model.BenchSnapshotModule{
+			ModuleID:    bm.ModuleID,
+			RepoURL:     bm.Module.RepoURL,
+			Sub:         bm.Module.Sub,
+			Name:        bm.Name,
+			Description: bm.Description,
+			Conf:        bm.Conf,
+			Position:    bm.Position,
+			Revision:    rev,
+		})
+	}
+
+	err := model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+
+		if err := tx.Model(&model.BenchSnapshot{}).Where("bench_id = ? and name = ?", bench.ID, name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrSnapshotExists
+		}
+
+		return tx.Create(snap).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+// GetSnapshot loads a snapshot with its modules if the bench is public or owned by the user
+func GetSnapshot(ctx context.Context, user *model.User, id uuid.UUID) (*model.BenchSnapshot, *model.Bench, error) {
+	var userID uuid.UUID
+
+	if user != nil {
+		userID = user.ID
+	}
+
+	snap := new(model.BenchSnapshot)
+
+	result := model.DB.WithContext(ctx).Preload("Modules", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Preload("Modules.Module").First(snap, id)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+
+	bench := new(model.Bench)
+
+	result = model.DB.WithContext(ctx).Where("id = ? and (public = true or user_id = ?)", snap.BenchID, userID).First(bench)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+
+	return snap, bench, nil
+}
+
+// SnapshotModules returns the modules of a snapshot as bench modules, e.g. for merging
+func SnapshotModules(snap *model.BenchSnapshot) []model.BenchModule {
+	mods := make([]model.BenchModule, 0, len(snap.Modules))
+	for i := range snap.Modules {
+		mods = append(mods, snap.Modules[i].BenchModule())
+	}
+	return mods
+}
+
+// ForkBench copies a bench and the given modules to a new private bench of
+// the user, the new bench becomes the active one
+func ForkBench(ctx context.Context, user *model.User, bench *model.Bench, mods []model.BenchModule) (*model.Bench, error) {
+	b := &model.Bench{
+		UserID:      user.ID,
+		Name:        bench.Name,
+		Description: bench.Description,
+		Active:      true,
+	}
+
+	err := model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Bench{}).Where("user_id = ? and active = true", user.ID).Update("active", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(b).Error; err != nil {
+			return err
+		}
+
+		for _, m := range mods {
+			bm := &model.BenchModule{
+				BenchID:     b.ID,
+				ModuleID:    m.ModuleID,
+				Name:        m.Name,
+				Description: m.Description,
+				Conf:        m.Conf,
+				Position:    m.Position,
+				Revision:    m.Revision,
+			}
+			if err := tx.Create(bm).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	moduleIDs := make([]uuid.UUID, len(mods))
+	for i, m := range mods {
+		moduleIDs[i] = m.ModuleID
+	}
+	indexPopularity(ctx, moduleIDs...)
+
+	return b, search.UpdateEntry(search.BenchToEntry(*b))
+}
@@ -0,0 +1,234 @@
+package ops
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"gitlab.com/edea-dev/edea-server/internal/config"
+	"gitlab.com/edea-dev/edea-server/internal/mail"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNoSuchUser is returned if there is no user with the given handle
+	ErrNoSuchUser = errors.New("no such user")
+	// ErrInvalidConfirmation is returned for unknown or outdated email confirmation links
+	ErrInvalidConfirmation = errors.New("invalid email confirmation")
+)
+
+// CreateUser inserts a user together with their profile, the display name defaults to the handle
+func CreateUser(ctx context.Context, user *model.User, profile *model.Profile) error {
+	if profile.DisplayName == "" {
+		profile.DisplayName = user.Handle
+	}
+
+	return model.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		profile.UserID = user.ID
+		return tx.Create(profile).Error
+	})
+}
+
+// UserByHandle looks up a user by their handle
+func UserByHandle(ctx context.Context, handle string) (*model.User, error) {
+	u := new(model.User)
+
+	result := model.DB.WithContext(ctx).Where("handle = ?", handle).First(u)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNoSuchUser
+		}
+		return nil, result.Error
+	}
+
+	return u, nil
+}
+
+// UpdateProfile changes the profile of the user, a new email address has to be confirmed before
+// notifications are sent to it and confirm is true if a confirmation link should be sent
+func UpdateProfile(ctx context.Context, user *model.User, fields *model.Profile) (p *model.Profile, confirm bool, err error) {
+	p = new(model.Profile)
+	if result := model.DB.WithContext(ctx).Where("user_id = ?", user.ID).First(p); result.Error != nil {
+		return nil, false, result.Error
+	}
+
+	email := strings.TrimSpace(fields.Email)
+	if email != p.Email {
+		p.Email = email
+		p.EmailConfirmedAt = sql.NullTime{}
+		p.EmailToken = ""
+		confirm = email != ""
+	}
+
+	p.DisplayName = fields.DisplayName
+	p.Location = fields.Location
+	p.Biography = fields.Biography
+	p.Avatar = fields.Avatar
+
+	if result := model.DB.WithContext(ctx).Save(p); result.Error != nil {
+		return nil, false, result.Error
+	}
+
+	return p, confirm && mail.Enabled(), nil
+}
+
+// EmailConfirmation sends a link to confirm the email address of a profile, every link replaces the
+// previous one. It's skipped without a mail server and for addresses which are already confirmed.
+func EmailConfirmation(ctx context.Context, profileID string) error {
+	if !mail.Enabled() {
+		return nil
+	}
+
+	p := new(model.Profile)
+	result := model.DB.WithContext(ctx).Where("id = ?", profileID).Limit(1).Find(p)
+	if result.Error != nil || result.RowsAffected == 0 || p.Email == "" || p.EmailConfirmedAt.Valid {
+		return result.Error
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+
+	// the address might have changed since, the token is only stored for the one it's sent to
+	result = model.DB.WithContext(ctx).Model(&model.Profile{}).Where("id = ? and email = ?", p.ID, p.Email).
+		UpdateColumn("email_token", hashEmailToken(token))
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	base := strings.TrimSuffix(config.Cfg.Mail.BaseURL, "/")
+	body := fmt.Sprintf("Please confirm that notifications of your saved searches on EDeA should be sent to this address:\n\n"+
+		"%s/profile/email/confirm?token=%s\n\nIf you didn't enter it on your profile just ignore this email.\n", base, url.QueryEscape(token))
+
+	return mail.Send(ctx, p.Email, "EDeA: confirm your email address", body)
+}
+
+// ConfirmEmail marks the email address of the user's profile as confirmed if the token of the
+// confirmation link matches
+func ConfirmEmail(ctx context.Context, user *model.User, token string) error {
+	if token == "" {
+		return util.HintError{Hint: "The confirmation link is incomplete", Err: ErrInvalidConfirmation}
+	}
+
+	result := model.DB.WithContext(ctx).Model(&model.Profile{}).
+		Where("user_id = ? and email <> '' and email_token = ?", user.ID, hashEmailToken(token)).
+		UpdateColumns(map[string]interface{}{"email_confirmed_at": time.Now(), "email_token": ""})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return util.HintError{Hint: "The confirmation link is outdated, save the address on your profile again to get a new one", Err: ErrInvalidConfirmation}
+	}
+
+	return nil
+}
+
+// hashEmailToken returns the hex encoded sha256 sum of a confirmation token, like access tokens
+// they have enough entropy for that
+func hashEmailToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetAdmin grants or revokes the admin privileges of a user
+func SetAdmin(ctx context.Context, handle string, admin bool) (*model.User, error) {
+	u, err := UserByHandle(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	if result := model.DB.WithContext(ctx).Model(u).Update("is_admin", admin); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return u, nil
+}
+
+// ExportUser writes a zip archive with the personal data of a user, their profile, modules, benches,
+// saved searches and notifications
+func ExportUser(ctx context.Context, user *model.User, w io.Writer) error {
+	var benches []model.Bench
+	var modules []model.Module
+	var profile model.Profile
+	var searches []model.SavedSearch
+	var notifications []model.Notification
+
+	db := model.DB.WithContext(ctx)
+
+	if result := db.Preload("Modules").Where("user_id = ?", user.ID).Find(&benches); result.Error != nil {
+		return result.Error
+	}
+	if result := db.Preload("Category").Where("user_id = ?", user.ID).Find(&modules); result.Error != nil {
+		return result.Error
+	}
+	if result := db.Where("user_id = ?", user.ID).Find(&profile); result.Error != nil {
+		return result.Error
+	}
+	if result := db.Where("user_id = ?", user.ID).Find(&searches); result.Error != nil {
+		return result.Error
+	}
+	if result := db.Where("user_id = ?", user.ID).Find(&notifications); result.Error != nil {
+		return result.Error
+	}
+
+	// the filters and params are JSON, which YAML would write as lists of bytes
+	b, err := json.Marshal(searches)
+	if err != nil {
+		return err
+	}
+	var plainSearches interface{}
+	if err := json.Unmarshal(b, &plainSearches); err != nil {
+		return err
+	}
+
+	files := []struct {
+		Name string
+		Data interface{}
+	}{
+		{"benches.yml", benches},
+		{"modules.yml", modules},
+		{"profile.yml", profile},
+		{"saved_searches.yml", plainSearches},
+		{"notifications.yml", notifications},
+	}
+
+	zw := zip.NewWriter(w)
+
+	for _, file := range files {
+		b, err := yaml.Marshal(file.Data)
+		if err != nil {
+			return err
+		}
+
+		f, err := zw.Create(file.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
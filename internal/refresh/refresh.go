@@ -0,0 +1,198 @@
+// Package refresh periodically updates the module repositories so that modules
+// stay current even if their repository host can't send webhooks.
+package refresh
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrRunning is returned when a refresh is requested while one is still in progress
+	ErrRunning = errors.New("a refresh is already running")
+
+	mu       sync.Mutex
+	running  bool
+	lastRun  time.Time
+	lastTook time.Duration
+)
+
+// Status describes the current state of the scheduler
+type Status struct {
+	Running  bool
+	LastRun  time.Time
+	LastTook time.Duration
+}
+
+// Current returns the current status of the scheduler
+func Current() Status {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return Status{Running: running, LastRun: lastRun, LastTook: lastTook}
+}
+
+// Run refreshes all repositories every interval until the context is cancelled.
+// An interval of zero disables the scheduler.
+func Run(ctx context.Context, interval time.Duration, concurrency int) {
+	if interval <= 0 {
+		zap.L().Info("scheduled repository refresh is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := All(ctx, concurrency); err != nil {
+			zap.L().Warn("scheduled repository refresh failed", zap.Error(err))
+		}
+	}
+}
+
+// Start refreshes all repositories in the background, see All
+func Start(concurrency int) error {
+	start, err := claim()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer release(start)
+		if err := refreshAll(context.Background(), concurrency); err != nil {
+			zap.L().Warn("repository refresh failed", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// All refreshes every repository with at most concurrency repositories at a time.
+// Repositories where the remote HEAD matches the local one are skipped.
+func All(ctx context.Context, concurrency int) error {
+	start, err := claim()
+	if err != nil {
+		return err
+	}
+	defer release(start)
+
+	return refreshAll(ctx, concurrency)
+}
+
+// claim makes sure only one refresh runs at a time
+func claim() (time.Time, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if running {
+		return time.Time{}, ErrRunning
+	}
+	running = true
+
+	return time.Now(), nil
+}
+
+func release(start time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	running = false
+	lastRun = start
+	lastTook = time.Since(start)
+}
+
+func refreshAll(ctx context.Context, concurrency int) error {
+	start := time.Now()
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// modules are owned by many users, the scheduler acts on behalf of the instance
+	ctx = model.SystemContext(ctx)
+
+	var modules []model.Module
+
+	if err := model.DB.WithContext(ctx).Order("repo_url").Find(&modules).Error; err != nil {
+		return err
+	}
+
+	// multiple modules can share a repository, only check each one once
+	repos := make(map[string][]model.Module)
+	for _, m := range modules {
+		repos[m.RepoURL] = append(repos[m.RepoURL], m)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for url, mods := range repos {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(url string, mods []model.Module) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			refreshRepo(ctx, url, mods)
+		}(url, mods)
+	}
+
+	wg.Wait()
+
+	zap.L().Info("refreshed repositories", zap.Int("repositories", len(repos)), zap.Int("modules", len(modules)), zap.Duration("took", time.Since(start)))
+
+	return nil
+}
+
+func refreshRepo(ctx context.Context, url string, modules []model.Module) {
+	g := &repo.Git{URL: url}
+
+	// don't bother pulling and extracting the metadata again if nothing changed
+	local, err := g.Head()
+	if err == nil {
+		remote, err := g.RemoteHead(ctx)
+		if err != nil {
+			zap.L().Warn("could not get remote head", zap.Error(err), zap.String("repo_url", url))
+			for i := range modules {
+				ops.RecordRefresh(ctx, &modules[i], err)
+			}
+			return
+		}
+
+		if local == remote {
+			zap.L().Debug("repository is up to date", zap.String("repo_url", url), zap.String("head", local))
+			for i := range modules {
+				ops.RecordRefresh(ctx, &modules[i], nil)
+			}
+			return
+		}
+	}
+
+	for i := range modules {
+		if err := ops.RefreshModule(ctx, &modules[i]); err != nil {
+			zap.L().Warn("could not refresh module", zap.Error(err), zap.String("module_id", modules[i].ID.String()))
+		}
+	}
+}
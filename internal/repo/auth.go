@@ -0,0 +1,142 @@
+package repo
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"gitlab.com/edea-dev/edea-server/internal/config"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/secret"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AuthMethod turns stored credentials into something go-git can use
+func AuthMethod(cred *model.Credential) (transport.AuthMethod, error) {
+	s, err := secret.Open(cred.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	username := cred.Username
+
+	switch cred.Kind {
+	case model.CredentialToken:
+		if username == "" {
+			username = "git" // the hosts only look at the token, but the username can't be empty
+		}
+		return &githttp.BasicAuth{Username: username, Password: string(s)}, nil
+	case model.CredentialSSHKey:
+		if username == "" {
+			username = "git"
+		}
+		keys, err := gitssh.NewPublicKeys(username, s, "")
+		if err != nil {
+			return nil, err
+		}
+		if config.Cfg.Credentials.KnownHosts != "" {
+			if keys.HostKeyCallback, err = gitssh.NewKnownHostsCallback(config.Cfg.Credentials.KnownHosts); err != nil {
+				return nil, err
+			}
+		}
+		return keys, nil
+	}
+
+	return nil, errors.New("unknown credential kind")
+}
+
+// CheckAccess tries to list the references of a repository with the given credentials
+func CheckAccess(ctx context.Context, url string, cred *model.Credential) error {
+	auth, err := AuthMethod(cred)
+	if err != nil {
+		return err
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{url},
+	})
+
+	_, err = remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	return err
+}
+
+// ErrPrivateRepository is returned when reading a private repository without its credentials
+var ErrPrivateRepository = errors.New("private repository")
+
+// Private returns true if a module with credentials uses the repository under any form of its url
+// or shares its cache folder, then it must not be read without credentials which can access it
+func Private(url string) (bool, error) {
+	cond := model.DB.Where("modules.repo_key = ?", model.NormalizeRepoURL(url))
+	if cache != nil {
+		if path, err := cache.urlToRepoPath(url); err == nil {
+			cond = cond.Or("modules.repo_url IN (?)", model.DB.Model(&model.Repository{}).Select("url").Where("location = ?", path))
+		}
+	}
+
+	var count int64
+	result := model.DB.Model(&model.Module{}).Where("modules.credential_id is not null").Where(cond).Count(&count)
+	return count > 0, result.Error
+}
+
+// CheckPublic refuses to read private repositories without a module, the cached clones are shared
+func CheckPublic(url string) error {
+	private, err := Private(url)
+	if err != nil {
+		return err
+	}
+	if private {
+		return util.HintError{Hint: "The repository is private, it can only be read through its modules", Err: ErrPrivateRepository}
+	}
+	return nil
+}
+
+// credentialFor returns the credentials of the oldest module matching the condition, nil if none has any
+func credentialFor(query string, args ...interface{}) (*model.Credential, error) {
+	cred := new(model.Credential)
+
+	result := model.DB.Model(cred).
+		Joins("join modules on modules.credential_id = credentials.id").
+		Where("modules.deleted_at is null").
+		Where(query, args...).
+		Order("modules.created_at").
+		First(cred)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return cred, nil
+}
+
+// authFor returns the credentials to access a repository, nil for public ones. Repositories are
+// cached once for everyone, so the credentials of the oldest module using the repository are used.
+func authFor(url string) (transport.AuthMethod, error) {
+	cred, err := credentialFor("modules.repo_key = ?", model.NormalizeRepoURL(url))
+	if cred == nil || err != nil {
+		return nil, err
+	}
+
+	auth, err := AuthMethod(cred)
+	if err != nil {
+		return nil, err
+	}
+
+	result := model.DB.Model(cred).UpdateColumn("last_used_at", time.Now())
+	if result.Error != nil {
+		zap.L().Warn("could not update credential usage", zap.Error(result.Error), zap.String("credential_id", cred.ID.String()))
+	}
+
+	return auth, nil
+}
@@ -4,7 +4,10 @@ package repo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"time"
@@ -14,6 +17,7 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/google/uuid"
 	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/util"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -35,7 +39,8 @@ type GitRepository struct {
 }
 
 type RepoCache struct {
-	Base string
+	Base    string
+	MaxSize int64 // in bytes, zero for no limit
 }
 
 var (
@@ -45,8 +50,14 @@ var (
 
 // Clone a git repository
 func (g *GitRepository) Clone(ctx context.Context) error {
+	auth, err := authFor(g.URL)
+	if err != nil {
+		return err
+	}
+
 	r, err := git.PlainCloneContext(ctx, g.Path, false, &git.CloneOptions{
 		URL:               g.URL,
+		Auth:              auth,
 		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
 	})
 
@@ -54,7 +65,7 @@ func (g *GitRepository) Clone(ctx context.Context) error {
 		return err
 	}
 
-	if err := r.FetchContext(ctx, &git.FetchOptions{}); err != nil {
+	if err := r.FetchContext(ctx, &git.FetchOptions{Auth: auth}); err != nil {
 		if !errors.Is(err, git.NoErrAlreadyUpToDate) {
 			return err
 		}
@@ -63,6 +74,27 @@ func (g *GitRepository) Clone(ctx context.Context) error {
 	return nil
 }
 
+// Size returns the bytes used by the checkout on disk
+func (g *GitRepository) Size() (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(g.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
+
 // Update (fetch) a git repository
 func (g *GitRepository) Update(ctx context.Context) error {
 	r, err := git.PlainOpen(g.Path)
@@ -70,10 +102,20 @@ func (g *GitRepository) Update(ctx context.Context) error {
 		return err
 	}
 
-	if err := r.FetchContext(ctx, nil); err != nil {
-		if !errors.Is(err, git.NoErrAlreadyUpToDate) {
-			return err
+	auth, err := authFor(g.URL)
+	if err != nil {
+		return err
+	}
+
+	if err := r.FetchContext(ctx, &git.FetchOptions{Auth: auth}); err != nil {
+		if errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return nil
 		}
+		return err
+	}
+
+	if err := UpdateSize(g.URL); err != nil {
+		zap.L().Warn("could not update repository size", zap.Error(err), zap.String("url", g.URL))
 	}
 
 	return nil
@@ -108,8 +150,19 @@ func (c *RepoCache) Add(url string) (err error) {
 		} else {
 			return err
 		}
+	} else if _, err := git.PlainOpen(path); err != nil {
+		// leftovers of an interrupted clone, start over
+		zap.S().Warnf("repo cache folder conflict for %s, %s: %v", url, path, err)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(path, os.ModePerm); err != nil {
+			return err
+		}
+	} else if err := checkReuse(url); err != nil {
+		return err
 	} else {
-		zap.S().Warnf("repo cache folder conflict for %s, %s", url, path)
+		zap.S().Warnf("repo cache folder conflict for %s, %s, reusing the existing clone", url, path)
 		repoFolderExists = true
 	}
 
@@ -127,15 +180,57 @@ func (c *RepoCache) Add(url string) (err error) {
 					zap.NamedError("git clone", err),
 					zap.String("path", path))
 			}
-			if !errors.Is(err, transport.ErrEmptyRemoteRepository) {
-				return err
+			// there's nothing to cache yet, a repository row without a clone would be a missing clone
+			if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+				return util.HintError{Hint: "The repository is empty, push the module to it first.", Err: err}
 			}
+			return err
 		}
 	}
 
-	r := &model.Repository{URL: url, Location: path, Type: "git"}
-	result := model.DB.Create(r)
-	return result.Error
+	r := &model.Repository{URL: url, Location: path, Type: "git", UsedAt: sql.NullTime{Time: time.Now(), Valid: true}}
+	r.Size, err = (&GitRepository{URL: url, Path: path}).Size()
+	if err != nil {
+		zap.L().Warn("could not determine repository size", zap.Error(err), zap.String("url", url))
+	}
+
+	if result := model.DB.Create(r); result.Error != nil {
+		return result.Error
+	}
+
+	// make room for the new repository if necessary
+	if c.MaxSize > 0 {
+		if _, err := c.Evict(c.MaxSize); err != nil {
+			zap.L().Error("could not evict repositories from the cache", zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// checkReuse makes sure that the clone of a private repository is only reused for another url of it if
+// the credentials of the modules with that url can access it
+func checkReuse(url string) error {
+	private, err := Private(url)
+	if err != nil || !private {
+		return err
+	}
+
+	cred, err := credentialFor("modules.repo_url = ?", url)
+	if err != nil {
+		return err
+	}
+	if cred == nil {
+		return fmt.Errorf("%w: %s", ErrPrivateRepository, url)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := CheckAccess(ctx, url, cred); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrPrivateRepository, url, err)
+	}
+	return nil
 }
 
 // Has returns true if the repository is already cached
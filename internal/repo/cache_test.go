@@ -4,9 +4,15 @@ package repo
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gorm.io/gorm/clause"
 )
 
 func TestRepo_AddToCache(t *testing.T) {
@@ -28,3 +34,109 @@ func TestRepo_AddToCache_FailNotExist(t *testing.T) {
 	}
 	t.Fail()
 }
+
+func TestRepo_RemoveSharedLocation(t *testing.T) {
+	c := &RepoCache{Base: t.TempDir()}
+	path := filepath.Join(c.Base, "example.com", "shared")
+	if err := os.MkdirAll(path, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	repos := []model.Repository{
+		{URL: "https://example.com/shared", Location: path, Type: "git"},
+		{URL: "https://example.com/shared.git", Location: path, Type: "git"},
+	}
+	if err := model.DB.Create(&repos).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.remove(&repos[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("the clone is still used by %s: %v", repos[1].URL, err)
+	}
+
+	if err := c.remove(&repos[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("the clone should be gone with its last repository: %v", err)
+	}
+
+	var left int64
+	if err := model.DB.Model(&model.Repository{}).Where("location = ?", path).Count(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("%d repositories left", left)
+	}
+}
+
+func TestRepo_Private(t *testing.T) {
+	url := "https://example.org/org/private"
+	path, err := cache.urlToRepoPath(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credID := uuid.New()
+	m := &model.Module{UserID: uuid.New(), Name: "private", RepoURL: url, CredentialID: &credID}
+	if err := model.DB.Omit(clause.Associations).Create(m).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := model.DB.Create(&model.Repository{URL: url, Location: path, Type: "git"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for url, want := range map[string]bool{
+		"https://Example.org/org/private.git/": true,  // same repository
+		"git@example.org:org/private.git":      true,  // same repository over ssh
+		"https://example.org/other/private":    true,  // shares the cache folder
+		"https://example.org/org/public":       false, // a different repository
+	} {
+		got, err := Private(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Private(%q) = %v, want %v", url, got, want)
+		}
+	}
+
+	if _, err := ReadProject("https://example.org/org/private.git"); !errors.Is(err, ErrPrivateRepository) {
+		t.Errorf("reading another form of the url: %v", err)
+	}
+}
+
+func TestRepo_CachedProjectUncached(t *testing.T) {
+	if _, err := CachedProject("https://example.org/org/never-scanned"); !errors.Is(err, ErrUncachedRepo) {
+		t.Errorf("reading a repository which isn't cached: %v", err)
+	}
+}
+
+func TestRepo_OrphanedClonesSkipsRecent(t *testing.T) {
+	old := cache
+	cache = &RepoCache{Base: t.TempDir()}
+	t.Cleanup(func() { cache = old })
+
+	stale := filepath.Join(cache.Base, "example.com", "stale")
+	recent := filepath.Join(cache.Base, "example.com", "recent")
+	for _, path := range []string{stale, recent} {
+		if err := os.MkdirAll(filepath.Join(path, ".git"), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hourAgo := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(stale, hourAgo, hourAgo); err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err := OrphanedClones()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 1 || orphans[0] != stale {
+		t.Errorf("got %v, want only %s, the other clone might still be in progress", orphans, stale)
+	}
+}
@@ -0,0 +1,99 @@
+package repo
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+)
+
+// clones are only added to the database once they're complete, younger ones might still be in progress
+const orphanGracePeriod = 10 * time.Minute
+
+// OrphanedClones lists the clones in the cache folder which no repository row points at
+func OrphanedClones() ([]string, error) {
+	var repos []model.Repository
+
+	if result := model.DB.Find(&repos); result.Error != nil {
+		return nil, result.Error
+	}
+
+	known := make(map[string]bool, len(repos))
+	for _, r := range repos {
+		if p, err := filepath.Abs(r.Location); err == nil {
+			known[p] = true
+		}
+	}
+
+	base, err := filepath.Abs(cache.Base)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []string
+
+	err = filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == base {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() || path == base {
+			return nil
+		}
+
+		// everything below a working copy belongs to it
+		if _, err := os.Stat(filepath.Join(path, git.GitDirName)); err == nil {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if !known[path] && time.Since(info.ModTime()) > orphanGracePeriod {
+				orphans = append(orphans, path)
+			}
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	return orphans, err
+}
+
+// MissingClones lists the repository rows whose working copy is gone or can't be opened
+func MissingClones() ([]model.Repository, error) {
+	var repos, missing []model.Repository
+
+	if result := model.DB.Find(&repos); result.Error != nil {
+		return nil, result.Error
+	}
+
+	for _, r := range repos {
+		if _, err := git.PlainOpen(r.Location); err != nil {
+			missing = append(missing, r)
+		}
+	}
+
+	return missing, nil
+}
+
+// RemoveOrphan deletes a clone which no repository row points at
+func RemoveOrphan(path string) error {
+	return cache.removeDir(path)
+}
+
+// Reclone replaces a broken working copy with a fresh clone
+func Reclone(r *model.Repository) error {
+	if err := cache.remove(r); err != nil {
+		return err
+	}
+
+	return cache.Add(r.URL)
+}
@@ -3,6 +3,7 @@ package repo
 // SPDX-License-Identifier: EUPL-1.2
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -12,9 +13,11 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/memory"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 )
@@ -35,6 +38,28 @@ type Module struct {
 	Directory string                 `yaml:"dir"`    // path to the kicad project file or folder which contains it
 	Doc       string                 `yaml:"doc"`    // path to book.toml
 	Params    map[string]interface{} `yaml:"params"` // module parameters, used for search
+	Tags      []string               `yaml:"tags"`   // keywords for the search, e.g. ldo or usb-c
+
+	Dependencies []Dependency `yaml:"dependencies"` // other modules this one needs
+}
+
+// Dependency references another module, either in the same repository by its key
+// or in another repository by URL and optionally a revision
+type Dependency struct {
+	Repo     string `yaml:"repo" json:"repo,omitempty"`         // empty for the same repository
+	Module   string `yaml:"module" json:"module,omitempty"`     // sub-module key, empty for single module repositories
+	Revision string `yaml:"revision" json:"revision,omitempty"` // empty to follow HEAD
+}
+
+// UnmarshalYAML allows declaring a dependency in the same repository with just its key
+func (d *Dependency) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		d.Module = n.Value
+		return nil
+	}
+
+	type plain Dependency
+	return n.Decode((*plain)(d))
 }
 
 type Commit struct {
@@ -95,6 +120,46 @@ func (g *Git) EdeaParams(sub string) (map[string]interface{}, error) {
 	return m.Params, nil
 }
 
+// EdeaTags returns the tags of a sub-module as declared in edea.yml
+func (g *Git) EdeaTags(sub string) ([]string, error) {
+	p := &Project{}
+
+	s, err := g.File("edea.yml", false)
+	if err != nil {
+		return nil, errors.New("module does not contain an edea.yml file")
+	}
+	if err := yaml.Unmarshal([]byte(s), p); err != nil {
+		return nil, err
+	}
+
+	m, ok := p.Modules[sub]
+	if !ok {
+		return nil, errors.New("no such sub-module")
+	}
+
+	return m.Tags, nil
+}
+
+// EdeaDependencies returns the dependencies of a sub-module as declared in edea.yml
+func (g *Git) EdeaDependencies(sub string) ([]Dependency, error) {
+	p := &Project{}
+
+	s, err := g.File("edea.yml", false)
+	if err != nil {
+		return nil, errors.New("module does not contain an edea.yml file")
+	}
+	if err := yaml.Unmarshal([]byte(s), p); err != nil {
+		return nil, err
+	}
+
+	m, ok := p.Modules[sub]
+	if !ok {
+		return nil, errors.New("no such sub-module")
+	}
+
+	return m.Dependencies, nil
+}
+
 // SubModuleReadme searches for a readme.md file in the repository and returns it if found
 func (g *Git) SubModuleReadme(sub, revision string) (string, error) {
 	p := &Project{}
@@ -271,11 +336,77 @@ func (g *Git) Pull() error {
 		return err
 	}
 
-	if err := w.Pull(&git.PullOptions{RemoteName: "origin"}); err == git.NoErrAlreadyUpToDate {
+	auth, err := authFor(g.URL)
+	if err != nil {
+		return err
+	}
+
+	if err := w.Pull(&git.PullOptions{RemoteName: "origin", Auth: auth}); err == git.NoErrAlreadyUpToDate {
 		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// new objects were fetched, the size changed
+	if err := UpdateSize(g.URL); err != nil {
+		zap.L().Warn("could not update repository size", zap.Error(err), zap.String("url", g.URL))
+	}
+
+	return nil
+}
+
+// Head returns the commit hash of the checked out HEAD
+func (g *Git) Head() (string, error) {
+	_, ref, err := g.head()
+	if err != nil {
+		return "", err
 	}
 
-	return err
+	return ref.Hash().String(), nil
+}
+
+// RemoteHead returns the commit hash HEAD points to on the remote without fetching anything
+func (g *Git) RemoteHead(ctx context.Context) (string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{g.URL},
+	})
+
+	auth, err := authFor(g.URL)
+	if err != nil {
+		return "", err
+	}
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", err
+	}
+
+	var head *plumbing.Reference
+	hashes := make(map[plumbing.ReferenceName]plumbing.Hash, len(refs))
+
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			head = ref
+		}
+		if ref.Type() == plumbing.HashReference {
+			hashes[ref.Name()] = ref.Hash()
+		}
+	}
+
+	if head == nil {
+		return "", plumbing.ErrReferenceNotFound
+	}
+	if head.Type() == plumbing.HashReference {
+		return head.Hash().String(), nil
+	}
+
+	// HEAD is usually a symbolic reference to the default branch
+	if h, ok := hashes[head.Target()]; ok {
+		return h.String(), nil
+	}
+
+	return "", plumbing.ErrReferenceNotFound
 }
 
 func (g *Git) open() (*git.Repository, error) {
@@ -294,6 +425,8 @@ func (g *Git) open() (*git.Repository, error) {
 		return nil, err
 	}
 
+	touch(g.URL)
+
 	return git.PlainOpen(path)
 }
 
@@ -502,6 +635,92 @@ func (g *Git) ExportPlotDirAt(dest, dir, revision string) (string, error) {
 	return path, err
 }
 
+// ResolveRevision returns the commit hash of a revision
+// the revision parameter can be anything ResolveRevision understands (tags, branches, HEAD^1, etc.)
+func (g *Git) ResolveRevision(revision string) (string, error) {
+	r, err := g.open()
+	if err != nil {
+		return "", err
+	}
+
+	ref, err := r.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return "", err
+	}
+
+	return ref.String(), nil
+}
+
+// ExportTreeAt writes the whole tree of the repository at the specified revision
+// to dest, like a worktree checked out at that revision but without the .git folder
+func (g *Git) ExportTreeAt(dest, revision string) error {
+	r, err := g.open()
+	if err != nil {
+		return err
+	}
+
+	ref, err := r.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return err
+	}
+
+	commit, err := r.CommitObject(*ref)
+	if err != nil {
+		return err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	return tree.Files().ForEach(func(f *object.File) error {
+		// git paths are always relative and use forward slashes, don't let them escape dest
+		name := filepath.Join(dest, filepath.FromSlash(f.Name))
+		if !strings.HasPrefix(name, filepath.Clean(dest)+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path in repository: %s", f.Name)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			return err
+		}
+
+		_, err := gitFileToTemp(f, filepath.Dir(name))
+		return err
+	})
+}
+
+// FilesAt returns the paths of all files in the repository at the specified revision
+func (g *Git) FilesAt(revision string) ([]string, error) {
+	r, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := r.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := r.CommitObject(*ref)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files = append(files, f.Name)
+		return nil
+	})
+
+	return files, err
+}
+
 func gitFileToTemp(f *object.File, dest string) (string, error) {
 	tf, err := os.Create(filepath.Join(dest, filepath.Base(f.Name)))
 	if err != nil {
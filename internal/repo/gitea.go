@@ -2,5 +2,242 @@ package repo
 
 // SPDX-License-Identifier: EUPL-1.2
 
-// https://try.gitea.io/wumi/vue-element-admin/raw/branch/master/README.md
-// https://try.gitea.io/api/v1/repos/wumi/vue-element-admin -> key "default_branch"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+ * Gitea and Forgejo share the same REST API:
+ *
+ * Repository metadata, including the default branch:
+ * "https://try.gitea.io/api/v1/repos/wumi/vue-element-admin"
+ *
+ * Latest commit of a branch:
+ * "https://try.gitea.io/api/v1/repos/wumi/vue-element-admin/branches/master"
+ *
+ * Files in the top-level directory and the raw contents of a file:
+ * "https://try.gitea.io/api/v1/repos/wumi/vue-element-admin/contents?ref=master"
+ * "https://try.gitea.io/api/v1/repos/wumi/vue-element-admin/raw/README.md?ref=master"
+ */
+
+// maximum size of a readme we're willing to download
+const giteaMaxReadme = 1 << 20
+
+// Gitea is a repository on a Gitea or Forgejo instance, e.g. codeberg.org or a self-hosted one
+type Gitea struct {
+	BaseURL   string // scheme and host of the instance, with a path prefix if it isn't hosted at the root
+	Owner     string
+	Name      string
+	AuthToken string // optional, needed for private repositories
+
+	Client *http.Client // http.DefaultClient with a timeout if nil
+}
+
+// GiteaRepository is the metadata of a repository
+type GiteaRepository struct {
+	ID            int64     `json:"id"`
+	FullName      string    `json:"full_name"`
+	Description   string    `json:"description"`
+	Website       string    `json:"website"`
+	HTMLURL       string    `json:"html_url"`
+	CloneURL      string    `json:"clone_url"`
+	DefaultBranch string    `json:"default_branch"`
+	Private       bool      `json:"private"`
+	Empty         bool      `json:"empty"`
+	Archived      bool      `json:"archived"`
+	Stars         int       `json:"stars_count"`
+	Forks         int       `json:"forks_count"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type giteaBranch struct {
+	Name   string `json:"name"`
+	Commit struct {
+		ID        string    `json:"id"`
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"commit"`
+}
+
+type giteaContent struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Type string `json:"type"`
+}
+
+// NewGitea creates a provider from the web or clone URL of a repository
+func NewGitea(repoURL string) (*Gitea, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(u.Path, ".git"), "/"), "/")
+	if len(parts) < 2 || u.Host == "" {
+		return nil, fmt.Errorf("not a repository url: %s", repoURL)
+	}
+
+	// everything before owner/name is the path prefix of the instance
+	n := len(parts)
+	base := url.URL{Scheme: u.Scheme, Host: u.Host, Path: strings.Join(parts[:n-2], "/")}
+	if base.Path != "" {
+		base.Path = "/" + base.Path
+	}
+
+	return &Gitea{BaseURL: base.String(), Owner: parts[n-2], Name: parts[n-1]}, nil
+}
+
+// Repository returns the metadata of the repository
+func (r *Gitea) Repository() (*GiteaRepository, error) {
+	res := new(GiteaRepository)
+	if err := r.get("", nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DefaultBranch returns the name of the default branch
+func (r *Gitea) DefaultBranch() (string, error) {
+	res, err := r.Repository()
+	if err != nil {
+		return "", err
+	}
+	return res.DefaultBranch, nil
+}
+
+// LastCommit returns the hash and time of the latest commit on a branch, the default branch if empty
+func (r *Gitea) LastCommit(branch string) (hash string, at time.Time, err error) {
+	if branch == "" {
+		if branch, err = r.DefaultBranch(); err != nil {
+			return
+		}
+	}
+
+	var res giteaBranch
+	if err = r.get("/branches/"+url.PathEscape(branch), nil, &res); err != nil {
+		return
+	}
+
+	return res.Commit.ID, res.Commit.Timestamp, nil
+}
+
+// Readme returns the readme.md in the top-level directory of the default branch
+func (r *Gitea) Readme() (string, error) {
+	branch, err := r.DefaultBranch()
+	if err != nil {
+		return "", err
+	}
+
+	return r.readme(branch)
+}
+
+// Info returns the latest commit and the readme of the default branch
+func (r *Gitea) Info() (*Info, error) {
+	branch, err := r.DefaultBranch()
+	if err != nil {
+		return nil, err
+	}
+
+	info := new(Info)
+	if info.LastCommit.Hash, info.LastCommit.Time, err = r.LastCommit(branch); err != nil {
+		return nil, err
+	}
+	if info.Readme, err = r.readme(branch); err != nil && !errors.Is(err, ErrNoFile) {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (r *Gitea) readme(branch string) (string, error) {
+	// the file name isn't case sensitive for us, list the directory to find it
+	var files []giteaContent
+	if err := r.get("/contents", url.Values{"ref": {branch}}, &files); err != nil {
+		return "", err
+	}
+
+	var path string
+	for _, f := range files {
+		if f.Type == "file" && strings.EqualFold(f.Name, "readme.md") {
+			path = f.Path
+			break
+		}
+	}
+	if path == "" {
+		return "", ErrNoFile
+	}
+
+	resp, err := r.do("/raw/"+url.PathEscape(path), url.Values{"ref": {branch}})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, giteaMaxReadme))
+	if err != nil {
+		return "", err
+	}
+	if len(b) == 0 {
+		return "", ErrNoFile
+	}
+
+	return string(b), nil
+}
+
+// get requests an endpoint of the repository and decodes the json response into v
+func (r *Gitea) get(endpoint string, query url.Values, v interface{}) error {
+	resp, err := r.do(endpoint, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (r *Gitea) do(endpoint string, query url.Values) (*http.Response, error) {
+	u := fmt.Sprintf("%s/api/v1/repos/%s/%s%s", strings.TrimSuffix(r.BaseURL, "/"), url.PathEscape(r.Owner), url.PathEscape(r.Name), endpoint)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.AuthToken != "" {
+		req.Header.Set("Authorization", "token "+r.AuthToken)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		err = ErrBadCredentials
+	case http.StatusNotFound:
+		// gitea doesn't tell apart missing repositories, branches and files
+		err = ErrNoFile
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnexpectedResponse, resp.Status)
+	}
+
+	resp.Body.Close()
+	return nil, err
+}
@@ -0,0 +1,89 @@
+package repo
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// giteaStandIn serves the parts of the Gitea API the provider uses for the repository edea/ldo
+func giteaStandIn(t *testing.T, files string) *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/git/api/v1/repos/edea/ldo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id": 7, "full_name": "edea/ldo", "description": "3V3 LDO", "default_branch": "main", "stars_count": 3}`))
+	})
+	mux.HandleFunc("/git/api/v1/repos/edea/ldo/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "main", "commit": {"id": "0123abcd", "timestamp": "2022-10-01T12:00:00Z"}}`))
+	})
+	mux.HandleFunc("/git/api/v1/repos/edea/ldo/contents", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != "main" {
+			t.Errorf("unexpected ref %q", r.URL.Query().Get("ref"))
+		}
+		w.Write([]byte(files))
+	})
+	mux.HandleFunc("/git/api/v1/repos/edea/ldo/raw/README.md", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# LDO"))
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestGitea_Info(t *testing.T) {
+	srv := giteaStandIn(t, `[{"name": "README.md", "path": "README.md", "type": "file"}, {"name": "ldo", "path": "ldo", "type": "dir"}]`)
+	defer srv.Close()
+
+	g, err := NewGitea(srv.URL + "/git/edea/ldo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.AuthToken = "secret"
+
+	repo, err := g.Repository()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.FullName != "edea/ldo" || repo.Stars != 3 {
+		t.Errorf("unexpected repository %+v", repo)
+	}
+
+	info, err := g.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.LastCommit.Hash != "0123abcd" || info.LastCommit.Time.Year() != 2022 {
+		t.Errorf("unexpected last commit %+v", info.LastCommit)
+	}
+	if info.Readme != "# LDO" {
+		t.Errorf("unexpected readme %q", info.Readme)
+	}
+}
+
+func TestGitea_NoReadme(t *testing.T) {
+	srv := giteaStandIn(t, `[{"name": "ldo", "path": "ldo", "type": "dir"}]`)
+	defer srv.Close()
+
+	g := Gitea{BaseURL: srv.URL + "/git", Owner: "edea", Name: "ldo", AuthToken: "secret"}
+
+	if _, err := g.Readme(); !errors.Is(err, ErrNoFile) {
+		t.Fatalf("expected ErrNoFile, got %v", err)
+	}
+}
+
+func TestGitea_BadCredentials(t *testing.T) {
+	srv := giteaStandIn(t, `[]`)
+	defer srv.Close()
+
+	g := Gitea{BaseURL: srv.URL + "/git", Owner: "edea", Name: "ldo", AuthToken: "wrong"}
+
+	if _, err := g.DefaultBranch(); !errors.Is(err, ErrBadCredentials) {
+		t.Fatalf("expected ErrBadCredentials, got %v", err)
+	}
+}
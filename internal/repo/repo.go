@@ -49,8 +49,10 @@ func Add(url string) error {
 	return cache.Add(url)
 }
 
-func InitCache(path string) {
-	cache = &RepoCache{Base: path}
+// InitCache sets up the repository cache in path, repositories no module needs are
+// evicted when it grows above maxSize bytes. A maxSize of zero disables eviction.
+func InitCache(path string, maxSize int64) {
+	cache = &RepoCache{Base: path, MaxSize: maxSize}
 }
 
 func GetModulePath(mod *model.Module) (string, error) {
@@ -79,13 +81,118 @@ func GetModulePath(mod *model.Module) (string, error) {
 
 	v, ok := p.Modules[mod.Sub]
 	if !ok {
-		err := errors.New("sub-module specified but does not exist")
-		zap.L().Panic("the sub-module key in the database does not exist in the repo edea.yml", zap.Error(err))
+		return "", util.HintError{
+			Hint: fmt.Sprintf("The sub-module \"%s\" does not exist in edea.yml, check the file for problems with the lint tool.", mod.Sub),
+			Err:  util.ErrNoSuchModule,
+		}
 	}
 
 	repoDir, _ := g.Dir() // at this point we already know the it's cached
-	dir := strings.ReplaceAll(v.Directory, "../", "")
-	dir = strings.TrimPrefix(dir, "/")
-	dir = filepath.Join(repoDir, dir)
-	return dir, nil
+	return moduleDir(repoDir, v.Directory)
+}
+
+// ReadProject fetches the latest changes of a public repository, adding it to the cache
+// if necessary, and returns its parsed edea.yml
+func ReadProject(url string) (*Project, error) {
+	if err := CheckPublic(url); err != nil {
+		return nil, err
+	}
+
+	if err := New(url); err != nil && !errors.Is(err, ErrExists) {
+		return nil, err
+	}
+
+	g := &Git{URL: url}
+	if err := g.Pull(); err != nil {
+		return nil, err
+	}
+
+	return parseProject(g)
+}
+
+// CachedProject returns the parsed edea.yml of a public repository as it was last fetched,
+// without going to the network. ErrUncachedRepo is returned if it was never read before.
+func CachedProject(url string) (*Project, error) {
+	if err := CheckPublic(url); err != nil {
+		return nil, err
+	}
+
+	found, err := cache.Has(url)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrUncachedRepo
+	}
+
+	return parseProject(&Git{URL: url})
+}
+
+func parseProject(g *Git) (*Project, error) {
+	s, err := g.File("edea.yml", false)
+	if err != nil {
+		return nil, util.HintError{
+			Hint: "The repository does not contain an edea.yml file, add the module with the regular form instead.",
+			Err:  err,
+		}
+	}
+
+	p := &Project{}
+	if err := yaml.Unmarshal([]byte(s), p); err != nil {
+		return nil, util.HintError{
+			Hint: "Could not parse edea.yml, try checking if the syntax is correct.",
+			Err:  err,
+		}
+	}
+
+	return p, nil
+}
+
+// ExportModuleAt exports the repository of a module at the given revision into dest
+// and returns the path of the module project files inside of it
+func ExportModuleAt(mod *model.Module, revision, dest string) (string, error) {
+	g := &Git{URL: mod.RepoURL}
+	p := &Project{}
+
+	if err := g.ExportTreeAt(dest, revision); err != nil {
+		return "", fmt.Errorf("could not export %s at %s: %w", mod.RepoURL, revision, err)
+	}
+
+	// read and parse the module configuration at that revision
+	b, err := g.FileAt("edea.yml", false, revision)
+	if err != nil || mod.Sub == "" {
+		// assuming old format, i.e. no sub-modules
+		return dest, nil
+	}
+	if err := yaml.Unmarshal(b, p); err != nil {
+		return "", util.HintError{
+			Hint: fmt.Sprintf("Could not parse edea.yml for \"%s\" at revision %s\nTry checking if the syntax is correct.", mod.Name, revision),
+			Err:  err,
+		}
+	}
+
+	v, ok := p.Modules[mod.Sub]
+	if !ok {
+		return "", util.HintError{
+			Hint: fmt.Sprintf("The sub-module \"%s\" does not exist in edea.yml at revision %s", mod.Sub, revision),
+			Err:  util.ErrNoSuchModule,
+		}
+	}
+
+	return moduleDir(dest, v.Directory)
+}
+
+// moduleDir returns the directory of a sub-module inside of root, edea.yml must not point outside of it
+func moduleDir(root, dir string) (string, error) {
+	root = filepath.Clean(root)
+	path := filepath.Join(root, dir)
+
+	if path != root && !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return "", util.HintError{
+			Hint: fmt.Sprintf("The directory \"%s\" in edea.yml is outside of the repository", dir),
+			Err:  util.ErrNoSuchModule,
+		}
+	}
+
+	return path, nil
 }
@@ -3,14 +3,16 @@ package repo
 // SPDX-License-Identifier: EUPL-1.2
 
 import (
+	"context"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/glebarez/sqlite"
 	"github.com/kelseyhightower/envconfig"
 	"gitlab.com/edea-dev/edea-server/internal/config"
 	"gitlab.com/edea-dev/edea-server/internal/model"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
@@ -22,20 +24,54 @@ func TestMain(m *testing.M) {
 		os.Exit(1)
 	}
 
-	// start connection pool
-	dsn := "host=192.168.0.2 user=edea password=edea dbname=edea port=5432 sslmode=disable"
-	model.DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// a throwaway sqlite database, no need for a running postgres
+	dir, err := os.MkdirTemp("", "edea-repo-test")
+	if err != nil {
+		log.Panic(err)
+	}
 
-	if result := model.DB.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp";`); result.Error != nil {
-		log.Panic("failed to create uuid-ossp extension")
-		os.Exit(1)
+	model.DB, err = gorm.Open(sqlite.Open(filepath.Join(dir, "edea.db")), &gorm.Config{})
+	if err != nil {
+		log.Panic(err)
+	}
+	if err := model.RegisterCallbacks(model.DB); err != nil {
+		log.Panic(err)
 	}
 
-	model.CreateTables()
+	if _, err := model.MigrateUp(context.Background(), 0); err != nil {
+		log.Panic("failed to migrate the database", err)
+	}
 
 	cache = &RepoCache{Base: "./tmp/git"}
 
 	code := m.Run()
 
+	// os.Exit skips deferred calls
+	os.RemoveAll(dir)
 	os.Exit(code)
 }
+
+func TestRepo_ModuleDir(t *testing.T) {
+	root := filepath.Join("tmp", "export")
+
+	for dir, want := range map[string]string{
+		"3v3ldo":          filepath.Join(root, "3v3ldo"),
+		"/3v3ldo/":        filepath.Join(root, "3v3ldo"),
+		"a/../3v3ldo":     filepath.Join(root, "3v3ldo"),
+		"":                root,
+		"../other":        "",
+		"....//":          filepath.Join(root, "...."),
+		"a/../../..//etc": "",
+	} {
+		got, err := moduleDir(root, dir)
+		if want == "" {
+			if err == nil {
+				t.Errorf("moduleDir(%q) = %q, want an error", dir, got)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("moduleDir(%q) = %q, %v, want %q", dir, got, err, want)
+		}
+	}
+}
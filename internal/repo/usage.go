@@ -0,0 +1,216 @@
+package repo
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"go.uber.org/zap"
+)
+
+const (
+	// usage is written to the database at most this often per repository
+	touchInterval = time.Minute
+	// repositories used more recently than this are never evicted, someone might be looking at them
+	evictGrace = time.Hour
+
+	// a repository is referenced as long as a module, a bench or a snapshot needs it
+	referencedRepository = `exists (select 1 from modules m where m.repo_url = repositories.url and (m.deleted_at is null
+		or exists (select 1 from bench_modules bm where bm.module_id = m.id and bm.deleted_at is null)
+		or exists (select 1 from bench_snapshot_modules sm where sm.module_id = m.id)))`
+)
+
+var (
+	usedMu sync.Mutex
+	usedAt = make(map[string]time.Time)
+)
+
+// CacheEntry is a cached repository and what it's used by
+type CacheEntry struct {
+	model.Repository `gorm:"embedded"`
+	Modules          int64 // modules registered with the repository
+	Referenced       bool  // needed by a module, bench or snapshot, these are never evicted
+}
+
+// CacheUsage is the disk usage of the repository cache
+type CacheUsage struct {
+	Total   int64 // bytes
+	Limit   int64 // bytes, zero if there is none
+	Entries []CacheEntry
+}
+
+// Usage lists the cached repositories, largest first
+func Usage() (*CacheUsage, error) {
+	u := &CacheUsage{Limit: cache.MaxSize, Entries: []CacheEntry{}}
+
+	result := model.DB.Model(&model.Repository{}).
+		Select("repositories.*, " +
+			"(select count(*) from modules m where m.repo_url = repositories.url and m.deleted_at is null) as modules, " +
+			referencedRepository + " as referenced").
+		Order("size desc").
+		Scan(&u.Entries)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	for _, e := range u.Entries {
+		u.Total += e.Size
+	}
+
+	return u, nil
+}
+
+// Evict removes the least recently used repositories which nothing references
+// until the cache is no larger than the configured limit
+func Evict() ([]model.Repository, error) {
+	if cache.MaxSize <= 0 {
+		return nil, nil
+	}
+	return cache.Evict(cache.MaxSize)
+}
+
+// EvictUnused removes all repositories which nothing references
+func EvictUnused() ([]model.Repository, error) {
+	return cache.Evict(0)
+}
+
+// Evict removes the least recently used repositories which nothing references until
+// the cache is no larger than limit bytes
+func (c *RepoCache) Evict(limit int64) ([]model.Repository, error) {
+	var total int64
+
+	result := model.DB.Model(&model.Repository{}).Select("coalesce(sum(size), 0)").Scan(&total)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if total <= limit {
+		return nil, nil
+	}
+
+	var candidates []model.Repository
+
+	result = model.DB.Where("not "+referencedRepository).
+		Where("coalesce(used_at, created_at) < ?", time.Now().Add(-evictGrace)).
+		Order("coalesce(used_at, created_at)").
+		Find(&candidates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var evicted []model.Repository
+
+	for _, r := range candidates {
+		if total <= limit {
+			break
+		}
+
+		if err := c.remove(&r); err != nil {
+			return evicted, err
+		}
+
+		total -= r.Size
+		evicted = append(evicted, r)
+
+		zap.L().Info("evicted repository from the cache", zap.String("url", r.URL), zap.Int64("size", r.Size))
+	}
+
+	return evicted, nil
+}
+
+func (c *RepoCache) remove(r *model.Repository) error {
+	// urls which map to the same path share the clone, it's only removed with the last of them
+	var shared int64
+	if result := model.DB.Model(&model.Repository{}).Where("location = ? AND id <> ?", r.Location, r.ID).Count(&shared); result.Error != nil {
+		return result.Error
+	}
+
+	if shared == 0 {
+		if err := c.removeDir(r.Location); err != nil {
+			return fmt.Errorf("could not remove %s: %w", r.URL, err)
+		}
+	}
+
+	usedMu.Lock()
+	delete(usedAt, r.URL)
+	usedMu.Unlock()
+
+	return model.DB.Delete(r).Error
+}
+
+func (c *RepoCache) removeDir(path string) error {
+	// never delete anything outside of the cache, whatever the database says
+	base, err := filepath.Abs(c.Base)
+	if err != nil {
+		return err
+	}
+	loc, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(loc, base+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside of the cache", path)
+	}
+
+	return os.RemoveAll(loc)
+}
+
+// UpdateSizes recalculates the disk usage of all cached repositories
+func UpdateSizes() error {
+	var repos []model.Repository
+
+	if result := model.DB.Find(&repos); result.Error != nil {
+		return result.Error
+	}
+
+	for _, r := range repos {
+		if err := updateSize(&r); err != nil {
+			zap.L().Warn("could not update repository size", zap.Error(err), zap.String("url", r.URL))
+		}
+	}
+
+	return nil
+}
+
+// UpdateSize recalculates the disk usage of a cached repository, e.g. after fetching new commits
+func UpdateSize(url string) error {
+	r := new(model.Repository)
+
+	if result := model.DB.Where("url = ?", url).First(r); result.Error != nil {
+		return result.Error
+	}
+
+	return updateSize(r)
+}
+
+func updateSize(r *model.Repository) error {
+	size, err := (&GitRepository{URL: r.URL, Path: r.Location}).Size()
+	if err != nil {
+		return err
+	}
+
+	return model.DB.Model(r).UpdateColumn("size", size).Error
+}
+
+// touch records that a repository was used, for evicting the least recently used ones first
+func touch(url string) {
+	now := time.Now()
+
+	usedMu.Lock()
+	if now.Sub(usedAt[url]) < touchInterval {
+		usedMu.Unlock()
+		return
+	}
+	usedAt[url] = now
+	usedMu.Unlock()
+
+	result := model.DB.Model(&model.Repository{}).Where("url = ?", url).UpdateColumn("used_at", now)
+	if result.Error != nil {
+		zap.L().Warn("could not record repository usage", zap.Error(result.Error), zap.String("url", url))
+	}
+}
@@ -0,0 +1,319 @@
+package search
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"encoding/json"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Database keeps the search index in a table of the database, on PostgreSQL its full text
+// search finds and ranks the hits, on SQLite the words only need to appear somewhere
+type Database struct{}
+
+// NewDatabase returns the database search backend, the table is created by a migration
+func NewDatabase() *Database {
+	return &Database{}
+}
+
+// Update adds or replaces entries
+func (d *Database) Update(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	rows := make([]model.SearchEntry, len(entries))
+	for i, e := range entries {
+		rows[i] = toSearchEntry(e)
+	}
+
+	return model.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&rows).Error
+}
+
+// Delete removes entries
+func (d *Database) Delete(ids ...string) error {
+	return model.DB.Where("id IN ?", ids).Delete(&model.SearchEntry{}).Error
+}
+
+// Replace swaps the whole index in one transaction
+func (d *Database) Replace(entries []Entry) error {
+	rows := make([]model.SearchEntry, len(entries))
+	for i, e := range entries {
+		rows[i] = toSearchEntry(e)
+	}
+
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&model.SearchEntry{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&rows, 500).Error
+	})
+}
+
+// Documents returns everything in the index, without tags and metadata
+func (d *Database) Documents() ([]Entry, error) {
+	var rows []model.SearchEntry
+
+	if err := model.DB.Select("id", "type", "name", "user_id", "public").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, len(rows))
+	for i, r := range rows {
+		entries[i] = fromSearchEntry(r)
+	}
+
+	return entries, nil
+}
+
+// sortOrders are the ORDER BY clauses of Sorts
+var sortOrders = map[string]string{
+	"updated_at:desc": "updated_at DESC, name",
+	"updated_at:asc":  "updated_at, name",
+	"popularity:desc": "popularity DESC, name",
+	"name:asc":        "name",
+}
+
+// Query finds the entries which contain all the words of the query, the last one might be
+// incomplete as it's a search as you type. Without words all entries match the filters.
+func (d *Database) Query(q Query) (*Result, error) {
+	r := &Result{Query: q.Text, Hits: []Hit{}, Facets: map[string]map[string]int64{}}
+
+	terms := queryTerms(q.Text)
+	if len(terms) == 0 && len(q.Filters) == 0 {
+		return r, nil
+	}
+
+	tx := model.DB.Model(&model.SearchEntry{})
+	if q.UserID != "" {
+		tx = tx.Where("public = ? OR user_id = ?", true, q.UserID)
+	} else {
+		tx = tx.Where("public = ?", true)
+	}
+
+	order := clause.Expr{SQL: "name"}
+
+	switch {
+	case len(terms) == 0:
+	case model.SQLite(tx):
+		for _, t := range terms {
+			p := "%" + escapeLike(t) + "%"
+			tx = tx.Where(`(lower(name) LIKE ? ESCAPE '\' OR lower(author) LIKE ? ESCAPE '\' OR lower(description) LIKE ? ESCAPE '\')`, p, p, p)
+		}
+	default:
+		tsq := tsQuery(terms)
+		tx = tx.Where("document @@ to_tsquery('simple', ?)", tsq)
+		order = clause.Expr{SQL: "ts_rank(document, to_tsquery('simple', ?)) DESC, name", Vars: []interface{}{tsq}}
+	}
+
+	if o, ok := sortOrders[q.Sort]; ok {
+		order = clause.Expr{SQL: o}
+	}
+
+	for _, f := range Facets {
+		values := q.Filters[f]
+		switch {
+		case len(values) == 0:
+		case f == FacetTags && model.SQLite(tx):
+			tx = tx.Where("EXISTS (SELECT 1 FROM json_each(search_entries.tags) WHERE json_each.value IN ?)", values)
+		case f == FacetTags:
+			tx = tx.Where("EXISTS (SELECT 1 FROM jsonb_array_elements_text(search_entries.tags) AS tag WHERE tag IN ?)", values)
+		default:
+			// the facets are columns
+			tx = tx.Where(clause.IN{Column: clause.Column{Name: f}, Values: stringValues(values)})
+		}
+	}
+
+	// shared by the facets, the count and the query
+	tx = tx.Session(&gorm.Session{})
+
+	if err := tx.Count(&r.Total).Error; err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Facets, err = countFacets(tx); err != nil {
+		return nil, err
+	}
+
+	var rows []model.SearchEntry
+	// Order ignores expressions with variables
+	if err := tx.Clauses(clause.OrderBy{Expression: order}).Limit(q.Limit).Offset(q.Offset).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	hl := func(s string) string { return html.EscapeString(s) }
+	if len(terms) > 0 {
+		hl = highlighter(terms)
+	}
+
+	for _, row := range rows {
+		e := fromSearchEntry(row)
+		r.Hits = append(r.Hits, Hit{
+			Entry: e,
+			Formatted: map[string]interface{}{
+				"id":          e.ID,
+				"type":        hl(e.Type),
+				"name":        hl(e.Name),
+				"description": hl(e.Description),
+				"author":      hl(e.Author),
+			},
+		})
+	}
+
+	return r, nil
+}
+
+// facetCount is the number of hits with a value of a facet
+type facetCount struct {
+	Value string
+	Count int64
+}
+
+// countFacets counts the hits of a query by the values of their facets like MeiliSearch does,
+// the tags are a JSON list which is expanded into one row per tag
+func countFacets(tx *gorm.DB) (map[string]map[string]int64, error) {
+	facets := make(map[string]map[string]int64, len(Facets))
+
+	for _, f := range Facets {
+		var q *gorm.DB
+		switch {
+		case f == FacetTags && model.SQLite(tx):
+			q = model.DB.Table("(?) AS hits, json_each(hits.tags) AS tag", tx.Select("tags")).
+				Select("tag.value AS value, COUNT(*) AS count").Group("tag.value")
+		case f == FacetTags:
+			q = model.DB.Table("(?) AS hits, jsonb_array_elements_text(hits.tags) AS tag", tx.Select("tags")).
+				Select("tag AS value, COUNT(*) AS count").Group("tag")
+		default:
+			col := clause.Column{Name: f}
+			q = tx.Select("? AS value, COUNT(*) AS count", col).Where("? <> ''", col).Group(f)
+		}
+
+		var counts []facetCount
+		if err := q.Scan(&counts).Error; err != nil {
+			return nil, err
+		}
+
+		facets[f] = make(map[string]int64, len(counts))
+		for _, c := range counts {
+			facets[f][c.Value] = c.Count
+		}
+	}
+
+	return facets, nil
+}
+
+func stringValues(values []string) []interface{} {
+	v := make([]interface{}, len(values))
+	for i, s := range values {
+		v[i] = s
+	}
+	return v
+}
+
+func toSearchEntry(e Entry) model.SearchEntry {
+	var tags []byte
+	if len(e.Tags) > 0 {
+		tags, _ = json.Marshal(e.Tags)
+	}
+
+	return model.SearchEntry{
+		ID:          e.ID,
+		Type:        e.Type,
+		Name:        e.Name,
+		Description: e.Description,
+		Author:      e.Author,
+		UserID:      e.UserID,
+		Public:      e.Public,
+		Category:    e.Category,
+		Tags:        tags,
+		Popularity:  e.Popularity,
+		Metadata:    e.Metadata,
+		UpdatedAt:   time.Unix(e.UpdatedAt, 0),
+	}
+}
+
+func fromSearchEntry(r model.SearchEntry) Entry {
+	var tags []string
+	if len(r.Tags) > 0 {
+		_ = json.Unmarshal(r.Tags, &tags)
+	}
+
+	e := Entry{
+		ID:          r.ID,
+		Type:        r.Type,
+		Name:        r.Name,
+		Description: r.Description,
+		Author:      r.Author,
+		UserID:      r.UserID,
+		Public:      r.Public,
+		Category:    r.Category,
+		Tags:        tags,
+		Popularity:  r.Popularity,
+		Metadata:    r.Metadata,
+	}
+	if !r.UpdatedAt.IsZero() {
+		e.UpdatedAt = r.UpdatedAt.Unix()
+	}
+
+	return e
+}
+
+// queryTerms splits a query into lower case words
+func queryTerms(q string) []string {
+	return strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// tsQuery matches entries with all the terms as prefixes of their words,
+// the terms only consist of letters and digits so they need no quoting
+func tsQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = t + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// highlighter returns a function which HTML escapes a text and wraps the terms in <em>
+func highlighter(terms []string) func(string) string {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	re := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+
+	return func(s string) string {
+		var sb strings.Builder
+
+		last := 0
+		for _, m := range re.FindAllStringIndex(s, -1) {
+			sb.WriteString(html.EscapeString(s[last:m[0]]))
+			sb.WriteString("<em>")
+			sb.WriteString(html.EscapeString(s[m[0]:m[1]]))
+			sb.WriteString("</em>")
+			last = m[1]
+		}
+		sb.WriteString(html.EscapeString(s[last:]))
+
+		return sb.String()
+	}
+}
@@ -2,236 +2,250 @@ package search
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"net/http"
+	"html"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/gin-gonic/gin"
 	meilisearch "github.com/meilisearch/meilisearch-go"
-	"gitlab.com/edea-dev/edea-server/internal/config"
-	"gitlab.com/edea-dev/edea-server/internal/model"
-	"gitlab.com/edea-dev/edea-server/internal/view"
 	"go.uber.org/zap"
 )
 
-// Entry for the search index, expand with necessary data
-type Entry struct {
-	ID          string                 `json:"id"`
-	Type        string                 `json:"type"`
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	Author      string                 `json:"author"`
-	UserID      string                 `json:"user_id"`
-	Public      bool                   `json:"public"`
-	Tags        map[string]string      `json:"tags"`
-	Metadata    map[string]interface{} `json:"metadata"`
-}
+// MeiliSearch marks the matches with these instead of <em>, the values are only safe to show once
+// they are HTML escaped and the markers replaced
+const (
+	highlightPre  = "\uE000"
+	highlightPost = "\uE001"
+)
 
-var meiliClient meilisearch.ClientInterface
+var highlightTags = strings.NewReplacer(highlightPre, "<em>", highlightPost, "</em>")
 
-// Init connects to the MeiliSearch instance and creates
-// the index if it does not yet exist
-func Init(host, index, apiKey string) error {
-	meiliClient = meilisearch.NewClient(meilisearch.ClientConfig{
-		Host:   host,
-		APIKey: apiKey,
-	})
+// Meili keeps the search index in MeiliSearch
+type Meili struct {
+	client meilisearch.ClientInterface
+	index  string
+
+	mu    sync.Mutex
+	ready bool // index created and configured
+}
+
+// NewMeili connects to the MeiliSearch instance and creates the index if it does not yet exist.
+// If MeiliSearch isn't up within a second, setting up the index is left to the first update.
+func NewMeili(host, index, apiKey string) (*Meili, error) {
+	m := &Meili{
+		client: meilisearch.NewClient(meilisearch.ClientConfig{
+			Host:   host,
+			APIKey: apiKey,
+		}),
+		index: index,
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	for {
-		if !meiliClient.IsHealthy() {
-			zap.S().Info("meilisearch not ready yet")
-			select {
-			case <-ctx.Done():
-				zap.L().Warn("timed out waiting for meilisearch")
-				meiliClient = nil
-				return nil
-			case <-time.After(time.Second):
-			}
-		} else {
-			break
+	for !m.client.IsHealthy() {
+		zap.S().Info("meilisearch not ready yet")
+		select {
+		case <-ctx.Done():
+			zap.L().Error("timed out waiting for meilisearch, searches fail until it's up", zap.String("host", host))
+			return m, nil
+		case <-time.After(100 * time.Millisecond):
 		}
 	}
 
+	return m, m.setup()
+}
+
+// setup creates and configures the index once MeiliSearch is reachable
+func (m *Meili) setup() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ready {
+		return nil
+	}
+
 	// Create an index if your index does not already exist
-	_, err := meiliClient.CreateIndex(&meilisearch.IndexConfig{Uid: index})
+	if _, err := m.client.CreateIndex(&meilisearch.IndexConfig{Uid: m.index}); err != nil {
+		return err
+	}
 
-	if err != nil {
+	filterable := append([]string{"user_id", "public"}, Facets...)
+	if _, err := m.client.Index(m.index).UpdateFilterableAttributes(&filterable); err != nil {
 		return err
 	}
 
-	_, err = meiliClient.Index(index).UpdateFilterableAttributes(&[]string{
-		"user_id",
-		"public",
+	_, err := m.client.Index(m.index).UpdateSortableAttributes(&[]string{
+		"updated_at",
+		"popularity",
+		"name",
 	})
+	m.ready = err == nil
 
 	return err
 }
 
-// BenchToEntry converts a Bench model to a Search Entry
-func BenchToEntry(b model.Bench) Entry {
-	return Entry{
-		ID:          b.ID.String(),
-		Type:        "bench",
-		Name:        b.Name,
-		Description: b.Description,
-		Author:      b.User.Handle,
-		UserID:      b.UserID.String(),
-		Public:      b.Public,
+// Update adds or replaces entries
+func (m *Meili) Update(entries ...Entry) error {
+	if err := m.setup(); err != nil {
+		return err
 	}
-}
 
-// ModuleToEntry converts a Module model to a Search Entry
-func ModuleToEntry(m model.Module) Entry {
-	return Entry{
-		ID:          m.ID.String(),
-		Type:        "module",
-		Name:        m.Name,
-		Description: m.Description,
-		Author:      m.User.Handle,
-		UserID:      m.UserID.String(),
-		Public:      !m.Private,
-		Tags:        map[string]string{"category": m.Category.Name},
-		Metadata:    m.Metadata,
+	res, err := m.client.Index(m.index).UpdateDocuments(entries)
+	if err != nil {
+		return err
 	}
-}
-
-// ReIndexDB searches for all public entries and puts them into the database
-//
-//	This route is mainly for testing
-func ReIndexDB(c *gin.Context) {
-	var benches []model.Bench
-	var modules []model.Module
-	var documents []Entry
 
-	result := model.DB.Model(&model.Bench{}).Preload("User").Find(&benches)
-	if result.Error != nil {
-		zap.L().Panic("could not fetch all public benches", zap.Error(result.Error))
-		zap.L().Panic("", zap.Error(result.Error))
-	}
+	zap.L().Debug("entry update", zap.Int64("meili_update_id", res.TaskUID))
+	return nil
+}
 
-	for _, b := range benches {
-		documents = append(documents, BenchToEntry(b))
+// Delete removes entries
+func (m *Meili) Delete(ids ...string) error {
+	if err := m.setup(); err != nil {
+		return err
 	}
 
-	result = model.DB.Model(&model.Module{}).Preload("Category").Preload("User").Find(&modules)
-	if result.Error != nil {
-		zap.L().Panic("could not fetch all public modules", zap.Error(result.Error))
-	}
+	_, err := m.client.Index(m.index).DeleteDocuments(ids)
+	return err
+}
 
-	for _, m := range modules {
-		documents = append(documents, ModuleToEntry(m))
+// Replace clears the index before adding all the entries
+func (m *Meili) Replace(entries []Entry) error {
+	if err := m.setup(); err != nil {
+		return err
 	}
 
-	// clear whole index before inserting new documents
-	_, err := meiliClient.Index(config.Cfg.Search.Index).DeleteAllDocuments()
-	if err != nil {
-		zap.L().Panic("could not clear index", zap.Error(err))
+	if _, err := m.client.Index(m.index).DeleteAllDocuments(); err != nil {
+		return fmt.Errorf("could not clear index: %w", err)
 	}
 
-	updateRes, err := meiliClient.Index(config.Cfg.Search.Index).AddDocuments(documents) // => { "updateId": 0 }
+	res, err := m.client.Index(m.index).AddDocuments(entries)
 	if err != nil {
-		zap.L().Panic("could not add/update the search index in bulk", zap.Error(result.Error))
+		return err
 	}
 
-	zap.L().Debug("bulk update", zap.Int64("meili_update_id", updateRes.TaskUID))
-	c.String(http.StatusOK, "bulk update update_id: %d", updateRes.TaskUID)
+	zap.L().Debug("bulk update", zap.Int64("meili_update_id", res.TaskUID))
+	return nil
 }
 
-// UpdateEntry adds or updates a single search entry
-func UpdateEntry(e Entry) error {
-	// gracefully ignore but warn if meilisearch doesn't work
-	if meiliClient == nil {
-		zap.L().Warn("meilisearch not initialized")
-		return nil
-	}
+// Documents returns everything in the index, without tags and metadata
+func (m *Meili) Documents() ([]Entry, error) {
+	var entries []Entry
 
-	updateRes, err := meiliClient.Index(config.Cfg.Search.Index).UpdateDocuments([]Entry{e})
-	if err != nil {
-		return fmt.Errorf("could not add/update the search index: %w", err)
+	if err := m.setup(); err != nil {
+		return nil, err
 	}
 
-	zap.L().Debug("single entry update", zap.Int64("meili_update_id", updateRes.TaskUID))
-	return nil
-}
+	const limit = 1000
 
-// DeleteEntry removes an Entry from the search index
-func DeleteEntry(e Entry) error {
-	// gracefully ignore but warn if meilisearch doesn't work
-	if meiliClient == nil {
-		zap.L().Warn("meilisearch not initialized")
-		return nil
-	}
+	for offset := int64(0); ; offset += limit {
+		var res meilisearch.DocumentsResult
 
-	_, err := meiliClient.Index(config.Cfg.Search.Index).DeleteDocument(e.ID)
-	if err != nil {
-		return fmt.Errorf("could not delete the entry: %w", err)
-	}
+		err := m.client.Index(m.index).GetDocuments(&meilisearch.DocumentsQuery{
+			Offset: offset,
+			Limit:  limit,
+			Fields: []string{"id", "type", "name", "user_id", "public"},
+		}, &res)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch the indexed documents: %w", err)
+		}
 
-	return nil
+		for _, doc := range res.Results {
+			e := Entry{}
+			e.ID, _ = doc["id"].(string)
+			e.Type, _ = doc["type"].(string)
+			e.Name, _ = doc["name"].(string)
+			e.UserID, _ = doc["user_id"].(string)
+			e.Public, _ = doc["public"].(bool)
+			entries = append(entries, e)
+		}
+
+		if int64(len(res.Results)) < limit {
+			return entries, nil
+		}
+	}
 }
 
-func Search(c *gin.Context) {
-	var filter, q string
-	m := make(map[string]interface{})
+// Query searches the index, the hits are highlighted and the facets counted by MeiliSearch
+func (m *Meili) Query(q Query) (*Result, error) {
+	if err := m.setup(); err != nil {
+		return nil, err
+	}
 
-	isAjax := strings.Contains(c.GetHeader("accept"), "application/json")
+	filter := []string{"public = true"}
+	if q.UserID != "" {
+		filter[0] = fmt.Sprintf("(user_id = %q OR public = true)", q.UserID)
+	}
+	for _, f := range Facets {
+		if values := q.Filters[f]; len(values) > 0 {
+			or := make([]string, len(values))
+			for i, v := range values {
+				or[i] = fmt.Sprintf("%s = %q", f, v)
+			}
+			filter = append(filter, "("+strings.Join(or, " OR ")+")")
+		}
+	}
 
-	// allow GET and POST
-	if c.Request.Method == "GET" {
-		q = c.Query("q")
-	} else {
-		q = c.PostForm("q")
+	req := &meilisearch.SearchRequest{
+		AttributesToHighlight: []string{"*"},
+		HighlightPreTag:       highlightPre,
+		HighlightPostTag:      highlightPost,
+		Filter:                strings.Join(filter, " AND "),
+		Facets:                Facets,
+		Limit:                 int64(q.Limit),
+		Offset:                int64(q.Offset),
+	}
+	if q.Sort != "" {
+		req.Sort = []string{q.Sort}
 	}
 
-	if meiliClient == nil {
-		m["Error"] = fmt.Errorf("MeiliSeach isn't running")
-		if isAjax {
-			c.JSON(http.StatusInternalServerError, m)
-		} else {
-			view.RenderTemplate(c, "search.tmpl", "EDeA - Search", m)
-		}
-		return
+	res, err := m.client.Index(m.index).Search(q.Text, req)
+	if err != nil {
+		return nil, err
 	}
 
-	if q != "" {
-		// check if the user is logged in to include private results
-		v, ok := c.Keys["user"]
-		if ok {
-			id := v.(*model.User).ID.String()
-			filter = fmt.Sprintf("user_id = %s OR public = true", id)
-		} else {
-			filter = "public = true"
-		}
+	// the hits and facets are plain JSON objects
+	b, err := json.Marshal(res.Hits)
+	if err != nil {
+		return nil, err
+	}
 
-		searchRes, err := meiliClient.Index(config.Cfg.Search.Index).Search(q,
-			&meilisearch.SearchRequest{
-				AttributesToHighlight: []string{"*"},
-				Filter:                filter,
-			})
+	r := &Result{Query: q.Text, Total: res.EstimatedTotalHits, Hits: []Hit{}, Facets: map[string]map[string]int64{}}
+	if err := json.Unmarshal(b, &r.Hits); err != nil {
+		return nil, err
+	}
+	for _, h := range r.Hits {
+		escapeHighlights(h.Formatted)
+	}
 
-		if err != nil {
-			zap.L().Error("search error", zap.Error(err), zap.String("query", q))
-			c.String(http.StatusInternalServerError, "err")
-			return
+	if res.FacetDistribution != nil {
+		if b, err = json.Marshal(res.FacetDistribution); err != nil {
+			return nil, err
 		}
-
-		// check if it's an AJAX request
-		if isAjax {
-			c.JSON(http.StatusOK, searchRes)
-			return
+		if err := json.Unmarshal(b, &r.Facets); err != nil {
+			return nil, err
 		}
-
-		m["Result"] = searchRes
 	}
 
-	if isAjax {
-		c.Status(http.StatusNoContent)
-		return
-	}
+	return r, nil
+}
 
-	view.RenderTemplate(c, "search.tmpl", "EDeA - Search", m)
+// escapeHighlights HTML escapes the formatted values of a hit and turns the highlight markers into <em>
+func escapeHighlights(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return highlightTags.Replace(html.EscapeString(v))
+	case []interface{}:
+		for i := range v {
+			v[i] = escapeHighlights(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = escapeHighlights(v[k])
+		}
+	}
+	return v
 }
@@ -1,134 +1,189 @@
 package search
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
+	"sort"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gitlab.com/edea-dev/edea-server/internal/model"
-	"go.uber.org/zap"
+	"gitlab.com/edea-dev/edea-server/internal/units"
+	"gorm.io/gorm"
 )
 
+// SearchParam compares a parameter with its values using one of the operators =, !=, <, <=, >, >=,
+// between, exists and missing. Several values match any of them.
 type SearchParam struct {
 	Field  string   `json:"field"`
 	Op     string   `json:"op,omitempty"`
 	Values []string `json:"values"`
 }
 
-type ParamValues struct {
-	Field  string        `json:"field"`
-	Values []interface{} `json:"values"`
+// SearchField is a parameter of the parametric search with the distinct values the modules have
+type SearchField struct {
+	Key         string        `json:"key"`
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Type        string        `json:"type"`
+	Unit        string        `json:"unit,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+	Min         *float64      `json:"min,omitempty"`
+	Max         *float64      `json:"max,omitempty"`
+	Enum        []string      `json:"enum,omitempty"`
+	Values      []interface{} `json:"values"`
+}
+
+// ModuleQuery is the body of a parametric search, the query and the params have to match both
+type ModuleQuery struct {
+	Query    string        `json:"query"`
+	Params   []SearchParam `json:"params"`
+	Category string        `json:"category"` // id of the category the modules have to be in, any if empty
+	Limit    int           `json:"limit"`    // at most maxLimit modules, also the default
+	Offset   int           `json:"offset"`
 }
 
 func SearchModule(c *gin.Context) {
-	var sp []SearchParam
-	if err := c.BindJSON(&sp); err != nil {
+	var raw json.RawMessage
+	if err := c.BindJSON(&raw); err != nil {
 		_ = c.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 
-	var sb strings.Builder
-	var qc []interface{}
+	// a plain list of params is what the parametric search page sends
+	var mq ModuleQuery
+	var err error
+	if trimmed := strings.TrimSpace(string(raw)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(raw, &mq.Params)
+	} else {
+		err = json.Unmarshal(raw, &mq)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	expr, err := mq.Expr()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	tx := model.DB.Model(&model.Module{}).Where("deleted_at IS NULL")
 
-	// put the user condition first, just in case
 	currentUser, _ := c.Keys["user"].(*model.User)
 	if currentUser == nil {
-		sb.WriteString("private = false")
+		tx = tx.Where("private = false")
 	} else {
-		sb.WriteString("(private = false OR user_id = ?)")
-		qc = append(qc, currentUser.ID.String())
+		tx = tx.Where("(private = false OR user_id = ?)", currentUser.ID.String())
 	}
 
-	for i := 0; i < len(sp); i++ {
-		paramsAdded := false
-		isNumeric := false
+	if mq.Category != "" {
+		if _, err := uuid.Parse(mq.Category); err != nil {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid category id"})
+			return
+		}
+		tx = tx.Where("category_id = ?", mq.Category)
+	}
 
-		lenValues := len(sp[i].Values)
+	// shared by the unit check and the query
+	tx = tx.Session(&gorm.Session{})
 
-		// skip empty fields
-		if lenValues == 0 {
-			continue
-		}
+	if err := unitMismatch(tx, expr); errors.Is(err, units.ErrUnitMismatch) {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	} else if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
 
-		// order of query parameters is field first then values
-		qc = append(qc, sp[i].Field)
-
-		// parse and add numeric parameters
-		if num, err := strconv.ParseFloat(sp[i].Values[0], 64); err == nil {
-			if lenValues == 1 {
-				qc = append(qc, num)
-				paramsAdded = true
-				isNumeric = true
-			} else {
-				// try to parse all the values as numbers
-				nums := make([]float64, lenValues)
-				j := 0
-				for ; j < lenValues; j++ {
-					nums[j], err = strconv.ParseFloat(sp[i].Values[j], 64)
-					if err != nil {
-						break
-					}
-				}
-
-				// only say we added the parameters if really all parsed successfully
-				if j == lenValues {
-					paramsAdded = true
-					isNumeric = true
-					qc = append(qc, nums)
-				}
-			}
-		}
+	if mq.Limit <= 0 || mq.Limit > maxLimit {
+		mq.Limit = maxLimit
+	}
+	if mq.Offset < 0 {
+		mq.Offset = 0
+	}
 
-		// add string params
-		if !paramsAdded {
-			if lenValues == 1 {
-				qc = append(qc, sp[i].Values[0])
-			} else {
-				qc = append(qc, sp[i].Values)
-			}
-		}
+	cond, vars := moduleCondition(tx, expr)
 
-		sb.WriteString(" AND ")
+	modules := []model.Module{}
+	err = tx.Where(cond, vars...).Preload("Category").Preload("User").
+		Order("name, id").Limit(mq.Limit).Offset(mq.Offset).Find(&modules).Error
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
 
-		cast := "numeric"
-		extract := "->"
-		if !isNumeric {
-			cast = "text"
-			extract = "->>"
+	c.JSON(http.StatusOK, modules)
+}
+
+// Where limits a query of modules to the ones which match, like Match does module by module
+func (mq ModuleQuery) Where(tx *gorm.DB) (*gorm.DB, error) {
+	expr, err := mq.Expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if mq.Category != "" {
+		tx = tx.Where("modules.category_id = ?", mq.Category)
+	}
+
+	cond, vars := moduleCondition(tx, expr)
+	return tx.Where(cond, vars...), nil
+}
+
+// Expr parses the query and combines it with the params
+func (mq ModuleQuery) Expr() (Expr, error) {
+	var terms andExpr
+
+	if strings.TrimSpace(mq.Query) != "" {
+		e, err := ParseQuery(mq.Query)
+		if err != nil {
+			return nil, err
 		}
+		terms = append(terms, e)
+	}
 
-		// append the query string for the parameter we're currently processing
-		if lenValues > 1 {
-			sb.WriteString(fmt.Sprintf("(metadata -> 'params' %s ?)::%s IN ?", extract, cast))
-		} else {
-			switch sp[i].Op {
-			case "=":
-				sb.WriteString(fmt.Sprintf("(metadata -> 'params' %s ?)::%s = ?", extract, cast))
-			case "<":
-				sb.WriteString(fmt.Sprintf("(metadata -> 'params' %s ?)::%s < ?", extract, cast))
-			case ">":
-				sb.WriteString(fmt.Sprintf("(metadata -> 'params' %s ?)::%s > ?", extract, cast))
-			default:
-				c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid or missing op for param %s", sp[i].Field)})
-				return
-			}
+	for _, p := range mq.Params {
+		op := p.Op
+		switch {
+		case op == "exists" || op == "missing":
+		case len(p.Values) == 0:
+			// skip empty fields
+			continue
+		case len(p.Values) > 1 && (op == "" || op == "in"):
+			// several values match any of them
+			op = "="
+		case op == "":
+			return nil, fmt.Errorf("invalid or missing op for param %s", p.Field)
 		}
 
+		cmp, err := newComparison(p.Field, op, p.Values)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, cmp)
 	}
 
-	zap.S().Infof("query: %s, params: %#v", sb.String(), qc)
+	return terms, nil
+}
 
-	// query the db with the selectors
-	var modules []model.Module
-	tx := model.DB.Model(&model.Module{}).Where(sb.String(), qc...).Preload("Category").Preload("User").Find(&modules)
-	if err := tx.Error; err != nil {
-		_ = c.AbortWithError(http.StatusInternalServerError, err)
-		return
+// Match checks a single module against the query, the module needs its category preloaded.
+// Parameters in another unit than the query don't match.
+func (mq ModuleQuery) Match(m *model.Module) (bool, error) {
+	if mq.Category != "" && m.CategoryID != mq.Category {
+		return false, nil
 	}
 
-	c.JSON(http.StatusOK, modules)
+	expr, err := mq.Expr()
+	if err != nil {
+		return false, err
+	}
+
+	return expr.Match(m), nil
 }
 
 func Filters(c *gin.Context) {
@@ -142,27 +197,176 @@ func Filters(c *gin.Context) {
 	c.JSON(http.StatusOK, filters)
 }
 
+// GetParametersForCategory returns the search fields with all the values the public modules have. With
+// the category query parameter it's the schema of that category and the values of its modules, or the
+// parameters its modules have if it has no schema.
 func GetParametersForCategory(c *gin.Context) {
-	var pgQuery = `
-SELECT json_object_agg(field, values)
-FROM (SELECT key AS field, array_agg(value) AS values
-		FROM (SELECT f.key, f.value
-			FROM (SELECT metadata -> 'params' AS params
-					FROM modules
-					WHERE metadata -> 'params'::text != 'null') t,
-					jsonb_each(t.params) f
-			WHERE t.params is not null
-			GROUP BY f.value, f.key
-			ORDER BY f.value) s
-		GROUP BY key) j;
-`
-
-	var res string
-	tx := model.DB.Raw(pgQuery).Scan(&res)
-	if tx.Error != nil {
-		_ = c.AbortWithError(http.StatusInternalServerError, tx.Error)
+	category := c.Query("category")
+
+	if category != "" {
+		if _, err := uuid.Parse(category); err != nil {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid category id"})
+			return
+		}
+	}
+
+	rows, err := moduleParams(model.DB.WithContext(c), category)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	values := collectParams(rows)
+
+	var schema []model.CategoryParam
+	if category != "" {
+		if err := model.DB.Where("category_id = ?", category).Order("position, key").Find(&schema).Error; err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if len(schema) > 0 {
+		c.JSON(http.StatusOK, schemaFields(schema, values))
+		return
+	}
+
+	// without a schema the filters give the parameters their names
+	var filters []model.Filter
+	if err := model.DB.Find(&filters).Error; err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 
-	c.Data(http.StatusOK, "application/json", []byte(res))
+	c.JSON(http.StatusOK, inferFields(filters, values))
+}
+
+// schemaFields returns the parameters of a category schema in order
+func schemaFields(schema []model.CategoryParam, values map[string][]interface{}) []SearchField {
+	fields := make([]SearchField, 0, len(schema))
+
+	for _, p := range schema {
+		v := values[p.Key]
+		if v == nil {
+			v = []interface{}{}
+		}
+
+		fields = append(fields, SearchField{
+			Key:         p.Key,
+			Name:        p.Name,
+			Description: p.Description,
+			Type:        p.Type,
+			Unit:        p.Unit,
+			Required:    p.Required,
+			Min:         p.Min,
+			Max:         p.Max,
+			Enum:        p.EnumValues(),
+			Values:      v,
+		})
+	}
+
+	return fields
+}
+
+// inferFields returns every parameter the modules have by key, they are numbers if all of their values are
+func inferFields(filters []model.Filter, values map[string][]interface{}) []SearchField {
+	names := make(map[string]model.Filter, len(filters))
+	for _, f := range filters {
+		names[f.Key] = f
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make([]SearchField, 0, len(keys))
+
+	for _, key := range keys {
+		field := SearchField{Key: key, Name: key, Type: model.ParamNumber, Values: values[key]}
+		if f, ok := names[key]; ok {
+			field.Name, field.Description = f.Name, f.Description
+		}
+
+		for _, v := range values[key] {
+			if _, ok := v.(float64); ok {
+				continue
+			}
+			s, _ := v.(string)
+			q, err := units.Parse(s)
+			if err != nil {
+				field.Type, field.Unit = model.ParamText, ""
+				break
+			}
+			if q.Unit != "" {
+				field.Unit = q.Unit
+			}
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// paramValue is a value to show and the number it's sorted by
+type paramValue struct {
+	value   interface{}
+	number  float64
+	numeric bool
+}
+
+// paramRow is a distinct value of a parameter as moduleParams returns it, the value is JSON
+type paramRow struct {
+	Key   string
+	Value string
+	Unit  string
+}
+
+// collectParams maps each parameter to its distinct values in a stable order, quantities are
+// formatted with their unit
+func collectParams(rows []paramRow) map[string][]interface{} {
+	seen := make(map[string]map[string]bool)
+	collected := make(map[string][]paramValue)
+
+	for _, r := range rows {
+		var v interface{}
+		if err := json.Unmarshal([]byte(r.Value), &v); err != nil {
+			continue
+		}
+
+		pv := paramValue{value: v}
+		if n, ok := v.(float64); ok {
+			pv.number, pv.numeric = n, true
+			if r.Unit != "" {
+				pv.value = units.Format(n, r.Unit)
+			}
+		}
+
+		// the same number can be written differently, and modules can differ in units
+		b, err := json.Marshal(pv.value)
+		if err != nil || seen[r.Key][string(b)] {
+			continue
+		}
+		if seen[r.Key] == nil {
+			seen[r.Key] = make(map[string]bool)
+		}
+		seen[r.Key][string(b)] = true
+		collected[r.Key] = append(collected[r.Key], pv)
+	}
+
+	params := make(map[string][]interface{}, len(collected))
+	for key, values := range collected {
+		sort.SliceStable(values, func(i, j int) bool {
+			if values[i].numeric && values[j].numeric {
+				return values[i].number < values[j].number
+			}
+			return fmt.Sprint(values[i].value) < fmt.Sprint(values[j].value)
+		})
+		for _, v := range values {
+			params[key] = append(params[key], v.value)
+		}
+	}
+
+	return params
 }
@@ -0,0 +1,552 @@
+package search
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/units"
+)
+
+// ErrInvalidQuery is returned for parametric queries which can't be parsed
+var ErrInvalidQuery = errors.New("invalid query")
+
+const (
+	// maxQueryDepth limits the nesting of groups so a query can't exhaust the stack
+	maxQueryDepth = 32
+	// categoryField compares the category name instead of a parameter
+	categoryField = "category"
+)
+
+// Expr is a parsed parametric query
+type Expr interface {
+	Match(m *model.Module) bool
+}
+
+type (
+	andExpr []Expr
+	orExpr  []Expr
+	notExpr struct{ Expr }
+)
+
+// Match reports whether all expressions match
+func (e andExpr) Match(m *model.Module) bool {
+	for _, x := range e {
+		if !x.Match(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether any expression matches
+func (e orExpr) Match(m *model.Module) bool {
+	for _, x := range e {
+		if x.Match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match negates the expression
+func (e notExpr) Match(m *model.Module) bool {
+	return !e.Expr.Match(m)
+}
+
+// comparison of a parameter with values, numeric if all of them are quantities
+type comparison struct {
+	field      string
+	op         string
+	text       []string
+	quantities []units.Quantity
+	unit       string // unit of the quantities, empty for plain numbers
+}
+
+// arity is the number of values of each operator, -1 means one or more
+var arity = map[string]int{
+	"=": -1, "!=": -1, "<": 1, "<=": 1, ">": 1, ">=": 1, "between": 2, "exists": 0, "missing": 0,
+}
+
+// newComparison checks the number of values for the operator and parses them with their units
+func newComparison(field, op string, values []string) (*comparison, error) {
+	n, ok := arity[op]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown operator %q for %s", ErrInvalidQuery, op, field)
+	}
+	if (n >= 0 && len(values) != n) || (n < 0 && len(values) == 0) {
+		return nil, fmt.Errorf("%w: %s needs %s for %s", ErrInvalidQuery, op, plural(n), field)
+	}
+
+	c := &comparison{field: field, op: op, text: values}
+
+	for _, v := range values {
+		q, err := units.Parse(v)
+		if err != nil {
+			c.quantities, c.unit = nil, ""
+			break
+		}
+		if err := q.Compatible(c.unit); err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		if q.Unit != "" {
+			c.unit = q.Unit
+		}
+		c.quantities = append(c.quantities, q)
+	}
+
+	// the bounds can be given in any order
+	if op == "between" && c.quantities != nil {
+		sort.Slice(c.quantities, func(i, j int) bool { return c.quantities[i].Value < c.quantities[j].Value })
+	} else if op == "between" {
+		sort.Strings(c.text)
+	}
+
+	return c, nil
+}
+
+func plural(n int) string {
+	switch n {
+	case -1:
+		return "at least one value"
+	case 0:
+		return "no value"
+	case 1:
+		return "one value"
+	}
+	return fmt.Sprintf("%d values", n)
+}
+
+// value returns the parameter or the category and its unit
+func (c *comparison) value(m *model.Module) (value interface{}, unit string, found bool) {
+	if c.field == categoryField {
+		return m.Category.Name, "", true
+	}
+
+	params, _ := m.Metadata["params"].(map[string]interface{})
+	value, found = params[c.field]
+
+	paramUnits, _ := m.Metadata["units"].(map[string]interface{})
+	unit, _ = paramUnits[c.field].(string)
+
+	return value, unit, found
+}
+
+// mismatch reports whether the parameter is in another unit than the values
+func (c *comparison) mismatch(unit string) bool {
+	return c.quantities != nil && c.unit != "" && unit != "" && unit != c.unit
+}
+
+// Match compares the parameter of the module, a list matches if any of its values does
+// and != only if none of them is equal
+func (c *comparison) Match(m *model.Module) bool {
+	value, unit, found := c.value(m)
+
+	switch c.op {
+	case "exists":
+		return found
+	case "missing":
+		return !found
+	}
+
+	if !found || c.mismatch(unit) {
+		return false
+	}
+
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+
+	if c.op == "!=" {
+		for _, v := range values {
+			if c.matchValue("=", v) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, v := range values {
+		if c.matchValue(c.op, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *comparison) matchValue(op string, value interface{}) bool {
+	if c.quantities == nil {
+		s := fmt.Sprint(value)
+		cmp := func(t string) int {
+			if strings.EqualFold(s, t) {
+				return 0
+			}
+			return strings.Compare(s, t)
+		}
+		if op == "between" {
+			return cmp(c.text[0]) >= 0 && cmp(c.text[1]) <= 0
+		}
+		for _, t := range c.text {
+			if compare(op, cmp(t)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var n float64
+	switch v := value.(type) {
+	case float64:
+		n = v
+	case string:
+		// metadata which hasn't been normalized yet
+		q, err := units.Parse(v)
+		if err != nil {
+			return false
+		}
+		n = q.Value
+	default:
+		return false
+	}
+
+	if op == "between" {
+		return compareFloat(n, c.quantities[0].Value) >= 0 && compareFloat(n, c.quantities[1].Value) <= 0
+	}
+	for _, q := range c.quantities {
+		if compare(op, compareFloat(n, q.Value)) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(op string, c int) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return c == 0
+}
+
+// compareFloat treats values which only differ by rounding as equal
+func compareFloat(a, b float64) int {
+	if math.Abs(a-b) <= 1e-9*math.Max(math.Abs(a), math.Abs(b)) {
+		return 0
+	}
+	if a < b {
+		return -1
+	}
+	return 1
+}
+
+// comparisons calls fn for every comparison in the expression
+func comparisons(e Expr, fn func(*comparison)) {
+	switch x := e.(type) {
+	case andExpr:
+		for _, y := range x {
+			comparisons(y, fn)
+		}
+	case orExpr:
+		for _, y := range x {
+			comparisons(y, fn)
+		}
+	case notExpr:
+		comparisons(x.Expr, fn)
+	case *comparison:
+		fn(x)
+	}
+}
+
+// token of a query, quoted strings are never keywords or operators
+type token struct {
+	text   string
+	quoted bool
+	pos    int
+}
+
+// symbol reports whether the token is a parenthesis, comma or operator
+func (t token) symbol() bool {
+	return !t.quoted && t.text != "" && strings.ContainsRune("(),=!<>", rune(t.text[0]))
+}
+
+// tokenize splits a query into words, quoted strings, operators, parentheses and commas
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(s); {
+		r := rune(s[i])
+		switch {
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			i++
+		case r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, token{text: s[i : i+1], pos: i})
+			i++
+		case r == '=' || r == '!' || r == '<' || r == '>':
+			j := i + 1
+			if j < len(s) && s[j] == '=' {
+				j++
+			}
+			op := s[i:j]
+			if op == "!" {
+				return nil, fmt.Errorf("%w: unexpected ! at position %d", ErrInvalidQuery, i)
+			}
+			if op == "==" {
+				op = "="
+			}
+			tokens = append(tokens, token{text: op, pos: i})
+			i = j
+		case r == '"' || r == '\'':
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated string at position %d", ErrInvalidQuery, i)
+			}
+			tokens = append(tokens, token{text: s[i+1 : i+1+end], quoted: true, pos: i})
+			i += end + 2
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\r\n()=!<>,\"'", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, token{text: s[i:j], pos: i})
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
+
+// parser is a recursive descent parser for
+//
+//	expr       = and { "OR" and }
+//	and        = not { "AND" not }
+//	not        = "NOT" not | "(" expr ")" | comparison
+//	comparison = field ( op value | "BETWEEN" value "AND" value | "IN" "(" value { "," value } ")" | "EXISTS" | "MISSING" )
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+// ParseQuery parses a parametric query like "v_in_max >= 12V AND (i_out_max > 1A OR category = Power)"
+func ParseQuery(s string) (Expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return andExpr{}, nil
+	}
+
+	p := &parser{tokens: tokens}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		return nil, p.unexpected(t)
+	}
+	return e, nil
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) next() (token, error) {
+	t, ok := p.peek()
+	if !ok {
+		return t, fmt.Errorf("%w: unexpected end of query", ErrInvalidQuery)
+	}
+	p.pos++
+	return t, nil
+}
+
+// keyword consumes the next token if it's the keyword, in any case
+func (p *parser) keyword(k string) bool {
+	t, ok := p.peek()
+	if ok && !t.quoted && strings.EqualFold(t.text, k) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// symbol consumes the next token if it's the given parenthesis, comma or operator
+func (p *parser) symbol(s string) bool {
+	t, ok := p.peek()
+	if ok && !t.quoted && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) unexpected(t token) error {
+	return fmt.Errorf("%w: unexpected %q at position %d", ErrInvalidQuery, t.text, t.pos)
+}
+
+func (p *parser) expr() (Expr, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxQueryDepth {
+		return nil, fmt.Errorf("%w: too deeply nested", ErrInvalidQuery)
+	}
+
+	var terms orExpr
+	for {
+		e, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, e)
+		if !p.keyword("or") {
+			break
+		}
+	}
+
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *parser) and() (Expr, error) {
+	var terms andExpr
+	for {
+		e, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, e)
+		if !p.keyword("and") {
+			break
+		}
+	}
+
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *parser) not() (Expr, error) {
+	if p.keyword("not") {
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > maxQueryDepth {
+			return nil, fmt.Errorf("%w: too deeply nested", ErrInvalidQuery)
+		}
+
+		e, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{e}, nil
+	}
+
+	if p.symbol("(") {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.symbol(")") {
+			if t, ok := p.peek(); ok {
+				return nil, p.unexpected(t)
+			}
+			return nil, fmt.Errorf("%w: missing )", ErrInvalidQuery)
+		}
+		return e, nil
+	}
+
+	return p.comparison()
+}
+
+func (p *parser) comparison() (Expr, error) {
+	field, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if field.symbol() {
+		return nil, p.unexpected(field)
+	}
+
+	switch {
+	case p.keyword("exists"):
+		return newComparison(field.text, "exists", nil)
+	case p.keyword("missing"):
+		return newComparison(field.text, "missing", nil)
+	case p.keyword("between"):
+		low, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("and") {
+			return nil, fmt.Errorf("%w: between needs two values joined by AND for %s", ErrInvalidQuery, field.text)
+		}
+		high, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return newComparison(field.text, "between", []string{low, high})
+	case p.keyword("in"):
+		if !p.symbol("(") {
+			return nil, fmt.Errorf("%w: in needs a list of values in parentheses for %s", ErrInvalidQuery, field.text)
+		}
+		var values []string
+		for {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+			if p.symbol(")") {
+				break
+			}
+			if !p.symbol(",") {
+				return nil, fmt.Errorf("%w: expected , or ) in the values of %s", ErrInvalidQuery, field.text)
+			}
+		}
+		return newComparison(field.text, "=", values)
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if !op.symbol() || op.text == "(" || op.text == ")" || op.text == "," {
+		return nil, p.unexpected(op)
+	}
+
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	return newComparison(field.text, op.text, []string{v})
+}
+
+// value is a word or a quoted string
+func (p *parser) value() (string, error) {
+	t, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if t.symbol() {
+		return "", p.unexpected(t)
+	}
+	return t.text, nil
+}
@@ -0,0 +1,95 @@
+package search
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/units"
+	"gorm.io/datatypes"
+)
+
+func TestParseQuery(t *testing.T) {
+	modules := []model.Module{
+		{Name: "ldo", Category: model.Category{Name: "Power"}, Metadata: datatypes.JSONMap{
+			"params": map[string]interface{}{"v_in_max": 16.0, "i_out_max": 0.5, "package": "SOT-23"},
+			"units":  map[string]interface{}{"v_in_max": "V", "i_out_max": "A"},
+		}},
+		{Name: "buck", Category: model.Category{Name: "Power"}, Metadata: datatypes.JSONMap{
+			"params": map[string]interface{}{"v_in_max": 36.0, "i_out_max": 3.0, "v_out": []interface{}{3.3, 5.0}},
+			"units":  map[string]interface{}{"v_in_max": "V", "i_out_max": "A", "v_out": "V"},
+		}},
+		{Name: "usb", Category: model.Category{Name: "Connectors"}, Metadata: datatypes.JSONMap{
+			"params": map[string]interface{}{"v_in_max": 5.0, "package": "USB-C"},
+			"units":  map[string]interface{}{"v_in_max": "V"},
+		}},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"ldo", "buck", "usb"}},
+		{"v_in_max >= 12", []string{"ldo", "buck"}},
+		{"v_in_max >= 12V AND (i_out_max > 1A OR category = Power)", []string{"ldo", "buck"}},
+		{"v_in_max <= 16V and not category = power", []string{"usb"}},
+		{"v_in_max between 20V and 4.5V", []string{"ldo", "usb"}},
+		{"v_in_max != 5V", []string{"ldo", "buck"}},
+		{"package exists", []string{"ldo", "usb"}},
+		{"package missing OR package = 'USB-C'", []string{"buck", "usb"}},
+		{"package in (SOT-23, \"USB-C\")", []string{"ldo", "usb"}},
+		{"v_out = 5V", []string{"buck"}},
+		{"v_out != 3.3V", nil},
+		{"i_out_max < 1 or v_in_max == 5", []string{"ldo", "usb"}},
+		{"((category = Connectors))", []string{"usb"}},
+		{"NOT (v_in_max > 10V AND i_out_max < 1A)", []string{"buck", "usb"}},
+	}
+
+	search := moduleSearch(t, modules)
+	for _, tt := range tests {
+		expr, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		names, err := search(expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, names, tt.want)
+		}
+	}
+
+	invalid := []string{
+		"v_in_max",
+		"v_in_max >",
+		"v_in_max > 5 AND",
+		"(v_in_max > 5",
+		"v_in_max > 5)",
+		"v_in_max ! 5",
+		"v_in_max between 1",
+		"package in (a, b",
+		"= 5",
+		"package = 'open",
+		strings.Repeat("(", 100) + "a exists" + strings.Repeat(")", 100),
+	}
+	for _, q := range invalid {
+		if _, err := ParseQuery(q); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%q: expected ErrInvalidQuery, got %v", q, err)
+		}
+	}
+
+	expr, err := ParseQuery("i_out_max > 5V")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := search(expr); !errors.Is(err, units.ErrUnitMismatch) {
+		t.Errorf("expected a unit mismatch, got %v", err)
+	}
+}
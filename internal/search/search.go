@@ -0,0 +1,615 @@
+package search
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/view"
+	"go.uber.org/zap"
+)
+
+// Entry for the search index, expand with necessary data
+type Entry struct {
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Author      string                 `json:"author"`
+	UserID      string                 `json:"user_id"`
+	Public      bool                   `json:"public"`
+	Category    string                 `json:"category,omitempty"` // name of the category of a module
+	Tags        []string               `json:"tags"`               // tags of a module from edea.yml
+	Popularity  int64                  `json:"popularity"`         // number of benches a module is on, benches have none
+	UpdatedAt   int64                  `json:"updated_at"`         // unix time of the last change
+	Metadata    map[string]interface{} `json:"metadata"`
+}
+
+// Facets the results can be filtered by and are counted for
+const (
+	FacetType     = "type"
+	FacetCategory = "category"
+	FacetAuthor   = "author"
+	FacetTags     = "tags"
+)
+
+// Facets in the order they are shown
+var Facets = []string{FacetType, FacetCategory, FacetAuthor, FacetTags}
+
+// Sorts are the orders the hits can be sorted in besides relevance
+var Sorts = []string{"updated_at:desc", "updated_at:asc", "popularity:desc", "name:asc"}
+
+// Query for the full text search
+type Query struct {
+	Text    string
+	UserID  string              // also find the private entries of this user, empty for anonymous searches
+	Filters map[string][]string // values of a facet which the hits need one of, see Facets
+	Sort    string              // one of Sorts, by relevance if empty
+	Limit   int
+	Offset  int
+}
+
+// Hit is an entry which matched, Formatted has the matches highlighted with <em> and the rest HTML escaped
+type Hit struct {
+	Entry
+	Formatted map[string]interface{} `json:"_formatted"`
+}
+
+// Result of a query
+type Result struct {
+	Query  string                      `json:"query"`
+	Hits   []Hit                       `json:"hits"`
+	Total  int64                       `json:"total"`  // might be an estimate
+	Facets map[string]map[string]int64 `json:"facets"` // number of hits by facet and value
+	Limit  int                         `json:"limit"`
+	Offset int                         `json:"offset"`
+}
+
+// Backend stores the search entries and runs the queries
+type Backend interface {
+	Update(entries ...Entry) error // add or replace entries
+	Delete(ids ...string) error
+	Replace(entries []Entry) error // replace the whole index
+	Documents() ([]Entry, error)   // everything in the index, without tags and metadata
+	Query(q Query) (*Result, error)
+}
+
+// Names of the backends for the configuration
+const (
+	BackendMeili    = "meilisearch"
+	BackendDatabase = "database"
+)
+
+// defaultLimit of hits per query and the most a query can ask for
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+var (
+	// ErrNoBackend is returned when searching before Init
+	ErrNoBackend = errors.New("search is not initialized")
+	// ErrInvalidSort is returned for orders which aren't in Sorts
+	ErrInvalidSort = errors.New("invalid sort order")
+)
+
+var backend Backend
+
+// Init sets up the search backend, MeiliSearch if a host is configured and the database otherwise.
+// An unreachable MeiliSearch is not an error, it's used as soon as it's up.
+func Init(name, host, index, apiKey string) error {
+	if name == "" {
+		name = BackendDatabase
+		if host != "" {
+			name = BackendMeili
+		}
+	}
+
+	switch name {
+	case BackendMeili:
+		m, err := NewMeili(host, index, apiKey)
+		if err != nil {
+			return err
+		}
+		backend = m
+	case BackendDatabase:
+		backend = NewDatabase()
+	default:
+		return fmt.Errorf("unknown search backend %q, use %q or %q", name, BackendMeili, BackendDatabase)
+	}
+
+	zap.L().Info("search backend", zap.String("backend", name))
+	return nil
+}
+
+// Enabled reports whether there is a search backend
+func Enabled() bool {
+	return backend != nil
+}
+
+// BenchToEntry converts a Bench model to a Search Entry
+func BenchToEntry(b model.Bench) Entry {
+	return Entry{
+		ID:          b.ID.String(),
+		Type:        "bench",
+		Name:        b.Name,
+		Description: b.Description,
+		Author:      b.User.Handle,
+		UserID:      b.UserID.String(),
+		Public:      b.Public,
+		UpdatedAt:   b.UpdatedAt.Unix(),
+	}
+}
+
+// ModuleToEntry converts a Module model to a Search Entry, the popularity is set by the caller
+func ModuleToEntry(m model.Module) Entry {
+	return Entry{
+		ID:          m.ID.String(),
+		Type:        "module",
+		Name:        m.Name,
+		Description: m.Description,
+		Author:      m.User.Handle,
+		UserID:      m.UserID.String(),
+		Public:      !m.Private,
+		Category:    m.Category.Name,
+		Tags:        moduleTags(m.Metadata),
+		UpdatedAt:   m.UpdatedAt.Unix(),
+		Metadata:    m.Metadata,
+	}
+}
+
+// moduleTags returns the tags in the metadata, they are strings after the extraction
+// and interfaces when read from the database
+func moduleTags(metadata map[string]interface{}) []string {
+	switch t := metadata["tags"].(type) {
+	case []string:
+		return t
+	case []interface{}:
+		tags := make([]string, 0, len(t))
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				tags = append(tags, s)
+			}
+		}
+		return tags
+	}
+	return nil
+}
+
+// Popularity counts the benches each module is on by its id, benches which were deleted don't count
+func Popularity(ctx context.Context, ids ...uuid.UUID) (map[string]int64, error) {
+	var rows []struct {
+		ModuleID uuid.UUID
+		Benches  int64
+	}
+
+	tx := model.DB.WithContext(ctx).Table("bench_modules").
+		Select("bench_modules.module_id, count(DISTINCT bench_modules.bench_id) AS benches").
+		Joins("JOIN benches ON benches.id = bench_modules.bench_id").
+		Where("bench_modules.deleted_at IS NULL AND benches.deleted_at IS NULL").
+		Group("bench_modules.module_id")
+	if len(ids) > 0 {
+		tx = tx.Where("bench_modules.module_id IN ?", ids)
+	}
+	if err := tx.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	popularity := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		popularity[r.ModuleID.String()] = r.Benches
+	}
+
+	return popularity, nil
+}
+
+// ReIndex replaces the whole search index with all benches and modules from the database
+// and returns the number of entries
+func ReIndex() (int, error) {
+	var benches []model.Bench
+	var modules []model.Module
+	var documents []Entry
+
+	if backend == nil {
+		return 0, ErrNoBackend
+	}
+
+	result := model.DB.Model(&model.Bench{}).Preload("User").Find(&benches)
+	if result.Error != nil {
+		return 0, fmt.Errorf("could not fetch the benches: %w", result.Error)
+	}
+
+	for _, b := range benches {
+		documents = append(documents, BenchToEntry(b))
+	}
+
+	result = model.DB.Model(&model.Module{}).Where("deleted_at is null").Preload("Category").Preload("User").Find(&modules)
+	if result.Error != nil {
+		return 0, fmt.Errorf("could not fetch the modules: %w", result.Error)
+	}
+
+	popularity, err := Popularity(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("could not count the benches of the modules: %w", err)
+	}
+
+	for _, m := range modules {
+		e := ModuleToEntry(m)
+		e.Popularity = popularity[e.ID]
+		documents = append(documents, e)
+	}
+
+	if err := backend.Replace(documents); err != nil {
+		return 0, fmt.Errorf("could not replace the search index: %w", err)
+	}
+
+	return len(documents), nil
+}
+
+// ReIndexDB searches for all public entries and puts them into the database
+//
+//	This route is mainly for testing
+func ReIndexDB(c *gin.Context) {
+	n, err := ReIndex()
+	if err != nil {
+		zap.L().Panic("could not rebuild the search index", zap.Error(err))
+	}
+
+	c.String(http.StatusOK, "indexed %d entries", n)
+}
+
+// Documents returns every entry in the search index, without tags and metadata
+func Documents() ([]Entry, error) {
+	if backend == nil {
+		return nil, ErrNoBackend
+	}
+	return backend.Documents()
+}
+
+// UpdateEntry adds or updates a single search entry
+func UpdateEntry(e Entry) error {
+	// gracefully ignore but warn if there is no search
+	if backend == nil {
+		zap.L().Warn("search not initialized")
+		return nil
+	}
+
+	if err := backend.Update(e); err != nil {
+		return fmt.Errorf("could not add/update the search index: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteEntry removes an Entry from the search index
+func DeleteEntry(e Entry) error {
+	// gracefully ignore but warn if there is no search
+	if backend == nil {
+		zap.L().Warn("search not initialized")
+		return nil
+	}
+
+	if err := backend.Delete(e.ID); err != nil {
+		return fmt.Errorf("could not delete the entry: %w", err)
+	}
+
+	return nil
+}
+
+// Find runs a full text query
+func Find(q Query) (*Result, error) {
+	if backend == nil {
+		return nil, ErrNoBackend
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultLimit
+	} else if q.Limit > maxLimit {
+		q.Limit = maxLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	if q.Sort != "" && !validSort(q.Sort) {
+		return nil, fmt.Errorf("%w %q, use one of %s", ErrInvalidSort, q.Sort, strings.Join(Sorts, ", "))
+	}
+
+	r, err := backend.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	r.Limit, r.Offset = q.Limit, q.Offset
+
+	return r, nil
+}
+
+// MatchEntry checks if an entry is a hit of the query without asking the backend, like the
+// database backend on SQLite all the words have to be in the name, author or description
+func MatchEntry(q Query, e Entry) bool {
+	if !e.Public && (q.UserID == "" || e.UserID != q.UserID) {
+		return false
+	}
+
+	text := strings.ToLower(e.Name + "\n" + e.Author + "\n" + e.Description)
+	for _, t := range queryTerms(q.Text) {
+		if !strings.Contains(text, t) {
+			return false
+		}
+	}
+
+	for _, f := range Facets {
+		values := q.Filters[f]
+		if len(values) == 0 {
+			continue
+		}
+
+		var have []string
+		switch f {
+		case FacetType:
+			have = []string{e.Type}
+		case FacetCategory:
+			have = []string{e.Category}
+		case FacetAuthor:
+			have = []string{e.Author}
+		case FacetTags:
+			have = e.Tags
+		}
+		if !anyOf(have, values) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// anyOf returns true if any of the values is in have
+func anyOf(have, values []string) bool {
+	for _, h := range have {
+		for _, v := range values {
+			if h == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func validSort(sort string) bool {
+	for _, s := range Sorts {
+		if s == sort {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryFromRequest reads a query from the parameters of a request: the text in q, the values of
+// each facet under its name, sort, limit and offset. Form values of POST requests count too.
+func QueryFromRequest(c *gin.Context) Query {
+	_ = c.Request.ParseForm()
+	form := c.Request.Form
+
+	q := Query{
+		Text:    strings.TrimSpace(form.Get("q")),
+		Filters: make(map[string][]string),
+		Sort:    form.Get("sort"),
+	}
+	q.Limit, _ = strconv.Atoi(form.Get("limit"))
+	q.Offset, _ = strconv.Atoi(form.Get("offset"))
+
+	for _, f := range Facets {
+		for _, v := range form[f] {
+			if v = strings.TrimSpace(v); v != "" {
+				q.Filters[f] = append(q.Filters[f], v)
+			}
+		}
+	}
+
+	// check if the user is logged in to include private results
+	if u, ok := c.Keys["user"].(*model.User); ok {
+		q.UserID = u.ID.String()
+	}
+
+	return q
+}
+
+// Search is the full text search page, with an Accept header of application/json it returns the result as JSON
+func Search(c *gin.Context) {
+	m := make(map[string]interface{})
+
+	isAjax := strings.Contains(c.GetHeader("accept"), "application/json")
+
+	query := QueryFromRequest(c)
+	m["Query"] = query
+	m["Sorts"] = sortOptions
+
+	if query.Text != "" || len(query.Filters) > 0 {
+		res, err := Find(query)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrInvalidSort) {
+				status = http.StatusBadRequest
+			} else {
+				zap.L().Error("search error", zap.Error(err), zap.String("query", query.Text))
+			}
+			if isAjax {
+				c.JSON(status, gin.H{"error": err.Error()})
+			} else {
+				m["Error"] = err
+				view.RenderTemplate(c, "search.tmpl", "EDeA - Search", m)
+			}
+			return
+		}
+
+		// check if it's an AJAX request
+		if isAjax {
+			c.JSON(http.StatusOK, res)
+			return
+		}
+
+		m["Result"] = res
+		m["Facets"] = facetLinks(query, res)
+		m["Pages"] = pageLinks(query, res)
+	}
+
+	if isAjax {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	view.RenderTemplate(c, "search.tmpl", "EDeA - Search", m)
+}
+
+// sortOptions of the search page
+var sortOptions = []struct{ Value, Label string }{
+	{"", "Relevance"},
+	{"updated_at:desc", "Recently updated"},
+	{"updated_at:asc", "Least recently updated"},
+	{"popularity:desc", "Most popular"},
+	{"name:asc", "Name"},
+}
+
+// facetValue is a value of a facet on the search page with the link which selects or deselects it
+type facetValue struct {
+	Value    string
+	Count    int64
+	Selected bool
+	URL      string
+}
+
+// facet lists the values of a facet on the search page
+type facet struct {
+	Name   string
+	Values []facetValue
+}
+
+// pageLink is a page of the search results
+type pageLink struct {
+	Number  int
+	URL     string
+	Current bool
+}
+
+// pagination of the search page, Prev and Next are empty on the first and last page
+type pagination struct {
+	Prev  string
+	Next  string
+	Pages []pageLink
+}
+
+// queryValues returns the parameters of a search page link for a query
+func queryValues(q Query) url.Values {
+	v := url.Values{}
+	if q.Text != "" {
+		v.Set("q", q.Text)
+	}
+	for _, f := range Facets {
+		for _, value := range q.Filters[f] {
+			v.Add(f, value)
+		}
+	}
+	if q.Sort != "" {
+		v.Set("sort", q.Sort)
+	}
+	if q.Limit > 0 && q.Limit != defaultLimit {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return v
+}
+
+// facetLinks returns the facets with the selected values first and the others by their number of hits
+func facetLinks(q Query, r *Result) []facet {
+	facets := make([]facet, 0, len(Facets))
+
+	for _, name := range Facets {
+		f := facet{Name: name}
+		selected := make(map[string]bool)
+
+		for _, value := range q.Filters[name] {
+			selected[value] = true
+
+			// the link deselects it
+			sq := q
+			sq.Filters = make(map[string][]string, len(q.Filters))
+			for k, v := range q.Filters {
+				sq.Filters[k] = v
+			}
+			sq.Filters[name] = nil
+			for _, other := range q.Filters[name] {
+				if other != value {
+					sq.Filters[name] = append(sq.Filters[name], other)
+				}
+			}
+
+			f.Values = append(f.Values, facetValue{Value: value, Count: r.Facets[name][value], Selected: true, URL: "/search?" + queryValues(sq).Encode()})
+		}
+
+		var others []facetValue
+		for value, count := range r.Facets[name] {
+			if selected[value] || value == "" {
+				continue
+			}
+			v := queryValues(q)
+			v.Add(name, value)
+			others = append(others, facetValue{Value: value, Count: count, URL: "/search?" + v.Encode()})
+		}
+		sort.Slice(others, func(i, j int) bool {
+			if others[i].Count != others[j].Count {
+				return others[i].Count > others[j].Count
+			}
+			return others[i].Value < others[j].Value
+		})
+
+		f.Values = append(f.Values, others...)
+		if len(f.Values) > 0 {
+			facets = append(facets, f)
+		}
+	}
+
+	return facets
+}
+
+// pageLinks returns the links to the pages around the current one
+func pageLinks(q Query, r *Result) pagination {
+	var p pagination
+
+	if r.Limit <= 0 || r.Total <= int64(r.Limit) {
+		return p
+	}
+
+	link := func(page int) string {
+		v := queryValues(q)
+		if page > 0 {
+			v.Set("offset", strconv.Itoa(page*r.Limit))
+		}
+		return "/search?" + v.Encode()
+	}
+
+	current := r.Offset / r.Limit
+	last := int((r.Total - 1) / int64(r.Limit))
+
+	if current > 0 {
+		p.Prev = link(current - 1)
+	}
+	if current < last {
+		p.Next = link(current + 1)
+	}
+
+	for page := current - 2; page <= current+2; page++ {
+		if page < 0 || page > last {
+			continue
+		}
+		p.Pages = append(p.Pages, pageLink{Number: page + 1, URL: link(page), Current: page == current})
+	}
+
+	return p
+}
@@ -0,0 +1,392 @@
+package search
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/units"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestQueryTerms(t *testing.T) {
+	got := queryTerms("  LDO 3.3V, low-noise ")
+	want := []string{"ldo", "3", "3v", "low", "noise"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if tsq := tsQuery([]string{"ldo", "3v"}); tsq != "ldo:* & 3v:*" {
+		t.Errorf("tsquery: got %q", tsq)
+	}
+}
+
+func TestHighlighter(t *testing.T) {
+	hl := highlighter([]string{"ldo", "a"})
+
+	if got, want := hl("Tiny LDO <3>"), "Tiny <em>LDO</em> &lt;3&gt;"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := hl("Buck & Boost"), "Buck &amp; Boost"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEscapeHighlights(t *testing.T) {
+	formatted := map[string]interface{}{
+		"name":   "\uE000<script>\uE001alert(1)</script>",
+		"tags":   []interface{}{"<b>", "ldo"},
+		"public": true,
+	}
+	escapeHighlights(formatted)
+
+	want := map[string]interface{}{
+		"name":   "<em>&lt;script&gt;</em>alert(1)&lt;/script&gt;",
+		"tags":   []interface{}{"&lt;b&gt;", "ldo"},
+		"public": true,
+	}
+	if !reflect.DeepEqual(formatted, want) {
+		t.Errorf("got %v, want %v", formatted, want)
+	}
+}
+
+// testDB migrates a throwaway SQLite database and uses it as model.DB during the test
+func testDB(t *testing.T) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "edea.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := model.RegisterCallbacks(db); err != nil {
+		t.Fatal(err)
+	}
+	old := model.DB
+	model.DB = db
+	t.Cleanup(func() { model.DB = old })
+
+	if _, err := model.MigrateUp(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// moduleSearch stores the modules in a test database and returns a function which finds
+// them with a parametric query in SQL, the names are in the order of the modules and have
+// to be the ones Match finds
+func moduleSearch(t *testing.T, modules []model.Module) func(Expr) ([]string, error) {
+	t.Helper()
+	testDB(t)
+
+	categories := make(map[string]string)
+	for i, m := range modules {
+		if name := m.Category.Name; name != "" && categories[name] == "" {
+			c := new(model.Category)
+			if err := model.DB.Where(model.Category{Name: name}).FirstOrCreate(c).Error; err != nil {
+				t.Fatal(err)
+			}
+			categories[name] = c.ID
+		}
+
+		// stored params are always normalized, the units given by the test win
+		if params, ok := m.Metadata["params"].(map[string]interface{}); ok {
+			normalized, found := units.NormalizeParams(params)
+			paramUnits, _ := m.Metadata["units"].(map[string]interface{})
+			if paramUnits == nil {
+				paramUnits = make(map[string]interface{})
+			}
+			for key, unit := range found {
+				if paramUnits[key] == nil {
+					paramUnits[key] = unit
+				}
+			}
+			modules[i].Metadata["params"], modules[i].Metadata["units"] = normalized, paramUnits
+		}
+
+		m.RepoURL = "https://example.com/" + m.Name
+		m.CategoryID, m.Category = categories[m.Category.Name], model.Category{}
+		if err := model.DB.Create(&m).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return func(e Expr) ([]string, error) {
+		t.Helper()
+
+		tx := model.DB.Model(&model.Module{}).Session(&gorm.Session{})
+		if err := unitMismatch(tx, e); err != nil {
+			return nil, err
+		}
+
+		cond, vars := moduleCondition(tx, e)
+		var found []string
+		if err := tx.Where(cond, vars...).Pluck("name", &found).Error; err != nil {
+			t.Fatalf("%s: %v", cond, err)
+		}
+
+		var names, matched []string
+		for i := range modules {
+			for _, name := range found {
+				if name == modules[i].Name {
+					names = append(names, name)
+				}
+			}
+			if e.Match(&modules[i]) {
+				matched = append(matched, modules[i].Name)
+			}
+		}
+		if !reflect.DeepEqual(names, matched) {
+			t.Errorf("%s: SQL found %v, Match %v", cond, names, matched)
+		}
+
+		return names, nil
+	}
+}
+
+func TestDatabaseBackend(t *testing.T) {
+	testDB(t)
+
+	d := NewDatabase()
+
+	err := d.Replace([]Entry{
+		{ID: "1", Type: "module", Name: "3.3V LDO", Description: "low noise", Author: "alice", UserID: "u1", Public: true,
+			Category: "Power", Tags: []string{"ldo", "linear"}, Popularity: 1, UpdatedAt: 100},
+		{ID: "2", Type: "module", Name: "Buck converter", Description: "5V from 24V", Author: "bob", UserID: "u2", Public: true,
+			Category: "Power", Tags: []string{"smps"}, Popularity: 3, UpdatedAt: 300},
+		{ID: "3", Type: "bench", Name: "LDO test bench", Author: "bob", UserID: "u2", Public: false, UpdatedAt: 200},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(q Query) []string {
+		t.Helper()
+		q.Limit = 10
+		r, err := d.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, h := range r.Hits {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+
+	if got := ids(Query{Text: "ldo"}); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("anonymous: got %v", got)
+	}
+	if got := ids(Query{Text: "ldo", UserID: "u2"}); !reflect.DeepEqual(got, []string{"1", "3"}) {
+		t.Errorf("owner: got %v", got)
+	}
+	if got := ids(Query{Text: "bob 24v"}); !reflect.DeepEqual(got, []string{"2"}) {
+		t.Errorf("all terms: got %v", got)
+	}
+
+	// facets and sorting work without text too
+	if got := ids(Query{Filters: map[string][]string{FacetCategory: {"Power"}}, Sort: "popularity:desc"}); !reflect.DeepEqual(got, []string{"2", "1"}) {
+		t.Errorf("category by popularity: got %v", got)
+	}
+	if got := ids(Query{Filters: map[string][]string{FacetTags: {"linear", "smps"}, FacetAuthor: {"alice"}}}); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("tags and author: got %v", got)
+	}
+	if got := ids(Query{Filters: map[string][]string{FacetType: {"bench", "module"}}, UserID: "u2", Sort: "updated_at:desc"}); !reflect.DeepEqual(got, []string{"2", "3", "1"}) {
+		t.Errorf("recently updated: got %v", got)
+	}
+
+	r, err := d.Query(Query{Text: "ldo", UserID: "u2", Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Total != 2 || len(r.Hits) != 1 || r.Hits[0].ID != "3" {
+		t.Errorf("second page: got %d hits of %d", len(r.Hits), r.Total)
+	}
+	want := map[string]map[string]int64{
+		FacetType:     {"module": 1, "bench": 1},
+		FacetCategory: {"Power": 1},
+		FacetAuthor:   {"alice": 1, "bob": 1},
+		FacetTags:     {"ldo": 1, "linear": 1},
+	}
+	if !reflect.DeepEqual(r.Facets, want) {
+		t.Errorf("facets: got %v, want %v", r.Facets, want)
+	}
+
+	if err := d.Update(Entry{ID: "2", Type: "module", Name: "Buck", UserID: "u2", Public: false}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+
+	docs, err := d.Documents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 || docs[0].Public || docs[1].Public {
+		t.Errorf("documents after update and delete: %+v", docs)
+	}
+
+	// the names come from the users and are shown as HTML
+	if err := d.Update(Entry{ID: "4", Type: "module", Name: "<script>alert(1)</script>", Author: "<b>eve</b>", UserID: "u3", Public: true}); err != nil {
+		t.Fatal(err)
+	}
+	r, err = d.Query(Query{Text: "script", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Hits) != 1 {
+		t.Fatalf("script: got %d hits", len(r.Hits))
+	}
+	if got, want := r.Hits[0].Formatted["name"], "&lt;<em>script</em>&gt;alert(1)&lt;/<em>script</em>&gt;"; got != want {
+		t.Errorf("escaped name: got %q, want %q", got, want)
+	}
+	if got, want := r.Hits[0].Formatted["author"], "&lt;b&gt;eve&lt;/b&gt;"; got != want {
+		t.Errorf("escaped author: got %q, want %q", got, want)
+	}
+}
+
+func TestFilterModules(t *testing.T) {
+	module := func(name string, params, paramUnits map[string]interface{}) model.Module {
+		return model.Module{Name: name, Metadata: datatypes.JSONMap{"params": params, "units": paramUnits}}
+	}
+	modules := []model.Module{
+		module("ldo", map[string]interface{}{"v_out": 3.3, "i_out": 0.5}, map[string]interface{}{"v_out": "V", "i_out": "A"}),
+		module("buck", map[string]interface{}{"v_out": []interface{}{1.8, 5.0}, "i_out": 2.0}, map[string]interface{}{"v_out": "V", "i_out": "A"}),
+		module("divider", map[string]interface{}{"r": 4700.0, "package": "0603"}, nil),
+	}
+
+	search := moduleSearch(t, modules)
+	names := func(sp ...SearchParam) ([]string, error) {
+		t.Helper()
+		expr, err := ModuleQuery{Params: sp}.Expr()
+		if err != nil {
+			return nil, err
+		}
+		return search(expr)
+	}
+
+	tests := []struct {
+		params []SearchParam
+		want   []string
+	}{
+		{[]SearchParam{{Field: "v_out", Op: "=", Values: []string{"3.3V"}}}, []string{"ldo"}},
+		{[]SearchParam{{Field: "v_out", Op: ">", Values: []string{"3000mV"}}}, []string{"ldo", "buck"}},
+		{[]SearchParam{{Field: "i_out", Op: "<", Values: []string{"1A"}}}, []string{"ldo"}},
+		{[]SearchParam{{Field: "i_out", Values: []string{"500mA", "2A"}}}, []string{"ldo", "buck"}},
+		{[]SearchParam{{Field: "v_out", Op: "=", Values: []string{"5"}}, {Field: "i_out", Op: ">", Values: []string{"1"}}}, []string{"buck"}},
+		{[]SearchParam{{Field: "r", Op: "=", Values: []string{"4k7"}}}, []string{"divider"}},
+		{[]SearchParam{{Field: "package", Op: "=", Values: []string{"0603"}}}, []string{"divider"}},
+	}
+
+	for _, tt := range tests {
+		got, err := names(tt.params...)
+		if err != nil {
+			t.Errorf("%+v: %v", tt.params, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: got %v, want %v", tt.params, got, tt.want)
+		}
+	}
+
+	if _, err := names(SearchParam{Field: "v_out", Op: "=", Values: []string{"500mA"}}); !errors.Is(err, units.ErrUnitMismatch) {
+		t.Errorf("expected a unit mismatch, got %v", err)
+	}
+	if _, err := names(SearchParam{Field: "v_out", Values: []string{"3.3V", "1A"}}); !errors.Is(err, units.ErrUnitMismatch) {
+		t.Errorf("expected a unit mismatch between values, got %v", err)
+	}
+	if _, err := names(SearchParam{Field: "v_out", Op: "~", Values: []string{"3.3V"}}); err == nil {
+		t.Error("expected an error for an invalid op")
+	}
+}
+
+func TestMatchEntry(t *testing.T) {
+	e := Entry{Type: "module", Name: "Buck 5A", Author: "alice", Description: "Synchronous step-down converter",
+		UserID: "alice-id", Public: true, Category: "Power", Tags: []string{"buck", "dcdc"}}
+
+	tests := []struct {
+		q    Query
+		want bool
+	}{
+		{Query{Text: "buck step"}, true},
+		{Query{Text: "buck boost"}, false},
+		{Query{Text: "ALICE"}, true},
+		{Query{Filters: map[string][]string{FacetTags: {"ldo", "dcdc"}}}, true},
+		{Query{Text: "buck", Filters: map[string][]string{FacetCategory: {"MCU"}}}, false},
+		{Query{Filters: map[string][]string{FacetType: {"module"}, FacetAuthor: {"alice"}}}, true},
+	}
+
+	for _, tt := range tests {
+		if got := MatchEntry(tt.q, e); got != tt.want {
+			t.Errorf("%+v: got %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	e.Public = false
+	if MatchEntry(Query{Text: "buck"}, e) {
+		t.Error("private entries only match for their owner")
+	}
+	if !MatchEntry(Query{Text: "buck", UserID: "alice-id"}, e) {
+		t.Error("private entries match for their owner")
+	}
+}
+
+func TestModuleQueryMatch(t *testing.T) {
+	m := &model.Module{CategoryID: "power-id", Category: model.Category{Name: "Power"},
+		Metadata: datatypes.JSONMap{"params": map[string]interface{}{"i_out_max": 5.0}, "units": map[string]interface{}{"i_out_max": "A"}}}
+
+	tests := []struct {
+		mq   ModuleQuery
+		want bool
+	}{
+		{ModuleQuery{Query: "i_out_max > 3A"}, true},
+		{ModuleQuery{Query: "i_out_max > 3A", Category: "mcu-id"}, false},
+		{ModuleQuery{Params: []SearchParam{{Field: "i_out_max", Op: ">=", Values: []string{"6A"}}}, Category: "power-id"}, false},
+		{ModuleQuery{Query: "category = Power"}, true},
+		{ModuleQuery{Query: "i_out_max > 3V"}, false},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.mq.Match(m)
+		if err != nil {
+			t.Errorf("%+v: %v", tt.mq, err)
+		} else if got != tt.want {
+			t.Errorf("%+v: got %v, want %v", tt.mq, got, tt.want)
+		}
+	}
+
+	if _, err := (ModuleQuery{Query: "i_out_max >"}).Match(m); err == nil {
+		t.Error("expected an error for an invalid query")
+	}
+}
+
+func TestCollectParams(t *testing.T) {
+	moduleSearch(t, []model.Module{
+		{Name: "ldo", Metadata: datatypes.JSONMap{"params": map[string]interface{}{"v_out": 3.3, "package": "SOT-23"},
+			"units": map[string]interface{}{"v_out": "V"}}},
+		{Name: "buck", Metadata: datatypes.JSONMap{"params": map[string]interface{}{"v_out": []interface{}{1.8, 3.3}, "pins": 3.0, "sync": true},
+			"units": map[string]interface{}{"v_out": "V"}}},
+		{Name: "secret", Private: true, Metadata: datatypes.JSONMap{"params": map[string]interface{}{"v_out": 12.0, "secret": "yes"}}},
+		{Name: "unimported"},
+	})
+
+	rows, err := moduleParams(model.DB, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collectParams(rows)
+	want := map[string][]interface{}{
+		"v_out":   {"1.8V", "3.3V"},
+		"package": {"SOT-23"},
+		"pins":    {3.0},
+		"sync":    {true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
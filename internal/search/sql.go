@@ -0,0 +1,283 @@
+package search
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"fmt"
+	"strings"
+
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/units"
+	"gorm.io/gorm"
+)
+
+// jsonDialect has the expressions which expand the params of a module, p is a parameter with its
+// key and v one of its values, a single value for plain parameters and every item of a list
+type jsonDialect struct {
+	params   string // FROM item of the parameters
+	values   string // FROM item of the values of p
+	units    string // FROM item of the units, u.key and u.value
+	text     string // v as text, compared byte by byte
+	json     string // v as JSON
+	number   string // v if it's a number, NULL otherwise
+	category string // name of the category of the module, compared byte by byte
+	greatest string
+}
+
+var (
+	sqliteJSON = jsonDialect{
+		params:   "json_each(modules.metadata, '$.params') AS p",
+		values:   "json_each(modules.metadata, p.fullkey) AS v",
+		units:    "json_each(modules.metadata, '$.units') AS u",
+		text:     "CASE v.type WHEN 'true' THEN 'true' WHEN 'false' THEN 'false' ELSE CAST(v.value AS TEXT) END",
+		json:     "CASE v.type WHEN 'true' THEN 'true' WHEN 'false' THEN 'false' WHEN 'null' THEN 'null' ELSE json_quote(v.value) END",
+		number:   "CASE WHEN v.type IN ('integer', 'real') THEN v.value END",
+		category: "COALESCE((SELECT categories.name FROM categories WHERE categories.id = modules.category_id), '')",
+		greatest: "max",
+	}
+	postgresJSON = jsonDialect{
+		params:   "jsonb_each(CASE jsonb_typeof(modules.metadata -> 'params') WHEN 'object' THEN modules.metadata -> 'params' END) AS p",
+		values:   "jsonb_array_elements(CASE jsonb_typeof(p.value) WHEN 'array' THEN p.value ELSE jsonb_build_array(p.value) END) AS v(value)",
+		units:    "jsonb_each_text(CASE jsonb_typeof(modules.metadata -> 'units') WHEN 'object' THEN modules.metadata -> 'units' END) AS u",
+		text:     `(v.value #>> '{}') COLLATE "C"`,
+		json:     "v.value::text",
+		number:   "CASE jsonb_typeof(v.value) WHEN 'number' THEN (v.value #>> '{}')::float8 END",
+		category: `COALESCE((SELECT categories.name FROM categories WHERE categories.id = modules.category_id), '') COLLATE "C"`,
+		greatest: "GREATEST",
+	}
+)
+
+// moduleParams returns the distinct values of the parameters of public modules, of a single
+// category if it isn't empty
+func moduleParams(tx *gorm.DB, category string) ([]paramRow, error) {
+	d := postgresJSON
+	if model.SQLite(tx) {
+		d = sqliteJSON
+	}
+
+	tx = tx.Table("modules, " + d.params + ", " + d.values).
+		Select("DISTINCT p.key AS key, " + d.json + " AS value, COALESCE((SELECT u.value FROM " + d.units + " WHERE u.key = p.key), '') AS unit").
+		Where("modules.deleted_at IS NULL AND modules.private = false")
+	if category != "" {
+		tx = tx.Where("modules.category_id = ?", category)
+	}
+
+	var rows []paramRow
+	return rows, tx.Scan(&rows).Error
+}
+
+// sqlWriter turns a parametric query into a condition on the modules table which matches the
+// same modules as Match does for normalized params, every part of it is either true or false
+// so NOT works like in Go
+type sqlWriter struct {
+	d    jsonDialect
+	sb   strings.Builder
+	vars []interface{}
+}
+
+// moduleCondition returns the condition of the expression and its variables for Where
+func moduleCondition(tx *gorm.DB, e Expr) (string, []interface{}) {
+	w := &sqlWriter{d: postgresJSON}
+	if model.SQLite(tx) {
+		w.d = sqliteJSON
+	}
+
+	w.expr(e)
+	return w.sb.String(), w.vars
+}
+
+func (w *sqlWriter) write(sql string, vars ...interface{}) {
+	w.sb.WriteString(sql)
+	w.vars = append(w.vars, vars...)
+}
+
+func (w *sqlWriter) expr(e Expr) {
+	switch x := e.(type) {
+	case andExpr:
+		w.join(x, " AND ", "1 = 1")
+	case orExpr:
+		w.join(x, " OR ", "1 = 0")
+	case notExpr:
+		w.write("(NOT ")
+		w.expr(x.Expr)
+		w.write(")")
+	case *comparison:
+		w.comparison(x)
+	}
+}
+
+// join combines the expressions with op, without any it's the neutral element
+func (w *sqlWriter) join(exprs []Expr, op, empty string) {
+	if len(exprs) == 0 {
+		w.write("(" + empty + ")")
+		return
+	}
+
+	w.write("(")
+	for i, x := range exprs {
+		if i > 0 {
+			w.write(op)
+		}
+		w.expr(x)
+	}
+	w.write(")")
+}
+
+func (w *sqlWriter) comparison(c *comparison) {
+	if c.field == categoryField {
+		w.category(c)
+		return
+	}
+
+	switch c.op {
+	case "exists", "missing":
+		w.write("(")
+		if c.op == "missing" {
+			w.write("NOT ")
+		}
+		w.write("EXISTS (SELECT 1 FROM "+w.d.params+" WHERE p.key = ?))", c.field)
+	case "!=":
+		// the parameter has to be there in the right unit with none of the values
+		w.write("(EXISTS (SELECT 1 FROM "+w.d.params+" WHERE p.key = ?", c.field)
+		w.unit(c)
+		w.write(") AND NOT EXISTS (SELECT 1 FROM "+w.d.params+", "+w.d.values+" WHERE p.key = ? AND ", c.field)
+		w.values(c, "=", w.d.text)
+		w.write("))")
+	default:
+		w.write("(EXISTS (SELECT 1 FROM "+w.d.params+", "+w.d.values+" WHERE p.key = ?", c.field)
+		w.unit(c)
+		w.write(" AND ")
+		w.values(c, c.op, w.d.text)
+		w.write("))")
+	}
+}
+
+// unit skips parameters in another unit than the quantities of the comparison
+func (w *sqlWriter) unit(c *comparison) {
+	if c.quantities != nil && c.unit != "" {
+		w.write(" AND NOT EXISTS (SELECT 1 FROM "+w.d.units+" WHERE u.key = p.key AND u.value NOT IN ('', ?))", c.unit)
+	}
+}
+
+// category compares the name of the category as text, every module has one even if it's empty
+func (w *sqlWriter) category(c *comparison) {
+	switch c.op {
+	case "exists":
+		w.write("(1 = 1)")
+	case "missing":
+		w.write("(1 = 0)")
+	case "!=":
+		w.write("(NOT ")
+		w.text(c, "=", w.d.category)
+		w.write(")")
+	default:
+		w.text(c, c.op, w.d.category)
+	}
+}
+
+// values compares v numerically if the comparison has quantities and as text otherwise
+func (w *sqlWriter) values(c *comparison, op, text string) {
+	if c.quantities == nil {
+		w.text(c, op, text)
+		return
+	}
+
+	if op == "between" {
+		w.write("(")
+		w.number(">=", c.quantities[0])
+		w.write(" AND ")
+		w.number("<=", c.quantities[1])
+		w.write(")")
+		return
+	}
+
+	w.write("(")
+	for i, q := range c.quantities {
+		if i > 0 {
+			w.write(" OR ")
+		}
+		w.number(op, q)
+	}
+	w.write(")")
+}
+
+// number compares v with a quantity, values which only differ by rounding are equal as in compareFloat
+func (w *sqlWriter) number(op string, q units.Quantity) {
+	n := w.d.number
+	eq := fmt.Sprintf("abs(%s - ?) <= 1e-9 * %s(abs(%s), abs(?))", n, w.d.greatest, n)
+
+	switch op {
+	case "<", ">":
+		w.write("("+n+" "+op+" ? AND NOT ("+eq+"))", q.Value, q.Value, q.Value)
+	case "<=", ">=":
+		w.write("("+n+" "+op[:1]+" ? OR "+eq+")", q.Value, q.Value, q.Value)
+	default:
+		w.write("("+eq+")", q.Value, q.Value)
+	}
+}
+
+// text compares the expression with the texts of the comparison, equal ignores the case
+func (w *sqlWriter) text(c *comparison, op, expr string) {
+	cmp := func(op, t string) {
+		eq := "lower(" + expr + ") = lower(?)"
+
+		switch op {
+		case "<", ">":
+			w.write("("+expr+" "+op+" ? AND NOT ("+eq+"))", t, t)
+		case "<=", ">=":
+			w.write("("+expr+" "+op[:1]+" ? OR "+eq+")", t, t)
+		default:
+			w.write("("+eq+")", t)
+		}
+	}
+
+	if op == "between" {
+		w.write("(")
+		cmp(">=", c.text[0])
+		w.write(" AND ")
+		cmp("<=", c.text[1])
+		w.write(")")
+		return
+	}
+
+	w.write("(")
+	for i, t := range c.text {
+		if i > 0 {
+			w.write(" OR ")
+		}
+		cmp(op, t)
+	}
+	w.write(")")
+}
+
+// unitMismatch returns an error if a numeric comparison is in a unit none of the modules of the
+// query have the parameter in, while some have it in another one
+func unitMismatch(tx *gorm.DB, e Expr) error {
+	from := "(?) AS modules, " + postgresJSON.units
+	if model.SQLite(tx) {
+		from = "(?) AS modules, " + sqliteJSON.units
+	}
+
+	var err error
+	comparisons(e, func(c *comparison) {
+		if err != nil || c.quantities == nil || c.unit == "" || c.field == categoryField {
+			return
+		}
+
+		var found []string
+		err = model.DB.Table(from, tx.Select("modules.metadata")).
+			Where("u.key = ? AND u.value <> ''", c.field).Distinct().Pluck("u.value", &found).Error
+		if err != nil || len(found) == 0 {
+			return
+		}
+
+		for _, unit := range found {
+			if unit == c.unit {
+				return
+			}
+		}
+		err = fmt.Errorf("%w: param %s is in %s, not %s", units.ErrUnitMismatch, c.field, found[0], c.unit)
+	})
+
+	return err
+}
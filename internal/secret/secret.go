@@ -0,0 +1,86 @@
+// Package secret encrypts values which have to be stored at rest, such as repository credentials.
+package secret
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+
+	"gitlab.com/edea-dev/edea-server/internal/config"
+)
+
+var (
+	// ErrNoKey is returned when no key is configured or it isn't a base64 encoded 32 byte key
+	ErrNoKey = errors.New("credentials.key has to be a base64 encoded 32 byte key")
+	// ErrInvalid is returned when a value was tampered with or encrypted with another key
+	ErrInvalid = errors.New("could not decrypt the secret")
+)
+
+// Enabled returns true if a valid key is configured
+func Enabled() bool {
+	_, err := key()
+	return err == nil
+}
+
+// Seal encrypts and authenticates a value with AES-256-GCM, the nonce is prepended to the result
+func Seal(plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts a value encrypted with Seal
+func Open(ciphertext []byte) ([]byte, error) {
+	aead, err := newAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrInvalid
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	return plaintext, nil
+}
+
+func newAEAD() (cipher.AEAD, error) {
+	k, err := key()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func key() ([]byte, error) {
+	k, err := base64.StdEncoding.DecodeString(config.Cfg.Credentials.Key)
+	if err != nil || len(k) != 32 {
+		return nil, ErrNoKey
+	}
+	return k, nil
+}
@@ -0,0 +1,59 @@
+package secret
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"gitlab.com/edea-dev/edea-server/internal/config"
+)
+
+func TestSealOpen(t *testing.T) {
+	config.Cfg.Credentials.Key = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+	plaintext := []byte("glpat-0123456789")
+
+	sealed, err := Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Fatal("sealed value contains the plaintext")
+	}
+
+	opened, err := Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Fatalf("got %q, want %q", opened, plaintext)
+	}
+
+	// the nonce is random, the same value never encrypts the same twice
+	if again, _ := Seal(plaintext); bytes.Equal(again, sealed) {
+		t.Error("sealing twice gave the same result")
+	}
+
+	sealed[len(sealed)-1] ^= 1
+	if _, err := Open(sealed); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid for a tampered value, got %v", err)
+	}
+
+	// a different key can't open it
+	sealed[len(sealed)-1] ^= 1
+	config.Cfg.Credentials.Key = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+	if _, err := Open(sealed); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid for another key, got %v", err)
+	}
+}
+
+func TestNoKey(t *testing.T) {
+	for _, k := range []string{"", "c2hvcnQ=", "not base64"} {
+		config.Cfg.Credentials.Key = k
+		if _, err := Seal([]byte("x")); !errors.Is(err, ErrNoKey) {
+			t.Errorf("key %q: expected ErrNoKey, got %v", k, err)
+		}
+	}
+}
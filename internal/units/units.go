@@ -0,0 +1,244 @@
+// Package units parses parameter values with SI prefixes and units like "3.3V", "500mA" or "4k7",
+// so that they can be stored and compared as plain numbers.
+package units
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotQuantity is returned for values which aren't a number with an optional prefix and unit
+	ErrNotQuantity = errors.New("not a quantity")
+	// ErrUnitMismatch is returned when values with different units are compared
+	ErrUnitMismatch = errors.New("units don't match")
+)
+
+// Quantity is a value in its base unit, e.g. 500mA is 0.5 A
+type Quantity struct {
+	Value float64
+	Unit  string // canonical unit symbol, empty for plain numbers
+}
+
+// Units are the supported units by their canonical symbol
+var Units = []string{"V", "A", "W", "Hz", "Ω"}
+
+// Known reports whether the unit is one of Units
+func Known(unit string) bool {
+	for _, u := range Units {
+		if u == unit {
+			return true
+		}
+	}
+	return false
+}
+
+// aliases map the accepted spellings of a unit to its symbol
+var aliases = map[string]string{
+	"V": "V", "v": "V",
+	"A": "A", "a": "A",
+	"W": "W", "w": "W",
+	"Hz": "Hz", "hz": "Hz", "HZ": "Hz",
+	"Ω": "Ω", "\u2126": "Ω", "ohm": "Ω", "ohms": "Ω", "Ohm": "Ω", "Ohms": "Ω", "R": "Ω",
+}
+
+// prefixes map SI prefixes to their power of ten
+var prefixes = map[string]int{
+	"p": -12, "n": -9, "u": -6, "µ": -6, "μ": -6, "m": -3,
+	"k": 3, "K": 3, "M": 6, "G": 9,
+}
+
+var (
+	numberRe = regexp.MustCompile(`^([+-]?)(\d+(?:\.\d*)?|\.\d+)(?:[eE]([+-]?\d+))?\s*(.*)$`)
+	// resistor notation puts the prefix where the decimal point is, e.g. 4k7 or 2R2
+	infixRe = regexp.MustCompile(`^([+-]?)(\d+)(p|n|u|µ|μ|m|k|K|M|G|R)(\d+)\s*(.*)$`)
+)
+
+// Parse reads a number with an optional SI prefix and unit
+func Parse(s string) (Quantity, error) {
+	s = strings.TrimSpace(s)
+
+	if m := infixRe.FindStringSubmatch(s); m != nil {
+		exp, unit := 0, m[5]
+		if m[3] == "R" {
+			// 2R2 is 2.2Ω unless another unit follows
+			if unit == "" {
+				unit = "Ω"
+			}
+		} else {
+			exp = prefixes[m[3]]
+		}
+		if u, ok := aliases[unit]; ok || unit == "" {
+			return quantity(m[1], m[2]+"."+m[4], exp, u)
+		}
+		return Quantity{}, fmt.Errorf("%w: %q", ErrNotQuantity, s)
+	}
+
+	m := numberRe.FindStringSubmatch(s)
+	if m == nil {
+		return Quantity{}, fmt.Errorf("%w: %q", ErrNotQuantity, s)
+	}
+
+	exp := 0
+	if m[3] != "" {
+		e, err := strconv.Atoi(m[3])
+		if err != nil {
+			return Quantity{}, fmt.Errorf("%w: %q", ErrNotQuantity, s)
+		}
+		exp = e
+	}
+
+	unit, prefix, ok := suffix(m[4])
+	if !ok {
+		return Quantity{}, fmt.Errorf("%w: %q", ErrNotQuantity, s)
+	}
+
+	return quantity(m[1], m[2], exp+prefix, unit)
+}
+
+// suffix splits what follows the number into the prefix exponent and the unit
+func suffix(s string) (unit string, exp int, ok bool) {
+	if s == "" {
+		return "", 0, true
+	}
+	// whole units first so that e.g. "m" is never taken from a unit
+	if u, ok := aliases[s]; ok && s != "R" {
+		return u, 0, true
+	}
+	for p, e := range prefixes {
+		if !strings.HasPrefix(s, p) {
+			continue
+		}
+		rest := strings.TrimSpace(s[len(p):])
+		if rest == "" {
+			return "", e, true
+		}
+		if u, ok := aliases[rest]; ok && rest != "R" {
+			return u, e, true
+		}
+	}
+	return "", 0, false
+}
+
+// quantity builds the value from its decimal representation so that e.g. 500mA is exactly 0.5
+func quantity(sign, mantissa string, exp int, unit string) (Quantity, error) {
+	v, err := strconv.ParseFloat(sign+mantissa+"e"+strconv.Itoa(exp), 64)
+	if err != nil {
+		return Quantity{}, fmt.Errorf("%w: %v", ErrNotQuantity, err)
+	}
+	return Quantity{Value: v, Unit: unit}, nil
+}
+
+// String formats the quantity with the SI prefix that fits, e.g. 0.5 A is "500mA"
+func (q Quantity) String() string {
+	return Format(q.Value, q.Unit)
+}
+
+// Format formats a value in its base unit, plain numbers are formatted without a prefix
+func Format(v float64, unit string) string {
+	if unit == "" || v == 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return strconv.FormatFloat(v, 'g', -1, 64) + unit
+	}
+
+	exp := int(math.Floor(math.Log10(math.Abs(v))/3)) * 3
+	if exp < -12 {
+		exp = -12
+	} else if exp > 9 {
+		exp = 9
+	}
+
+	// round away the representation error of the division
+	mantissa, _ := strconv.ParseFloat(strconv.FormatFloat(v/math.Pow10(exp), 'g', 12, 64), 64)
+
+	return strconv.FormatFloat(mantissa, 'f', -1, 64) + symbol(exp) + unit
+}
+
+func symbol(exp int) string {
+	switch exp {
+	case -12:
+		return "p"
+	case -9:
+		return "n"
+	case -6:
+		return "µ"
+	case -3:
+		return "m"
+	case 3:
+		return "k"
+	case 6:
+		return "M"
+	case 9:
+		return "G"
+	}
+	return ""
+}
+
+// Compatible returns ErrUnitMismatch if the quantity can't be compared with values in the given unit,
+// plain numbers are compatible with everything
+func (q Quantity) Compatible(unit string) error {
+	if q.Unit == "" || unit == "" || q.Unit == unit {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is in %s, not %s", ErrUnitMismatch, q, q.Unit, unit)
+}
+
+// Normalize converts a parameter value or a list of values to numbers in their base unit.
+// Values which aren't quantities, and lists mixing units, are returned unchanged.
+func Normalize(value interface{}) (interface{}, string) {
+	switch v := value.(type) {
+	case string:
+		q, err := Parse(v)
+		if err != nil {
+			return v, ""
+		}
+		return q.Value, q.Unit
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		unit := ""
+		for i, item := range v {
+			n, u := Normalize(item)
+			if !isNumber(n) {
+				return v, ""
+			}
+			if u != "" && unit != "" && u != unit {
+				return v, ""
+			}
+			if u != "" {
+				unit = u
+			}
+			values[i] = n
+		}
+		return values, unit
+	}
+	return value, ""
+}
+
+// NormalizeParams normalizes all parameters, the units are returned separately by parameter
+func NormalizeParams(params map[string]interface{}) (map[string]interface{}, map[string]string) {
+	normalized := make(map[string]interface{}, len(params))
+	units := make(map[string]string)
+
+	for key, value := range params {
+		v, unit := Normalize(value)
+		normalized[key] = v
+		if unit != "" {
+			units[key] = unit
+		}
+	}
+
+	return normalized, units
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, int64, uint64, float32, float64:
+		return true
+	}
+	return false
+}
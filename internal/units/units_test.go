@@ -0,0 +1,89 @@
+package units
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Quantity
+		str  string
+	}{
+		{"3.3V", Quantity{3.3, "V"}, "3.3V"},
+		{"500mA", Quantity{0.5, "A"}, "500mA"},
+		{"2.2k", Quantity{2200, ""}, "2200"},
+		{"4k7", Quantity{4700, ""}, "4700"},
+		{"4k7Ω", Quantity{4700, "Ω"}, "4.7kΩ"},
+		{"2R2", Quantity{2.2, "Ω"}, "2.2Ω"},
+		{"10 kohm", Quantity{10000, "Ω"}, "10kΩ"},
+		{"100nA", Quantity{1e-7, "A"}, "100nA"},
+		{"4.7uW", Quantity{4.7e-6, "W"}, "4.7µW"},
+		{"2.4 GHz", Quantity{2.4e9, "Hz"}, "2.4GHz"},
+		{"12", Quantity{12, ""}, "12"},
+		{"-5v", Quantity{-5, "V"}, "-5V"},
+		{"1e3Hz", Quantity{1000, "Hz"}, "1kHz"},
+		{".1 mW", Quantity{1e-4, "W"}, "100µW"},
+	}
+
+	for _, tt := range tests {
+		q, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if q != tt.want {
+			t.Errorf("%q: got %#v, want %#v", tt.in, q, tt.want)
+		}
+		if s := q.String(); s != tt.str {
+			t.Errorf("%q: formatted as %q, want %q", tt.in, s, tt.str)
+		}
+	}
+
+	for _, in := range []string{"", "SOT-23", "1N4148", "3.3VDC", "5mm", "k", "V"} {
+		if q, err := Parse(in); !errors.Is(err, ErrNotQuantity) {
+			t.Errorf("%q: expected ErrNotQuantity, got %v, %v", in, q, err)
+		}
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	q, _ := Parse("3.3V")
+	if err := q.Compatible("V"); err != nil {
+		t.Error(err)
+	}
+	if err := q.Compatible(""); err != nil {
+		t.Error(err)
+	}
+	if err := q.Compatible("A"); !errors.Is(err, ErrUnitMismatch) {
+		t.Errorf("expected ErrUnitMismatch, got %v", err)
+	}
+}
+
+func TestNormalizeParams(t *testing.T) {
+	params, units := NormalizeParams(map[string]interface{}{
+		"vin":     "5V",
+		"vout":    []interface{}{"3.3V", "1800mV"},
+		"mixed":   []interface{}{"3.3V", "1A"},
+		"package": "SOT-23",
+		"pins":    3,
+	})
+
+	want := map[string]interface{}{
+		"vin":     5.0,
+		"vout":    []interface{}{3.3, 1.8},
+		"mixed":   []interface{}{"3.3V", "1A"},
+		"package": "SOT-23",
+		"pins":    3,
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("got %#v, want %#v", params, want)
+	}
+	if !reflect.DeepEqual(units, map[string]string{"vin": "V", "vout": "V"}) {
+		t.Errorf("unexpected units %v", units)
+	}
+}
@@ -0,0 +1,84 @@
+package admin
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/config"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/refresh"
+	"gitlab.com/edea-dev/edea-server/internal/repo"
+	"gitlab.com/edea-dev/edea-server/internal/view"
+	"go.uber.org/zap"
+)
+
+// Index shows the state of the repository refresh and modules which couldn't be refreshed
+func Index(c *gin.Context) {
+	var failed []model.Module
+
+	result := model.DB.Where("refresh_error <> ''").Order("refresh_error_at desc").Find(&failed)
+	if result.Error != nil {
+		zap.L().Panic("could not fetch modules with refresh errors", zap.Error(result.Error))
+	}
+
+	usage, err := repo.Usage()
+	if err != nil {
+		zap.L().Panic("could not fetch repository cache usage", zap.Error(err))
+	}
+
+	m := map[string]interface{}{
+		"Refresh":  refresh.Current(),
+		"Interval": config.Cfg.Refresh.Interval,
+		"Failed":   failed,
+		"Cache":    usage,
+	}
+
+	view.RenderTemplate(c, "admin/index.tmpl", "EDeA - Admin", m)
+}
+
+// Refresh starts refreshing all repositories in the background
+func Refresh(c *gin.Context) {
+	if err := refresh.Start(config.Cfg.Refresh.Concurrency); err != nil && !errors.Is(err, refresh.ErrRunning) {
+		zap.L().Panic("could not start repository refresh", zap.Error(err))
+	}
+
+	c.Redirect(http.StatusSeeOther, "/admin")
+}
+
+// Cache shows the disk usage of the repository cache
+func Cache(c *gin.Context) {
+	usage, err := repo.Usage()
+	if err != nil {
+		zap.L().Panic("could not fetch repository cache usage", zap.Error(err))
+	}
+
+	m := map[string]interface{}{
+		"Usage":   usage,
+		"Evicted": c.Query("evicted"),
+	}
+
+	view.RenderTemplate(c, "admin/cache.tmpl", "EDeA - Repository Cache", m)
+}
+
+// UpdateCacheSizes recalculates the size of all cached repositories
+func UpdateCacheSizes(c *gin.Context) {
+	if err := repo.UpdateSizes(); err != nil {
+		zap.L().Panic("could not update repository sizes", zap.Error(err))
+	}
+
+	c.Redirect(http.StatusSeeOther, "/admin/cache")
+}
+
+// EvictCache removes all repositories which no module, bench or snapshot needs
+func EvictCache(c *gin.Context) {
+	evicted, err := repo.EvictUnused()
+	if err != nil {
+		zap.L().Panic("could not evict repositories", zap.Error(err))
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/cache?evicted=%d", len(evicted)))
+}
@@ -0,0 +1,114 @@
+package admin
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/view"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Catalog shows the categories and the filters of the parametric search
+func Catalog(c *gin.Context) {
+	renderCatalog(c, c.Query("message"), nil)
+}
+
+func renderCatalog(c *gin.Context, message string, err error) {
+	categories, cerr := ops.Categories(c)
+	if cerr != nil {
+		zap.L().Panic("could not fetch categories", zap.Error(cerr))
+	}
+
+	filters, ferr := ops.Filters(c)
+	if ferr != nil {
+		zap.L().Panic("could not fetch filters", zap.Error(ferr))
+	}
+
+	m := map[string]interface{}{
+		"Categories": categories,
+		"Filters":    filters,
+		"Default":    ops.DefaultCategory,
+		"Message":    message,
+	}
+	if err != nil {
+		m["Error"] = err.Error()
+	}
+
+	view.RenderTemplate(c, "admin/catalog.tmpl", "EDeA - Categories and Filters", m)
+}
+
+// catalogDone redirects back to the catalog or shows the mistake of the admin, anything else is a bug
+func catalogDone(c *gin.Context, message string, err error) {
+	switch {
+	case err == nil:
+		c.Redirect(http.StatusSeeOther, "/admin/catalog?message="+url.QueryEscape(message))
+	case errors.Is(err, ops.ErrEmptyName), errors.Is(err, ops.ErrCategoryExists), errors.Is(err, ops.ErrDefaultCategory),
+		errors.Is(err, ops.ErrSameCategory), errors.Is(err, ops.ErrFilterExists), errors.Is(err, ops.ErrInvalidFilterKey),
+		errors.Is(err, gorm.ErrRecordNotFound):
+		renderCatalog(c, "", err)
+	default:
+		zap.L().Panic("could not change the catalog", zap.Error(err))
+	}
+}
+
+// CreateCategory adds a new category
+func CreateCategory(c *gin.Context) {
+	_, err := ops.CreateCategory(c, &model.Category{Name: c.PostForm("name"), Description: c.PostForm("description")})
+	catalogDone(c, "Category created.", err)
+}
+
+// UpdateCategory renames a category or changes its description
+func UpdateCategory(c *gin.Context) {
+	_, err := ops.UpdateCategory(c, categoryID(c.Param("id")), &model.Category{Name: c.PostForm("name"), Description: c.PostForm("description")})
+	catalogDone(c, "Category saved.", err)
+}
+
+// DeleteCategory removes a category and moves its modules into the chosen one
+func DeleteCategory(c *gin.Context) {
+	into := c.PostForm("into")
+	if into != "" {
+		into = categoryID(into)
+	}
+
+	moved, err := ops.DeleteCategory(c, categoryID(c.Param("id")), into)
+	catalogDone(c, fmt.Sprintf("Category removed, %d modules were moved.", moved), err)
+}
+
+// categoryID returns the id if it's a uuid and the nil uuid otherwise, which no category has,
+// so that a mistyped id is not found instead of making the database fail
+func categoryID(id string) string {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil.String()
+	}
+	return u.String()
+}
+
+// CreateFilter adds a filter for a parameter
+func CreateFilter(c *gin.Context) {
+	_, err := ops.CreateFilter(c, &model.Filter{Key: c.PostForm("key"), Name: c.PostForm("name"), Description: c.PostForm("description")})
+	catalogDone(c, "Filter created.", err)
+}
+
+// UpdateFilter changes the key, name or description of a filter
+func UpdateFilter(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	_, err := ops.UpdateFilter(c, uint(id), &model.Filter{Key: c.PostForm("key"), Name: c.PostForm("name"), Description: c.PostForm("description")})
+	catalogDone(c, "Filter saved.", err)
+}
+
+// DeleteFilter removes a filter
+func DeleteFilter(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	catalogDone(c, "Filter removed.", ops.DeleteFilter(c, uint(id)))
+}
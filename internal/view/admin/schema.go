@@ -0,0 +1,142 @@
+package admin
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/units"
+	"gitlab.com/edea-dev/edea-server/internal/view"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// paramRow is a parameter of the schema with its bounds and allowed values formatted for the form
+type paramRow struct {
+	model.CategoryParam
+	MinText  string
+	MaxText  string
+	EnumText string
+}
+
+// CategoryParams shows the parameter schema of a category
+func CategoryParams(c *gin.Context) {
+	renderSchema(c, c.Query("message"), nil)
+}
+
+func renderSchema(c *gin.Context, message string, err error) {
+	category := new(model.Category)
+	if result := model.DB.WithContext(c).First(category, "id = ?", categoryID(c.Param("id"))); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.Redirect(http.StatusSeeOther, "/admin/catalog?message="+url.QueryEscape("There is no such category."))
+			return
+		}
+		zap.L().Panic("could not fetch category", zap.Error(result.Error))
+	}
+
+	params, perr := ops.CategoryParams(c, category.ID)
+	if perr != nil {
+		zap.L().Panic("could not fetch category params", zap.Error(perr))
+	}
+
+	rows := make([]paramRow, 0, len(params))
+	for _, p := range params {
+		row := paramRow{CategoryParam: p, EnumText: strings.Join(p.EnumValues(), ", ")}
+		if p.Min != nil {
+			row.MinText = units.Format(*p.Min, p.Unit)
+		}
+		if p.Max != nil {
+			row.MaxText = units.Format(*p.Max, p.Unit)
+		}
+		rows = append(rows, row)
+	}
+
+	m := map[string]interface{}{
+		"Category": category,
+		"Params":   rows,
+		"Types":    model.ParamTypes,
+		"Units":    units.Units,
+		"Message":  message,
+	}
+	if err != nil {
+		m["Error"] = err.Error()
+	}
+
+	view.RenderTemplate(c, "admin/schema.tmpl", "EDeA - Category Parameters", m)
+}
+
+// schemaDone redirects back to the schema or shows the mistake of the admin, anything else is a bug
+func schemaDone(c *gin.Context, message string, err error) {
+	switch {
+	case err == nil:
+		c.Redirect(http.StatusSeeOther, "/admin/categories/"+categoryID(c.Param("id"))+"/params?message="+url.QueryEscape(message))
+	case errors.Is(err, ops.ErrInvalidParam), errors.Is(err, ops.ErrParamExists), errors.Is(err, gorm.ErrRecordNotFound):
+		renderSchema(c, "", err)
+	default:
+		zap.L().Panic("could not change the category params", zap.Error(err))
+	}
+}
+
+// paramForm reads a parameter definition from the posted form
+func paramForm(c *gin.Context) (*model.CategoryParam, error) {
+	position, _ := strconv.Atoi(c.PostForm("position"))
+
+	p := &model.CategoryParam{
+		CategoryID:  categoryID(c.Param("id")),
+		Key:         c.PostForm("key"),
+		Name:        c.PostForm("name"),
+		Description: c.PostForm("description"),
+		Type:        c.PostForm("type"),
+		Unit:        c.PostForm("unit"),
+		Required:    c.PostForm("required") != "",
+		Enum:        ops.EnumJSON(strings.Split(c.PostForm("enum"), ",")),
+		Position:    position,
+	}
+
+	var err error
+	if p.Min, err = ops.ParseBound(c.PostForm("min"), p.Unit); err != nil {
+		return nil, err
+	}
+	if p.Max, err = ops.ParseBound(c.PostForm("max"), p.Unit); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// CreateCategoryParam adds a parameter to the schema of a category
+func CreateCategoryParam(c *gin.Context) {
+	p, err := paramForm(c)
+	if err == nil {
+		_, err = ops.CreateCategoryParam(c, p)
+	}
+	schemaDone(c, "Parameter created.", err)
+}
+
+// UpdateCategoryParam changes the definition of a parameter
+func UpdateCategoryParam(c *gin.Context) {
+	p, err := paramForm(c)
+	if err == nil {
+		_, err = ops.UpdateCategoryParam(c, paramID(c.Param("pid")), p)
+	}
+	schemaDone(c, "Parameter saved.", err)
+}
+
+// DeleteCategoryParam removes a parameter from the schema of a category
+func DeleteCategoryParam(c *gin.Context) {
+	schemaDone(c, "Parameter removed.", ops.DeleteCategoryParam(c, categoryID(c.Param("id")), paramID(c.Param("pid"))))
+}
+
+// paramID returns the id of a parameter or the nil uuid, which no parameter has
+func paramID(id string) uuid.UUID {
+	u, _ := uuid.Parse(id)
+	return u
+}
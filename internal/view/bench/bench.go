@@ -3,19 +3,16 @@ package bench
 // SPDX-License-Identifier: EUPL-1.2
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
-	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"gitlab.com/edea-dev/edea-server/internal/merge"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
 	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
 	"gitlab.com/edea-dev/edea-server/internal/search"
-	"gitlab.com/edea-dev/edea-server/internal/util"
 	"gitlab.com/edea-dev/edea-server/internal/view"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -72,7 +69,7 @@ func viewHelper(id, tmpl string, c *gin.Context) {
 
 	// load further information
 	var benchMods []model.BenchModule
-	result = model.DB.Preload("Module").Preload("Module.User").Preload(clause.Associations).Where("bench_id = ?", id).Find(&benchMods)
+	result = model.DB.Preload("Module").Preload("Module.User").Preload(clause.Associations).Where("bench_id = ?", id).Order("position").Find(&benchMods)
 	if result.Error != nil {
 		zap.L().Panic("could not get the bench modules", zap.Error(result.Error))
 	}
@@ -158,20 +155,20 @@ func Delete(c *gin.Context) {
 		return
 	}
 
-	result := model.DB.Where("user_id = ?", user.ID).Delete(&model.Bench{}, uuid.MustParse(benchID))
-	if result.Error != nil {
-		zap.L().Panic("could not delete bench", zap.Error(result.Error))
-	}
-
-	// update search index
-	if err := search.DeleteEntry(search.Entry{ID: benchID}); err != nil {
-		zap.L().Panic("could not update search index", zap.Error(err))
+	// also removes it from the search index
+	err := ops.DeleteBench(c, uuid.MustParse(benchID))
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, model.ErrUnauthorized) {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "bench/404.tmpl", errors.New("Bench was not found"))
+		return
+	} else if err != nil {
+		zap.L().Panic("could not delete bench", zap.Error(err))
 	}
 
 	c.Redirect(http.StatusTemporaryRedirect, "/bench/user/me")
 }
 
-// Fork a bench, this only copies it to the current user as we don't have any versioning (yet)
+// Fork a bench, this copies its current state to the current user, see ForkSnapshot for forking a specific version
 func Fork(c *gin.Context) {
 	// Fork a bench
 	user := c.Keys["user"].(*model.User)
@@ -193,65 +190,18 @@ func Fork(c *gin.Context) {
 
 	// load all the modules + configuration as we need to clone them too
 	var benchMods []model.BenchModule
-	result = model.DB.Preload("Module").Where("bench_id = ?", id).Find(&benchMods)
+	result = model.DB.Where("bench_id = ?", id).Order("position").Find(&benchMods)
 	if result.Error != nil {
 		zap.L().Panic("could not get the bench modules", zap.Error(result.Error))
 	}
 
-	// create new bench here
-	b.ID = uuid.Nil
-	b.UserID = user.ID
-	b.Public = false
-	b.Active = true
-
-	tx := model.DB.WithContext(c).Begin()
-
-	tx.Model(&model.Bench{}).Where("user_id = ? and active = true", user.ID).Update("active", false)
-	tx.Create(b)
-
-	if tx.Error != nil {
-		tx.Rollback()
-		zap.L().Panic("could not create the new bench", zap.Error(tx.Error))
-	} else {
-		tx.Commit()
-	}
-
-	var err error
-
-	tx = model.DB.Begin()
-	for _, m := range benchMods {
-		m.ID = uuid.Nil
-		m.BenchID = b.ID
-		if result := tx.Create(&m); result.Error != nil {
-			err = result.Error
-			break
-		}
-	}
-
-	if err == nil {
-		err = tx.Commit().Error
-	}
-
+	fork, err := ops.ForkBench(c, user, b, benchMods)
 	if err != nil {
-		zap.L().Error("could not fork bench", zap.Error(result.Error), zap.String("bench_id", id))
-		tx.Rollback()
-
-		// try to remove the bench we already created now
-		if result := model.DB.Delete(b); result.Error != nil {
-			zap.L().Panic("could not remove newly created bench", zap.Error(result.Error), zap.String("bench_id", b.ID.String()))
-		}
-
-		view.RenderErrTemplate(c, "500.tmpl", fmt.Errorf("could not fork the bench"))
-		return
-	}
-
-	// update search index
-	if err := search.UpdateEntry(search.BenchToEntry(*b)); err != nil {
-		zap.L().Panic("could not update search index", zap.Error(err))
+		zap.L().Panic("could not fork bench", zap.Error(err), zap.String("bench_id", id))
 	}
 
 	// if everything went well, present the user with a newly forked bench
-	viewHelper(b.ID.String(), "bench/update.tmpl", c)
+	viewHelper(fork.ID.String(), "bench/update.tmpl", c)
 }
 
 // Create inserts a new bench
@@ -264,26 +214,10 @@ func Create(c *gin.Context) {
 		return
 	}
 
-	bench.ID = uuid.Nil // prevent the client setting an id
 	bench.Active = true
-	bench.UserID = user.ID
-
-	// set other benches as inactive, activate the requested one
-	tx := model.DB.WithContext(c).Begin()
-
-	tx.Model(&model.Bench{}).Where("user_id = ? and active = true", user.ID).Update("active", false)
-	tx.Create(bench)
-	tx.Commit()
 
-	if tx.Error != nil {
-		zap.L().Panic("could not create a new bench", zap.Error(tx.Error))
-
-		tx.Rollback()
-	}
-
-	// update search index
-	if err := search.UpdateEntry(search.BenchToEntry(*bench)); err != nil {
-		zap.L().Panic("could not update search index", zap.Error(err))
+	if err := ops.CreateBench(c, user, bench); err != nil {
+		zap.L().Panic("could not create a new bench", zap.Error(err))
 	}
 
 	// redirect to newly created module page
@@ -402,38 +336,22 @@ func Merge(c *gin.Context) {
 		userID = user.ID
 	}
 
-	// try to fetch all the benchmodules
-	result := model.DB.WithContext(c).Preload("Modules.Module").Where("id = ? AND (user_id = ? OR public = true)", id, userID).Find(bench)
+	result := model.DB.WithContext(c).Where("id = ? AND (user_id = ? OR public = true)", id, userID).Find(bench)
 	if result.Error != nil {
-		zap.L().Panic("could not create a new bench", zap.Error(result.Error))
+		zap.L().Panic("could not fetch bench", zap.Error(result.Error))
 	}
 
 	if bench.ID == uuid.Nil {
-		zap.L().Panic("could not find bench", zap.Error(result.Error))
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "bench/404.tmpl", errors.New("No such bench"))
+		return
 	}
 
-	// and merge it together
-	b, err := merge.Merge(bench.Name, bench.Modules)
-
-	// show the user the tool output in case of an error while merging
+	// merging runs the edea tool which can take a while, do it in the background
+	job, err := jobs.MergeBench(c, userID, bench)
 	if err != nil {
-		m := map[string]interface{}{
-			"Error":  err,
-			"Output": strings.ReplaceAll(string(b), "\n", "<br>"),
-		}
-		if err, ok := err.(util.HintError); ok {
-			zap.L().Debug("error with hint", zap.Error(err.Err), zap.String("hint", err.Hint))
-			m["Error"] = err.Err
-			m["Hint"] = err.Hint
-		}
-		view.RenderTemplate(c, "bench/merge_error.tmpl", "Merge Error", m)
-		return
+		zap.L().Panic("could not queue bench merge", zap.Error(err))
 	}
 
-	buf := bytes.NewReader(b)
-
-	fileName := fmt.Sprintf("%s.zip", bench.Name)
-
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
-	http.ServeContent(c.Writer, c.Request, fileName, time.Now(), buf)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/jobs/%s", job.ID))
 }
@@ -3,15 +3,19 @@ package bench
 // SPDX-License-Identifier: EUPL-1.2
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
 	"gitlab.com/edea-dev/edea-server/internal/util"
 	"gitlab.com/edea-dev/edea-server/internal/view"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 // AddModule adds a module to the currently active bench
@@ -58,17 +62,69 @@ func AddModule(c *gin.Context) {
 		zap.L().Debug("new bench", zap.Object("bench", bench))
 	}
 
-	benchModule := &model.BenchModule{BenchID: bench.ID, ModuleID: module.ID, Name: module.Name}
+	if _, err := ops.AddBenchModule(c, bench, module, nil); err != nil {
+		zap.L().Panic("could not create a new bench_module for bench", zap.Error(err), zap.String("bench_id", bench.ID.String()))
+	}
 
-	result = model.DB.Create(benchModule)
-	if result.Error != nil {
-		zap.L().Panic("could not create a new bench_module for bench", zap.Error(result.Error), zap.String("bench_id", bench.ID.String()))
+	// offer to add the dependencies which aren't on the bench yet
+	missing, err := ops.MissingDependencies(c, user, bench, module)
+	if err != nil {
+		zap.L().Error("could not resolve module dependencies", zap.Error(err), zap.String("module_id", module.ID.String()))
+	}
+	if len(missing) > 0 {
+		m := map[string]interface{}{
+			"Bench":        bench,
+			"Module":       module,
+			"Dependencies": missing,
+		}
+		view.RenderTemplate(c, "bench/add_dependencies.tmpl", "EDeA - Add Dependencies", m)
+		return
 	}
 
 	// redirect to newly created bench page
 	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/bench/%s", bench.ID))
 }
 
+// AddDependencies adds the selected dependencies of a module to the active bench
+func AddDependencies(c *gin.Context) {
+	user := view.CurrentUser(c)
+
+	module := new(model.Module)
+
+	result := model.DB.Scopes(model.ModulesVisibleTo(user)).Where("id = ?", c.Param("id")).First(module)
+	if result.Error != nil {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "module/add_err.md", util.ErrNoSuchModule)
+		return
+	}
+
+	bench := new(model.Bench)
+
+	result = model.DB.Where("user_id = ? and active = true", user.ID).First(bench)
+	if result.Error != nil {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "bench/404.tmpl", util.ErrNoActiveBench)
+		return
+	}
+
+	include := []uuid.UUID{}
+	for _, s := range c.PostFormArray("module") {
+		if id, err := uuid.Parse(s); err == nil {
+			include = append(include, id)
+		}
+	}
+
+	if _, err := ops.AddBenchDependencies(c, user, bench, module, include); errors.Is(err, ops.ErrUnknownRevision) {
+		c.Status(http.StatusBadRequest)
+		view.RenderErrTemplate(c, "bench/pin_error.tmpl", err)
+		return
+	} else if err != nil {
+		zap.L().Panic("could not add module dependencies to bench", zap.Error(err), zap.String("bench_id", bench.ID.String()))
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/bench/%s", bench.ID))
+}
+
 // RemoveModule removes a module from the currently active bench
 func RemoveModule(c *gin.Context) {
 	benchModuleID := c.Param("id")
@@ -94,11 +150,49 @@ func RemoveModule(c *gin.Context) {
 		return
 	}
 
-	result = model.DB.Where("id = ?", benchModuleID).Delete(&model.BenchModule{})
-	if result.Error != nil {
-		zap.L().Panic("could not remove bench_module from bench", zap.Error(result.Error), zap.String("bench_id", bench.ID.String()))
+	if err := ops.RemoveBenchModule(c, bench, uuid.MustParse(benchModuleID)); err != nil {
+		zap.L().Panic("could not remove bench_module from bench", zap.Error(err), zap.String("bench_id", bench.ID.String()))
 	}
 
 	// redirect to the current bench
 	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/bench/%s", bench.ID))
 }
+
+// PinModule sets the revision of a module on one of the users benches,
+// without a revision the module is bumped to the latest commit
+func PinModule(c *gin.Context) {
+	user := view.CurrentUser(c)
+
+	bmID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "bench/404.tmpl", util.ErrImSorryDave)
+		return
+	}
+
+	bm := new(model.BenchModule)
+	bench := new(model.Bench)
+
+	// only the owner of the bench can change the revision
+	result := model.DB.First(bm, bmID)
+	if result.Error == nil {
+		result = model.DB.Where("id = ? and user_id = ?", bm.BenchID, user.ID).First(bench)
+	}
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "bench/404.tmpl", util.ErrNoSuchBench)
+		return
+	} else if result.Error != nil {
+		zap.L().Panic("could not fetch bench module", zap.Error(result.Error))
+	}
+
+	if _, err := ops.PinBenchModule(c, bench, bm.ID, strings.TrimSpace(c.PostForm("revision"))); errors.Is(err, ops.ErrUnknownRevision) {
+		c.Status(http.StatusBadRequest)
+		view.RenderErrTemplate(c, "bench/pin_error.tmpl", err)
+		return
+	} else if err != nil {
+		zap.L().Panic("could not pin bench module", zap.Error(err), zap.Object("bench_module", bm))
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/bench/%s", bench.ID))
+}
@@ -0,0 +1,162 @@
+package bench
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"gitlab.com/edea-dev/edea-server/internal/view"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Snapshots lists the snapshots of a bench, the owner can create new ones from here
+func Snapshots(c *gin.Context) {
+	var userID uuid.UUID
+
+	user := view.CurrentUser(c)
+	if user != nil {
+		userID = user.ID
+	}
+
+	bench := new(model.Bench)
+
+	result := model.DB.Where("id = ? and (public = true or user_id = ?)", c.Param("id"), userID).First(bench)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "bench/404.tmpl", errors.New("Bench was not found or is private"))
+		return
+	} else if result.Error != nil {
+		zap.L().Panic("could not get the bench", zap.Error(result.Error))
+	}
+
+	renderSnapshots(c, bench, nil)
+}
+
+func renderSnapshots(c *gin.Context, bench *model.Bench, err error) {
+	var snaps []model.BenchSnapshot
+
+	result := model.DB.Where("bench_id = ?", bench.ID).Order("created_at desc").Find(&snaps)
+	if result.Error != nil {
+		zap.L().Panic("could not get the bench snapshots", zap.Error(result.Error))
+	}
+
+	m := map[string]interface{}{
+		"Bench":     bench,
+		"Snapshots": snaps,
+		"Title":     fmt.Sprintf("EDeA - %s snapshots", bench.Name),
+	}
+	if err != nil {
+		m["Error"] = err.Error()
+	}
+
+	view.RenderTemplate(c, "bench/snapshots.tmpl", "", m)
+}
+
+// CreateSnapshot tags the current state of a bench owned by the user
+func CreateSnapshot(c *gin.Context) {
+	user := view.CurrentUser(c)
+
+	bench := new(model.Bench)
+
+	result := model.DB.Where("id = ? and user_id = ?", c.Param("id"), user.ID).First(bench)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "bench/404.tmpl", util.ErrNoSuchBench)
+		return
+	} else if result.Error != nil {
+		zap.L().Panic("could not get the bench", zap.Error(result.Error))
+	}
+
+	_, err := ops.CreateSnapshot(c, bench, strings.TrimSpace(c.PostForm("name")), c.PostForm("description"))
+	if errors.Is(err, ops.ErrSnapshotExists) || errors.Is(err, ops.ErrEmptyName) {
+		c.Status(http.StatusBadRequest)
+		renderSnapshots(c, bench, err)
+		return
+	} else if err != nil {
+		zap.L().Panic("could not create snapshot", zap.Error(err), zap.Object("bench", bench))
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/bench/snapshots/%s", bench.ID))
+}
+
+// ViewSnapshot shows the modules of a snapshot
+func ViewSnapshot(c *gin.Context) {
+	snap, bench := getSnapshot(c)
+	if snap == nil {
+		return
+	}
+
+	m := map[string]interface{}{
+		"Bench":    bench,
+		"Snapshot": snap,
+		"Title":    fmt.Sprintf("EDeA - %s @ %s", bench.Name, snap.Name),
+	}
+
+	view.RenderTemplate(c, "bench/snapshot.tmpl", "", m)
+}
+
+// MergeSnapshot merges a snapshot into a new kicad project
+func MergeSnapshot(c *gin.Context) {
+	var userID uuid.UUID
+
+	snap, _ := getSnapshot(c)
+	if snap == nil {
+		return
+	}
+
+	if user := view.CurrentUser(c); user != nil {
+		userID = user.ID
+	}
+
+	job, err := jobs.MergeSnapshot(c, userID, snap)
+	if err != nil {
+		zap.L().Panic("could not queue snapshot merge", zap.Error(err))
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/jobs/%s", job.ID))
+}
+
+// ForkSnapshot creates a new bench for the user from a snapshot
+func ForkSnapshot(c *gin.Context) {
+	snap, bench := getSnapshot(c)
+	if snap == nil {
+		return
+	}
+
+	fork, err := ops.ForkBench(c, view.CurrentUser(c), bench, ops.SnapshotModules(snap))
+	if err != nil {
+		zap.L().Panic("could not fork snapshot", zap.Error(err), zap.Object("snapshot", snap))
+	}
+
+	viewHelper(fork.ID.String(), "bench/update.tmpl", c)
+}
+
+func getSnapshot(c *gin.Context) (*model.BenchSnapshot, *model.Bench) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "bench/404.tmpl", util.ErrImSorryDave)
+		return nil, nil
+	}
+
+	snap, bench, err := ops.GetSnapshot(c, view.CurrentUser(c), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "bench/404.tmpl", errors.New("Snapshot was not found or is private"))
+		return nil, nil
+	} else if err != nil {
+		zap.L().Panic("could not get the snapshot", zap.Error(err))
+	}
+
+	return snap, bench
+}
@@ -0,0 +1,114 @@
+package job
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/view"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// View shows the status of a job, the page refreshes itself until the job is done
+func View(c *gin.Context) {
+	job := getJob(c)
+	if job == nil {
+		return
+	}
+
+	// merges are downloaded from the job page, everything else has its own page to go to
+	if job.Status == model.JobDone && job.ResultURL != "" && job.Type != jobs.TypeBenchMerge {
+		c.Redirect(http.StatusSeeOther, job.ResultURL)
+		return
+	}
+
+	m := map[string]interface{}{
+		"Job": job,
+	}
+	if job.Pending() {
+		m["Refresh"] = 2
+	}
+
+	view.RenderTemplate(c, "job/view.tmpl", "EDeA - Job", m)
+}
+
+// List shows the recent jobs of the current user
+func List(c *gin.Context) {
+	var list []model.Job
+
+	user := c.Keys["user"].(*model.User)
+
+	result := model.DB.Where("user_id = ?", user.ID).Order("created_at desc").Limit(50).Find(&list)
+	if result.Error != nil {
+		zap.L().Panic("could not fetch jobs", zap.Error(result.Error))
+	}
+
+	m := map[string]interface{}{
+		"Jobs": list,
+	}
+
+	for _, j := range list {
+		if j.Pending() {
+			m["Refresh"] = 5
+			break
+		}
+	}
+
+	view.RenderTemplate(c, "job/list.tmpl", "EDeA - Jobs", m)
+}
+
+// Download the result of a finished bench merge
+func Download(c *gin.Context) {
+	job := getJob(c)
+	if job == nil {
+		return
+	}
+
+	var res jobs.MergeResult
+
+	if job.Type != jobs.TypeBenchMerge || job.Status != model.JobDone || json.Unmarshal(job.Result, &res) != nil {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "job/404.tmpl", errors.New("this job has nothing to download"))
+		return
+	}
+
+	c.FileAttachment(res.File, res.Name)
+}
+
+// getJob fetches the job from the id parameter, jobs queued by a user are only visible to them
+func getJob(c *gin.Context) *model.Job {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "job/404.tmpl", fmt.Errorf("no such job: %q", c.Param("id")))
+		return nil
+	}
+
+	job, err := jobs.Get(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "job/404.tmpl", fmt.Errorf("no such job: %q", c.Param("id")))
+		return nil
+	} else if err != nil {
+		zap.L().Panic("could not fetch job", zap.Error(err))
+	}
+
+	if job.UserID != uuid.Nil {
+		user := view.CurrentUser(c)
+		if user == nil || (user.ID != job.UserID && !user.IsAdmin) {
+			c.Status(http.StatusNotFound)
+			view.RenderErrTemplate(c, "job/404.tmpl", fmt.Errorf("no such job: %q", c.Param("id")))
+			return nil
+		}
+	}
+
+	return job
+}
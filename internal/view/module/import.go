@@ -0,0 +1,191 @@
+package module
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"gitlab.com/edea-dev/edea-server/internal/view"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ImportForm asks for the repository to import sub-modules from
+func ImportForm(c *gin.Context) {
+	view.RenderTemplate(c, "module/import.tmpl", "EDeA - Import Modules", nil)
+}
+
+// ImportScan queues reading the edea.yml of a repository, the sub-modules are listed once the job is done
+func ImportScan(c *gin.Context) {
+	user := c.Keys["user"].(*model.User)
+	url := strings.TrimSpace(c.PostForm("repourl"))
+
+	if url == "" {
+		m := map[string]interface{}{
+			"Error": "Please enter a repository URL.",
+		}
+		view.RenderTemplate(c, "module/import.tmpl", "EDeA - Import Modules", m)
+		return
+	}
+
+	job, err := jobs.ScanRepository(c, user.ID, url)
+	if err != nil {
+		zap.L().Panic("could not queue repository scan", zap.Error(err), zap.String("repo_url", url))
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/jobs/%s", job.ID))
+}
+
+// ImportSelect lists the sub-modules found by a scan so the user can choose which to import
+func ImportSelect(c *gin.Context) {
+	res, err := scanResult(c, c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "module/404.tmpl", err)
+		return
+	}
+
+	renderImport(c, c.Param("id"), res, "")
+}
+
+// scanResult returns the result of a finished scan
+func scanResult(c *gin.Context, id string) (*jobs.ScanResult, error) {
+	job, err := finishedJob(c, id, jobs.TypeRepoScan)
+	if err != nil {
+		return nil, err
+	}
+
+	res := new(jobs.ScanResult)
+	if err := json.Unmarshal(job.Result, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// finishedJob fetches a job of the given type which is done, jobs are only visible to the user who queued them
+func finishedJob(c *gin.Context, id, typ string) (*model.Job, error) {
+	user := c.Keys["user"].(*model.User)
+	notFound := fmt.Errorf("no such result: %q", id)
+
+	jobID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, notFound
+	}
+
+	job, err := jobs.Get(jobID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, notFound
+	} else if err != nil {
+		zap.L().Panic("could not fetch job", zap.Error(err))
+	}
+
+	if job.Type != typ || job.Status != model.JobDone || job.UserID != user.ID {
+		return nil, notFound
+	}
+
+	return job, nil
+}
+
+func renderImport(c *gin.Context, scan string, res *jobs.ScanResult, msg string) {
+	categories := []model.Category{}
+
+	result := model.DB.Model(&model.Category{}).Order("name").Find(&categories)
+	if result.Error != nil {
+		zap.L().Panic("could not fetch categories", zap.Error(result.Error))
+	}
+
+	m := map[string]interface{}{
+		"Scan":       scan,
+		"RepoURL":    res.RepoURL,
+		"Candidates": res.Candidates,
+		"Categories": categories,
+	}
+	if res.Lint != nil {
+		m["Lint"] = res.Lint
+	}
+	if msg != "" {
+		m["Error"] = msg
+	}
+
+	view.RenderTemplate(c, "module/import_select.tmpl", "EDeA - Import Modules", m)
+}
+
+// renderImportError shows the selection of the scan again, or the form if the scan is gone
+func renderImportError(c *gin.Context, url string, err error) {
+	var hint util.HintError
+	msg := err.Error()
+	if errors.As(err, &hint) {
+		msg = hint.Hint
+	}
+
+	c.Status(http.StatusBadRequest)
+
+	scan := c.PostForm("scan")
+	if res, serr := scanResult(c, scan); serr == nil {
+		renderImport(c, scan, res, msg)
+		return
+	}
+
+	m := map[string]interface{}{
+		"RepoURL": url,
+		"Error":   msg,
+	}
+	view.RenderTemplate(c, "module/import.tmpl", "EDeA - Import Modules", m)
+}
+
+// Import registers the selected sub-modules and queues their import
+func Import(c *gin.Context) {
+	user := c.Keys["user"].(*model.User)
+	url := strings.TrimSpace(c.PostForm("repourl"))
+
+	count, _ := strconv.Atoi(c.PostForm("count"))
+
+	// the form has numbered fields for every sub-module in edea.yml
+	var modules []*model.Module
+	for i := 0; i < count; i++ {
+		if c.PostForm(fmt.Sprintf("import_%d", i)) != "true" {
+			continue
+		}
+		modules = append(modules, &model.Module{
+			Sub:         c.PostForm(fmt.Sprintf("sub_%d", i)),
+			Name:        strings.TrimSpace(c.PostForm(fmt.Sprintf("name_%d", i))),
+			Description: c.PostForm(fmt.Sprintf("description_%d", i)),
+			CategoryID:  c.PostForm(fmt.Sprintf("category_%d", i)),
+			Private:     c.PostForm(fmt.Sprintf("private_%d", i)) == "true",
+		})
+	}
+
+	if len(modules) == 0 {
+		renderImportError(c, url, errors.New("select at least one module to import"))
+		return
+	}
+
+	err := ops.RegisterModules(c, user, url, modules)
+	var hint util.HintError
+	if errors.Is(err, ops.ErrModuleExists) || errors.Is(err, ops.ErrUnknownSubModule) || errors.As(err, &hint) {
+		renderImportError(c, url, err)
+		return
+	} else if err != nil {
+		zap.L().Panic("could not register modules", zap.Error(err), zap.String("repo_url", url))
+	}
+
+	for _, module := range modules {
+		if _, err := jobs.ImportModule(c, user.ID, module); err != nil {
+			zap.L().Panic("could not queue module import", zap.Error(err), zap.String("module_id", module.ID.String()))
+		}
+	}
+
+	c.Redirect(http.StatusSeeOther, "/jobs")
+}
@@ -0,0 +1,74 @@
+package module
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
+	"gitlab.com/edea-dev/edea-server/internal/lint"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/view"
+	"go.uber.org/zap"
+)
+
+// Lint queues checking the edea.yml of a repository before it's added as a module
+func Lint(c *gin.Context) {
+	user := c.Keys["user"].(*model.User)
+
+	url := strings.TrimSpace(c.PostForm("repourl"))
+	if url == "" {
+		url = strings.TrimSpace(c.Query("repourl"))
+	}
+	revision := strings.TrimSpace(c.PostForm("revision"))
+	if revision == "" {
+		revision = strings.TrimSpace(c.Query("revision"))
+	}
+
+	if url == "" {
+		m := map[string]interface{}{
+			"Revision": revision,
+		}
+		view.RenderTemplate(c, "module/lint.tmpl", "EDeA - Check edea.yml", m)
+		return
+	}
+
+	job, err := jobs.LintRepository(c, user.ID, url, revision)
+	if err != nil {
+		zap.L().Panic("could not queue repository lint", zap.Error(err), zap.String("repo_url", url))
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/jobs/%s", job.ID))
+}
+
+// LintResult shows the problems a finished lint found
+func LintResult(c *gin.Context) {
+	job, err := finishedJob(c, c.Param("id"), jobs.TypeRepoLint)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "module/404.tmpl", err)
+		return
+	}
+
+	var p jobs.RepoPayload
+	result := new(lint.Result)
+
+	if err := jobs.Decode(job, &p); err != nil {
+		zap.L().Panic("could not decode lint job", zap.Error(err), zap.Object("job", job))
+	}
+	if err := json.Unmarshal(job.Result, result); err != nil {
+		zap.L().Panic("could not decode lint result", zap.Error(err), zap.Object("job", job))
+	}
+
+	m := map[string]interface{}{
+		"RepoURL":  p.RepoURL,
+		"Revision": p.Revision,
+		"Result":   result,
+	}
+
+	view.RenderTemplate(c, "module/lint.tmpl", "EDeA - Check edea.yml", m)
+}
@@ -17,10 +17,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gitlab.com/edea-dev/edea-server/internal/config"
-	"gitlab.com/edea-dev/edea-server/internal/merge"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
 	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
 	"gitlab.com/edea-dev/edea-server/internal/repo"
-	"gitlab.com/edea-dev/edea-server/internal/search"
 	"gitlab.com/edea-dev/edea-server/internal/util"
 	"gitlab.com/edea-dev/edea-server/internal/view"
 	"go.uber.org/zap"
@@ -47,51 +47,36 @@ func Create(c *gin.Context) {
 		return
 	}
 
-	// check if it already exists and redirect to it if it does
-	tm := model.Module{RepoURL: module.RepoURL, Sub: module.Sub}
-	result := model.DB.Where(&tm).First(&tm)
-	if result.Error != nil {
-		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			zap.S().Panic(result.Error)
-		}
-	} else {
-		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/module/%s", tm.ID))
-		return
-	}
+	module.CredentialID = formCredential(c)
 
-	module.ID = uuid.Nil // prevent the client setting an id
-	module.UserID = user.ID
+	module, err := ops.RegisterModule(c, user, module)
 
-	if err := repo.New(module.RepoURL); err != nil && !errors.Is(err, repo.ErrExists) {
+	var hint util.HintError
+	if errors.Is(err, ops.ErrModuleExists) && module != nil {
+		// redirect to the already existing module page
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/module/%s", module.ID))
+		return
+	} else if errors.Is(err, ops.ErrModuleExists) {
+		// the existing module is private to someone else
+		c.Status(http.StatusConflict)
+		renderNew(c, errors.New("this module has already been added by someone else"))
+		return
+	} else if errors.As(err, &hint) {
+		c.Status(http.StatusBadRequest)
+		renderNew(c, errors.New(hint.Hint))
+		return
+	} else if err != nil {
 		// TODO: display nice error messages
-		zap.L().Panic("module: something went wrong fetching the repository", zap.Error(err))
+		zap.L().Panic("could not create new module", zap.Error(err))
 	}
 
-	meta, err := merge.Metadata(module)
+	// cloning the repository can take a while, let the user watch the progress
+	job, err := jobs.ImportModule(c, user.ID, module)
 	if err != nil {
-		zap.S().Panic(err)
-	}
-
-	module.Metadata = meta
-
-	result = model.DB.WithContext(c).Create(module)
-	if result.Error != nil {
-		zap.L().Panic("could not create new module", zap.Error(result.Error))
+		zap.L().Panic("could not queue module import", zap.Error(err))
 	}
 
-	// get the full object from the database to update it in meilisearch
-	result = model.DB.WithContext(c).Preload("User").Preload("Category").First(module)
-	if result.Error != nil {
-		zap.L().Panic("could not create load new module", zap.Error(result.Error))
-	}
-
-	// update search index
-	if err := search.UpdateEntry(search.ModuleToEntry(*module)); err != nil {
-		zap.L().Panic("could not update search index", zap.Error(err))
-	}
-
-	// redirect to newly created module page
-	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/module/%s", module.ID))
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/jobs/%s", job.ID))
 }
 
 // View a module
@@ -137,15 +122,21 @@ func View(c *gin.Context) {
 		hasDocs = false
 	}
 
+	deps, derr := ops.ResolveDependencies(c, user, module)
+	if derr != nil {
+		zap.L().Error("could not resolve module dependencies", zap.Error(derr), zap.String("module_id", module.ID.String()))
+	}
+
 	// all packed up,
 	m := map[string]interface{}{
-		"Module":  module,
-		"User":    user,
-		"Readme":  readme,
-		"Error":   err,
-		"Author":  mup.DisplayName,
-		"HasDocs": hasDocs,
-		"Title":   fmt.Sprintf("EDeA - %s", module.Name),
+		"Module":       module,
+		"User":         user,
+		"Readme":       readme,
+		"Error":        err,
+		"Author":       mup.DisplayName,
+		"HasDocs":      hasDocs,
+		"Dependencies": deps,
+		"Title":        fmt.Sprintf("EDeA - %s", module.Name),
 	}
 
 	// and ready to go
@@ -154,7 +145,6 @@ func View(c *gin.Context) {
 
 // View a module
 func UpdateView(c *gin.Context) {
-	categories := []model.Category{}
 	user, module := getModule(c)
 
 	// getModule already writes out the necessary error messages
@@ -162,6 +152,13 @@ func UpdateView(c *gin.Context) {
 		return
 	}
 
+	renderUpdate(c, user, module, nil)
+}
+
+// renderUpdate shows the form to update a module with an optional error message
+func renderUpdate(c *gin.Context, user *model.User, module *model.Module, err error) {
+	categories := []model.Category{}
+
 	// get the module author name
 	mup := model.Profile{UserID: module.UserID}
 
@@ -174,14 +171,27 @@ func UpdateView(c *gin.Context) {
 		zap.L().Panic("could not fetch categories", zap.Error(result.Error))
 	}
 
+	// only the credentials of the module owner can be used
+	credentials, cerr := ops.UserCredentials(c, &model.User{ID: module.UserID})
+	if cerr != nil {
+		zap.L().Panic("could not fetch repository credentials", zap.Error(cerr))
+	}
+
+	credentialID := ""
+	if module.CredentialID != nil {
+		credentialID = module.CredentialID.String()
+	}
+
 	// all packed up,
 	m := map[string]interface{}{
-		"Module":     module,
-		"User":       user,
-		"Error":      nil,
-		"Author":     mup.DisplayName,
-		"Title":      fmt.Sprintf("EDeA - %s", module.Name),
-		"Categories": categories,
+		"Module":       module,
+		"User":         user,
+		"Error":        err,
+		"Author":       mup.DisplayName,
+		"Title":        fmt.Sprintf("EDeA - %s", module.Name),
+		"Categories":   categories,
+		"Credentials":  credentials,
+		"CredentialID": credentialID,
 	}
 
 	// and ready to go
@@ -190,7 +200,6 @@ func UpdateView(c *gin.Context) {
 
 // Update a module and reload the page
 func Update(c *gin.Context) {
-	var tm model.Module
 	var module = new(model.Module)
 	moduleID := uuid.MustParse(c.Param("id"))
 
@@ -199,31 +208,23 @@ func Update(c *gin.Context) {
 		return
 	}
 
-	result := model.DB.First(&tm, moduleID)
-	if result.Error != nil {
-		zap.S().Panic(result.Error)
-	}
-
-	tm.Name = module.Name
-	tm.Description = module.Description
-	tm.Private = module.Private
-	tm.CategoryID = module.CategoryID
+	module.CredentialID = formCredential(c)
 
-	result = model.DB.WithContext(c).Save(&tm)
-	if result.Error != nil {
-		zap.L().Panic("could not update module", zap.Error(result.Error))
-	}
+	updated, err := ops.UpdateModule(c, moduleID, module)
 
-	// get the full object from the database to update it in meilisearch
-	result = model.DB.WithContext(c).Preload("User").Preload("Category").First(module)
-	if result.Error != nil {
-		zap.L().Panic("could not create load new module", zap.Error(result.Error))
-	}
-
-	// update search index
-	if err := search.UpdateEntry(search.ModuleToEntry(*module)); err != nil {
-		zap.L().Panic("could not update search index", zap.Error(err))
+	var hint util.HintError
+	if errors.As(err, &hint) {
+		user, current := getModule(c)
+		if current == nil {
+			return
+		}
+		c.Status(http.StatusBadRequest)
+		renderUpdate(c, user, current, errors.New(hint.Hint))
+		return
+	} else if err != nil {
+		zap.L().Panic("could not update module", zap.Error(err))
 	}
+	module = updated
 
 	// redirect to updated module page
 	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/module/%s", module.ID))
@@ -243,14 +244,8 @@ func Delete(c *gin.Context) {
 		return
 	}
 
-	result := model.DB.WithContext(c).Delete(&model.Module{ID: uuid.MustParse(moduleID)})
-	if result.Error != nil {
-		zap.L().Panic("could not delete module", zap.Error(result.Error))
-	}
-
-	// update search index
-	if err := search.UpdateEntry(search.Entry{ID: moduleID}); err != nil {
-		zap.L().Panic("could not update search index", zap.Error(err))
+	if err := ops.DeleteModule(c, uuid.MustParse(moduleID)); err != nil {
+		zap.L().Panic("could not delete module", zap.Error(err))
 	}
 
 	c.Redirect(http.StatusSeeOther, "/")
@@ -258,6 +253,11 @@ func Delete(c *gin.Context) {
 
 // New module form
 func New(c *gin.Context) {
+	renderNew(c, nil)
+}
+
+// renderNew shows the form to add a module with an optional error message
+func renderNew(c *gin.Context, err error) {
 	categories := []model.Category{}
 
 	result := model.DB.Model(&model.Category{}).Find(&categories)
@@ -265,13 +265,31 @@ func New(c *gin.Context) {
 		zap.L().Panic("could not fetch categories", zap.Error(result.Error))
 	}
 
+	credentials, err2 := ops.UserCredentials(c, view.CurrentUser(c))
+	if err2 != nil {
+		zap.L().Panic("could not fetch repository credentials", zap.Error(err2))
+	}
+
 	m := map[string]interface{}{
-		"Categories": categories,
+		"Categories":  categories,
+		"Credentials": credentials,
+	}
+	if err != nil {
+		m["Error"] = err.Error()
 	}
 
 	view.RenderTemplate(c, "module/new.tmpl", "EDeA - New Module", m)
 }
 
+// formCredential returns the credentials selected in a module form, nil for public repositories
+func formCredential(c *gin.Context) *uuid.UUID {
+	id, err := uuid.Parse(c.PostForm("credential"))
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
 // Pull a module repository
 func Pull(c *gin.Context) {
 	moduleID := c.Param("id")
@@ -299,57 +317,13 @@ func Pull(c *gin.Context) {
 		return
 	}
 
-	g := &repo.Git{URL: module.RepoURL}
-	if err := g.Pull(); err != nil {
-		zap.L().Panic("could not pull latest changes", zap.Error(err))
-	}
-
-	// new head, delete all visual diff caches referencing this
-	destCacheDir := filepath.Join(config.Cfg.Cache.Plot.Base, module.ID.String())
-
-	err := filepath.WalkDir(destCacheDir, func(path string, d fs.DirEntry, err error) error {
-		if d.IsDir() {
-			if strings.Contains(d.Name(), "HEAD") {
-				return os.RemoveAll(path)
-			}
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		zap.L().Panic("could not remove visual diff cache", zap.Error(err), zap.String("module", moduleID))
-	}
-
-	meta, err := merge.Metadata(module)
+	job, err := jobs.PullModule(c, user.ID, module)
 	if err != nil {
-		zap.L().Error("metadata extraction unsuccessful", zap.Error(err))
-		view.RenderErrTemplate(c, "module/view.tmpl", err)
-		return
-	}
-
-	module.Metadata = meta
-
-	result = model.DB.WithContext(c).Save(module)
-	if result.Error != nil {
-		zap.L().Panic("could not update submodule", zap.Error(result.Error))
-	}
-
-	// get the full object from the database to update it in meilisearch
-	result = model.DB.WithContext(c).Preload("User").Preload("Category").First(module)
-	if result.Error != nil {
-		zap.L().Panic("could not create load new module", zap.Error(result.Error))
-	}
-
-	// update search index
-	if err := search.UpdateEntry(search.ModuleToEntry(*module)); err != nil {
-		zap.L().Panic("could not update search index", zap.Error(err))
+		zap.L().Panic("could not queue module pull", zap.Error(err), zap.String("module", moduleID))
 	}
 
-	zap.L().Info("pulled repo for module", zap.String("repo_url", module.RepoURL), zap.String("module_id", module.ID.String()))
-
-	// redirect to updated module page
-	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/module/%s", module.ID))
+	// the job page redirects to the updated module page once it's done
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/jobs/%s", job.ID))
 }
 
 // ViewHistory provides a commit log of a module
@@ -391,7 +365,7 @@ func ViewHistory(c *gin.Context) {
 
 // Diff a module's revisions
 func Diff(c *gin.Context) {
-	_, module := getModule(c)
+	user, module := getModule(c)
 
 	// getModule already writes out the necessary error messages
 	if module == nil {
@@ -401,52 +375,32 @@ func Diff(c *gin.Context) {
 	commit1 := c.Query("a")
 	commit2 := c.Query("b")
 
-	zap.S().Debugf("diffing %s and %s", commit1, commit2)
-
-	g := &repo.Git{URL: module.RepoURL}
-
-	subPlotDir := filepath.Join(module.Sub, "plot")
-
-	tmpDest, err := os.MkdirTemp("", "plot-diff")
-	if err != nil {
-		zap.L().Panic("could not create temp dir for diff", zap.Error(err))
-	}
-	defer os.RemoveAll(tmpDest)
+	// plotting and diffing takes a while, render it in the background if it's not cached yet
+	if !ops.HasDiff(module, commit1, commit2) {
+		var userID uuid.UUID
+		if user != nil {
+			userID = user.ID
+		}
 
-	plotA, err := g.ExportPlotDirAt(tmpDest, subPlotDir, commit1)
-	if err != nil {
-		zap.L().Panic("failed to plot sch a", zap.Error(err))
-	}
+		job, err := jobs.DiffModule(c, userID, module, commit1, commit2)
+		if err != nil {
+			zap.L().Panic("could not queue module diff", zap.Error(err))
+		}
 
-	plotB, err := g.ExportPlotDirAt(tmpDest, subPlotDir, commit2)
-	if err != nil {
-		zap.L().Panic("failed to plot sch b", zap.Error(err))
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/jobs/%s", job.ID))
+		return
 	}
 
-	modDiffDir := filepath.Join(module.ID.String(), fmt.Sprintf("%s-%s", commit1, commit2))
+	modDiffDir := ops.DiffDir(module, commit1, commit2)
 	destCacheDir := filepath.Join(config.Cfg.Cache.Plot.Base, modDiffDir)
 
-	if s, err := os.Stat(destCacheDir); err == nil {
-		if s.IsDir() {
-			zap.L().Debug("plot diff cache already exists", zap.String("dir", destCacheDir))
-		}
-	} else {
-		if os.IsNotExist(err) {
-			err := plotDiff(plotA, plotB, destCacheDir)
-			if err != nil {
-				view.RenderErrTemplate(c, "module/plot_error.tmpl", err)
-				return
-			}
-		}
-	}
-
 	// get all files from dir
 	var files = make(map[string]struct {
 		Full string
 		Crop string
 	})
 
-	err = filepath.WalkDir(destCacheDir, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(destCacheDir, func(path string, d fs.DirEntry, err error) error {
 		if !d.IsDir() {
 			ext := filepath.Ext(d.Name())
 			if ext != ".png" {
@@ -499,38 +453,6 @@ func Diff(c *gin.Context) {
 	view.RenderTemplate(c, "module/view_diff.tmpl", "EDeA - Diff", m)
 }
 
-func plotDiff(dirA, dirB, dest string) error {
-	err := os.MkdirAll(dest, 0700)
-	if err != nil {
-		zap.L().Panic("could not create plot diff output dir, check plot cache setting", zap.Error(err), zap.String("plot-cache-dir", config.Cfg.Cache.Plot.Base))
-	}
-
-	// processing projects should not take longer than a minute
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-
-	argv := []string{"-m", "edea", "--diff", "--output", dest, dirA, dirB}
-
-	zap.L().Debug("edea diff", zap.String("command", strings.Join(argv, " ")))
-
-	plotCmd := exec.CommandContext(ctx, "python3", argv...)
-
-	// run the plotting operation
-	logOutput, err := plotCmd.CombinedOutput()
-
-	// return the output of the tool and the error for the user to debug issues
-	if err != nil {
-		zap.L().Debug("plot pcb output", zap.ByteString("output", logOutput))
-		_ = os.RemoveAll(dest)
-		return util.HintError{
-			Hint: fmt.Sprintf("Error while running edea diff:\n%s", logOutput),
-			Err:  err,
-		}
-	}
-
-	return nil
-}
-
 func getModule(c *gin.Context) (user *model.User, module *model.Module) {
 	moduleID := c.Param("id")
 
@@ -550,11 +472,7 @@ func getModule(c *gin.Context) (user *model.User, module *model.Module) {
 	var result *gorm.DB
 	module = new(model.Module)
 
-	if user == nil {
-		result = model.DB.Where("id = ? and private = false", moduleID).Preload("Category").Find(module)
-	} else {
-		result = model.DB.Where("id = ? and (private = false or user_id = ?)", moduleID, user.ID).Preload("Category").Find(module)
-	}
+	result = model.DB.Scopes(model.ModulesVisibleTo(user)).Where("id = ?", moduleID).Preload("Category").Find(module)
 
 	if result.Error != nil {
 		zap.L().Error("could not get the module", zap.Error(result.Error))
@@ -633,41 +551,3 @@ func BuildBook(c *gin.Context) {
 
 	c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("/module/doc/%s", module.ID))
 }
-
-func PullAllRepos(c *gin.Context) {
-	var modules []model.Module
-
-	result := model.DB.Preload("User").Preload("Category").Find(&modules)
-	if result.Error != nil {
-		zap.L().Panic("could not fetch all modules", zap.Error(result.Error))
-	}
-
-	for _, mod := range modules {
-		g := &repo.Git{URL: mod.RepoURL}
-		repo.Add(mod.RepoURL)
-		if err := g.Pull(); err != nil {
-			zap.L().Error("could not pull latest changes", zap.Error(err))
-			continue
-		}
-
-		meta, err := merge.Metadata(&mod)
-		if err != nil {
-			zap.L().Error("metadata extraction unsuccessful", zap.Error(err))
-			continue
-		}
-
-		mod.Metadata = meta
-
-		result = model.DB.WithContext(c).Save(mod)
-		if result.Error != nil {
-			zap.L().Error("could not update module", zap.Error(err))
-			continue
-		}
-
-		// update search index
-		if err := search.UpdateEntry(search.ModuleToEntry(mod)); err != nil {
-			zap.L().Error("could not update search index", zap.Error(err))
-			continue
-		}
-	}
-}
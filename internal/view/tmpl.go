@@ -17,7 +17,8 @@ import (
 
 var (
 	tmplFunctions = map[string]interface{}{
-		"icon": Icon,
+		"icon":  Icon,
+		"bytes": Bytes,
 	}
 )
 
@@ -32,6 +33,22 @@ func Icon(name string) (html string, err error) {
 	return
 }
 
+// Bytes formats a size in bytes for humans, e.g. 1.5 MiB
+func Bytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 // RenderTemplate renders a go template
 func RenderTemplate(c *gin.Context, fn, title string, data map[string]interface{}) {
 	tmplFile := filepath.Join(tmplPath, fn)
@@ -60,6 +77,13 @@ func RenderTemplate(c *gin.Context, fn, title string, data map[string]interface{
 		} else {
 			data["BenchModCount"] = moduleCount
 		}
+
+		var unread int64
+		result = model.DB.Model(&model.Notification{}).Where("user_id = ? AND read_at IS NULL", u.ID).Count(&unread)
+		if result.Error != nil {
+			zap.L().Panic("could not query unread notification count", zap.Error(result.Error))
+		}
+		data["UnreadCount"] = unread
 	}
 
 	// create an empty template to associate our own functions to
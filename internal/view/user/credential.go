@@ -0,0 +1,64 @@
+package user
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"gitlab.com/edea-dev/edea-server/internal/view"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// CreateCredential stores credentials for private repositories, the secret is never shown again
+func CreateCredential(c *gin.Context) {
+	u := c.Keys["user"].(*model.User)
+
+	cred := &model.Credential{
+		Name:     c.PostForm("name"),
+		Kind:     c.PostForm("kind"),
+		Username: c.PostForm("username"),
+	}
+
+	err := ops.CreateCredential(c, u, cred, c.PostForm("secret"))
+
+	var hint util.HintError
+	if errors.As(err, &hint) {
+		c.Status(http.StatusBadRequest)
+		renderProfile(c, u, map[string]interface{}{"CredentialError": hint.Hint})
+		return
+	} else if err != nil {
+		zap.L().Panic("could not store credentials", zap.Error(err))
+	}
+
+	zap.L().Info("stored repository credentials", zap.String("user_id", u.ID.String()), zap.String("credential_id", cred.ID.String()), zap.String("kind", cred.Kind))
+
+	c.Redirect(http.StatusSeeOther, "/profile")
+}
+
+// DeleteCredential removes credentials of the current user
+func DeleteCredential(c *gin.Context) {
+	u := c.Keys["user"].(*model.User)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err == nil {
+		err = ops.DeleteCredential(c, u, id)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || id == uuid.Nil {
+			c.Status(http.StatusNotFound)
+			view.RenderErrTemplate(c, "profile.tmpl", fmt.Errorf("no such credentials"))
+			return
+		}
+		zap.L().Panic("could not delete credentials", zap.Error(err))
+	}
+
+	c.Redirect(http.StatusSeeOther, "/profile")
+}
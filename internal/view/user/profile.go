@@ -3,10 +3,16 @@ package user
 // SPDX-License-Identifier: EUPL-1.2
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
+	"gitlab.com/edea-dev/edea-server/internal/mail"
 	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/secret"
+	"gitlab.com/edea-dev/edea-server/internal/util"
 	"gitlab.com/edea-dev/edea-server/internal/view"
 	"go.uber.org/zap"
 )
@@ -15,21 +21,65 @@ import (
 func Profile(c *gin.Context) {
 	u := c.Keys["user"].(*model.User)
 
+	renderProfile(c, u, nil)
+}
+
+// renderProfile shows the profile page with additional template data
+func renderProfile(c *gin.Context, u *model.User, data map[string]interface{}) {
+	var tokens []model.Token
+
 	p := model.Profile{UserID: u.ID}
 
 	if result := model.DB.Where(&p).First(&p); result.Error != nil {
 		zap.L().Panic("could not fetch profile data", zap.Error(result.Error), zap.String("subject", u.AuthUUID))
 	}
 
+	if result := model.DB.Where("user_id = ?", u.ID).Order("created_at").Find(&tokens); result.Error != nil {
+		zap.L().Panic("could not fetch access tokens", zap.Error(result.Error), zap.String("subject", u.AuthUUID))
+	}
+
+	credentials, err := ops.UserCredentials(c, u)
+	if err != nil {
+		zap.L().Panic("could not fetch repository credentials", zap.Error(err), zap.String("subject", u.AuthUUID))
+	}
+
+	searches, err := ops.SavedSearches(c, u)
+	if err != nil {
+		zap.L().Panic("could not fetch saved searches", zap.Error(err), zap.String("subject", u.AuthUUID))
+	}
+
+	var categories []model.Category
+	if result := model.DB.Find(&categories); result.Error != nil {
+		zap.L().Panic("could not fetch categories", zap.Error(result.Error))
+	}
+	categoryNames := make(map[string]string, len(categories))
+	for _, cat := range categories {
+		categoryNames[cat.ID] = cat.Name
+	}
+
+	notifications, err := ops.Notifications(c, u, 20)
+	if err != nil {
+		zap.L().Panic("could not fetch notifications", zap.Error(err), zap.String("subject", u.AuthUUID))
+	}
+
 	// TODO: fetch profile data from cache, or more data to display
-	data := map[string]interface{}{
-		"Profile": p,
+	if data == nil {
+		data = make(map[string]interface{})
 	}
+	data["Profile"] = p
+	data["Tokens"] = tokens
+	data["Credentials"] = credentials
+	data["CredentialsEnabled"] = secret.Enabled()
+	data["Scopes"] = model.Scopes
+	data["SavedSearches"] = describeSavedSearches(searches, categoryNames)
+	data["Notifications"] = notifications
+	data["MailEnabled"] = mail.Enabled()
+	data["Message"] = c.Query("message")
 
 	view.RenderTemplate(c, "profile.tmpl", "EDeA - Profile", data)
 }
 
-// UpdateProfile updates the user data
+// UpdateProfile updates the user data, a new email address gets a confirmation link
 func UpdateProfile(c *gin.Context) {
 	// update the id of the current user only
 	u := c.Keys["user"].(*model.User)
@@ -40,12 +90,34 @@ func UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	profile.UserID = u.ID
+	profile, confirm, err := ops.UpdateProfile(c, u, profile)
+	if err != nil {
+		zap.L().Panic("could not update profile", zap.Error(err))
+	}
+
+	if confirm {
+		if _, err := jobs.ConfirmEmail(c, profile); err != nil {
+			zap.L().Panic("could not queue the email confirmation", zap.Error(err))
+		}
+	}
 
-	result := model.DB.WithContext(c).Save(profile)
-	if result.Error != nil {
-		zap.L().Panic("could not update profile", zap.Error(result.Error))
+	c.Redirect(http.StatusSeeOther, "/profile#email")
+}
+
+// ConfirmEmail confirms the email address of the current user with the link of the confirmation email
+func ConfirmEmail(c *gin.Context) {
+	u := c.Keys["user"].(*model.User)
+
+	err := ops.ConfirmEmail(c, u, c.Query("token"))
+
+	var hint util.HintError
+	if errors.As(err, &hint) {
+		c.Status(http.StatusBadRequest)
+		renderProfile(c, u, map[string]interface{}{"EmailError": hint.Hint})
+		return
+	} else if err != nil {
+		zap.L().Panic("could not confirm email address", zap.Error(err))
 	}
 
-	c.Redirect(http.StatusSeeOther, "/profile")
+	c.Redirect(http.StatusSeeOther, "/profile#email")
 }
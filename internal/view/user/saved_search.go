@@ -0,0 +1,214 @@
+package user
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/ops"
+	"gitlab.com/edea-dev/edea-server/internal/search"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"gitlab.com/edea-dev/edea-server/internal/view"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// savedSearch is a saved search with a readable description and a link to run it again
+type savedSearch struct {
+	model.SavedSearch
+	Summary string
+	URL     string
+}
+
+// SaveSearch saves the search of the full text or parametric search page
+func SaveSearch(c *gin.Context) {
+	u := c.Keys["user"].(*model.User)
+
+	s := &model.SavedSearch{
+		Name:  c.PostForm("name"),
+		Kind:  c.PostForm("kind"),
+		Text:  c.PostForm("text"),
+		Email: c.PostForm("email") == "on",
+	}
+
+	if s.Kind == model.SavedSearchText {
+		filters := make(map[string][]string)
+		for _, f := range search.Facets {
+			if values := c.PostFormArray(f); len(values) > 0 {
+				filters[f] = values
+			}
+		}
+		s.Filters, _ = json.Marshal(filters)
+	} else {
+		s.CategoryID = c.PostForm("category")
+		if params := c.PostForm("params"); params != "" {
+			s.Params = []byte(params)
+		}
+	}
+
+	err := ops.CreateSavedSearch(c, u, s)
+
+	var hint util.HintError
+	if errors.As(err, &hint) {
+		c.Status(http.StatusBadRequest)
+		renderProfile(c, u, map[string]interface{}{"SavedSearchError": hint.Hint})
+		return
+	} else if err != nil {
+		zap.L().Panic("could not save search", zap.Error(err))
+	}
+
+	c.Redirect(http.StatusSeeOther, "/profile?message="+url.QueryEscape(fmt.Sprintf("Saved the search %q", s.Name))+"#saved-searches")
+}
+
+// UpdateSavedSearch renames a saved search of the current user or changes whether it's sent by email
+func UpdateSavedSearch(c *gin.Context) {
+	u := c.Keys["user"].(*model.User)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		savedSearchNotFound(c)
+		return
+	}
+
+	s := new(model.SavedSearch)
+	if result := model.DB.Where("id = ? AND user_id = ?", id, u.ID).First(s); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			savedSearchNotFound(c)
+			return
+		}
+		zap.L().Panic("could not fetch saved search", zap.Error(result.Error))
+	}
+
+	s.Name = c.PostForm("name")
+	s.Email = c.PostForm("email") == "on"
+
+	_, err = ops.UpdateSavedSearch(c, u, id, s)
+
+	var hint util.HintError
+	if errors.As(err, &hint) {
+		c.Status(http.StatusBadRequest)
+		renderProfile(c, u, map[string]interface{}{"SavedSearchError": hint.Hint})
+		return
+	} else if err != nil {
+		zap.L().Panic("could not update saved search", zap.Error(err))
+	}
+
+	c.Redirect(http.StatusSeeOther, "/profile#saved-searches")
+}
+
+// DeleteSavedSearch removes a saved search of the current user
+func DeleteSavedSearch(c *gin.Context) {
+	u := c.Keys["user"].(*model.User)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err == nil {
+		err = ops.DeleteSavedSearch(c, u, id)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || id == uuid.Nil {
+			savedSearchNotFound(c)
+			return
+		}
+		zap.L().Panic("could not delete saved search", zap.Error(err))
+	}
+
+	c.Redirect(http.StatusSeeOther, "/profile#saved-searches")
+}
+
+func savedSearchNotFound(c *gin.Context) {
+	c.Status(http.StatusNotFound)
+	view.RenderErrTemplate(c, "profile.tmpl", fmt.Errorf("no such saved search"))
+}
+
+// OpenNotification marks a notification of the current user as read and shows the module it's about
+func OpenNotification(c *gin.Context) {
+	u := c.Keys["user"].(*model.User)
+
+	id, err := uuid.Parse(c.Param("id"))
+	var n *model.Notification
+	if err == nil {
+		n, err = ops.ReadNotification(c, u, id)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || id == uuid.Nil {
+			c.Status(http.StatusNotFound)
+			view.RenderErrTemplate(c, "profile.tmpl", fmt.Errorf("no such notification"))
+			return
+		}
+		zap.L().Panic("could not read notification", zap.Error(err))
+	}
+
+	if n.ModuleID == nil {
+		c.Redirect(http.StatusSeeOther, "/profile#notifications")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/module/"+n.ModuleID.String())
+}
+
+// ReadNotifications marks all notifications of the current user as read
+func ReadNotifications(c *gin.Context) {
+	u := c.Keys["user"].(*model.User)
+
+	if err := ops.ReadAllNotifications(c, u); err != nil {
+		zap.L().Panic("could not mark notifications as read", zap.Error(err))
+	}
+
+	c.Redirect(http.StatusSeeOther, "/profile#notifications")
+}
+
+// describeSavedSearches adds a summary and a link to the search page to the saved searches
+func describeSavedSearches(searches []model.SavedSearch, categories map[string]string) []savedSearch {
+	described := make([]savedSearch, len(searches))
+
+	for i, s := range searches {
+		var parts []string
+		values := make(url.Values)
+
+		if s.Text != "" {
+			parts = append(parts, fmt.Sprintf("%q", s.Text))
+		}
+
+		if s.Kind == model.SavedSearchText {
+			var filters map[string][]string
+			_ = json.Unmarshal(s.Filters, &filters)
+
+			values.Set("q", s.Text)
+			for _, f := range search.Facets {
+				if len(filters[f]) > 0 {
+					parts = append(parts, fmt.Sprintf("%s: %s", f, strings.Join(filters[f], ", ")))
+					values[f] = filters[f]
+				}
+			}
+			described[i] = savedSearch{SavedSearch: s, URL: "/search?" + values.Encode()}
+		} else {
+			var params []search.SearchParam
+			_ = json.Unmarshal(s.Params, &params)
+
+			for _, p := range params {
+				parts = append(parts, strings.TrimSpace(fmt.Sprintf("%s %s %s", p.Field, p.Op, strings.Join(p.Values, " | "))))
+			}
+			if s.CategoryID != "" {
+				parts = append(parts, "category: "+categories[s.CategoryID])
+				values.Set("category", s.CategoryID)
+			}
+
+			values.Set("query", s.Text)
+			if len(params) > 0 {
+				values.Set("params", string(s.Params))
+			}
+			described[i] = savedSearch{SavedSearch: s, URL: "/module/search?" + values.Encode()}
+		}
+
+		described[i].Summary = strings.Join(parts, "; ")
+	}
+
+	return described
+}
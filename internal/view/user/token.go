@@ -0,0 +1,89 @@
+package user
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/edea-dev/edea-server/internal/auth"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"gitlab.com/edea-dev/edea-server/internal/util"
+	"gitlab.com/edea-dev/edea-server/internal/view"
+	"go.uber.org/zap"
+)
+
+// CreateToken creates a new personal access token and shows it once on the profile page
+func CreateToken(c *gin.Context) {
+	u := c.Keys["user"].(*model.User)
+
+	name := strings.TrimSpace(c.PostForm("name"))
+	if name == "" {
+		renderProfile(c, u, map[string]interface{}{"TokenError": "please give the token a name"})
+		return
+	}
+
+	var scopes []string
+	for _, s := range c.PostFormArray("scopes") {
+		if !model.ValidScope(s) {
+			view.RenderErrTemplate(c, "profile.tmpl", util.ErrImSorryDave)
+			return
+		}
+		if s == model.ScopeAdmin && !u.IsAdmin {
+			renderProfile(c, u, map[string]interface{}{"TokenError": "only admins can create tokens with the admin scope"})
+			return
+		}
+		scopes = append(scopes, s)
+	}
+	if len(scopes) == 0 {
+		scopes = []string{model.ScopeRead}
+	}
+
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		zap.L().Panic("could not generate access token", zap.Error(err))
+	}
+
+	t := &model.Token{
+		UserID: u.ID,
+		Name:   name,
+		Prefix: token[:len(auth.TokenPrefix)+4],
+		Hash:   hash,
+		Scopes: strings.Join(scopes, " "),
+	}
+
+	if days, err := strconv.Atoi(c.PostForm("expires")); err == nil && days > 0 {
+		t.ExpiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, days), Valid: true}
+	}
+
+	if result := model.DB.Create(t); result.Error != nil {
+		zap.L().Panic("could not create access token", zap.Error(result.Error))
+	}
+
+	zap.L().Info("created access token", zap.String("user_id", u.ID.String()), zap.String("token_id", t.ID.String()), zap.String("scopes", t.Scopes))
+
+	// this is the only time the user gets to see the token
+	renderProfile(c, u, map[string]interface{}{"NewToken": token})
+}
+
+// RevokeToken deletes a personal access token of the current user
+func RevokeToken(c *gin.Context) {
+	u := c.Keys["user"].(*model.User)
+
+	result := model.DB.Where("id = ? and user_id = ?", c.Param("id"), u.ID).Delete(&model.Token{})
+	if result.Error != nil {
+		zap.L().Panic("could not revoke access token", zap.Error(result.Error))
+	}
+	if result.RowsAffected == 0 {
+		c.Status(http.StatusNotFound)
+		view.RenderErrTemplate(c, "profile.tmpl", fmt.Errorf("no such token"))
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/profile")
+}
@@ -0,0 +1,223 @@
+// Package webhook receives push notifications from GitHub, GitLab and Gitea
+// and refreshes the modules of the pushed repository.
+package webhook
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/edea-dev/edea-server/internal/config"
+	"gitlab.com/edea-dev/edea-server/internal/jobs"
+	"gitlab.com/edea-dev/edea-server/internal/model"
+	"go.uber.org/zap"
+)
+
+// maxPayloadSize limits the size of webhook bodies we're willing to read
+const maxPayloadSize = 1 << 20
+
+var (
+	// ErrInvalidSignature is returned when the signature or token of a webhook doesn't match
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrUnknownProvider is returned for providers we don't support or which aren't configured
+	ErrUnknownProvider = errors.New("unknown or unconfigured webhook provider")
+)
+
+// Push contains the information we need out of a push event
+type Push struct {
+	Ref           string   // pushed ref, e.g. refs/heads/main
+	DefaultBranch string   // default branch of the repository, if the provider sends it
+	URLs          []string // all the urls the repository is known by
+}
+
+// payload covers the push event fields of all three providers
+type payload struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		CloneURL      string `json:"clone_url"`
+		HTMLURL       string `json:"html_url"`
+		SSHURL        string `json:"ssh_url"`
+		GitHTTPURL    string `json:"git_http_url"`
+		GitSSHURL     string `json:"git_ssh_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+	Project struct {
+		WebURL        string `json:"web_url"`
+		GitHTTPURL    string `json:"git_http_url"`
+		GitSSHURL     string `json:"git_ssh_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"project"`
+}
+
+// Receive handles the webhook requests of all providers
+//
+//	POST /api/v1/hooks/:provider
+func Receive(c *gin.Context) {
+	provider := c.Param("provider")
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPayloadSize))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event, err := verify(provider, c.Request.Header, body)
+	if err != nil {
+		status := http.StatusUnauthorized
+		if errors.Is(err, ErrUnknownProvider) {
+			status = http.StatusNotFound
+		}
+		zap.L().Warn("rejected webhook", zap.Error(err), zap.String("provider", provider), zap.String("remote", c.ClientIP()))
+		c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !isPush(event) {
+		c.JSON(http.StatusOK, gin.H{"status": "ignored", "event": event})
+		return
+	}
+
+	push, err := ParsePush(body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if push.DefaultBranch != "" && push.Ref != "refs/heads/"+push.DefaultBranch {
+		c.JSON(http.StatusOK, gin.H{"status": "ignored", "ref": push.Ref})
+		return
+	}
+
+	modules, err := FindModules(push.URLs)
+	if err != nil {
+		zap.L().Error("could not look up modules for webhook", zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// providers only wait a couple of seconds for a response, so refresh in the background
+	ids := make([]string, 0, len(modules))
+	for i := range modules {
+		if _, err := jobs.PullModule(c, uuid.Nil, &modules[i]); err != nil {
+			zap.L().Error("could not queue webhook refresh", zap.Error(err), zap.String("module_id", modules[i].ID.String()))
+			continue
+		}
+		ids = append(ids, modules[i].ID.String())
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "accepted", "modules": ids})
+}
+
+// verify checks the signature of a request with the configured secret of the
+// provider and returns the event type
+func verify(provider string, h http.Header, body []byte) (event string, err error) {
+	cfg := config.Cfg.Webhook
+
+	switch provider {
+	case "github":
+		if cfg.GitHubSecret == "" {
+			return "", ErrUnknownProvider
+		}
+		sig := strings.TrimPrefix(h.Get("X-Hub-Signature-256"), "sha256=")
+		if !validHMAC(cfg.GitHubSecret, body, sig) {
+			return "", ErrInvalidSignature
+		}
+		return h.Get("X-GitHub-Event"), nil
+	case "gitlab":
+		if cfg.GitLabToken == "" {
+			return "", ErrUnknownProvider
+		}
+		if subtle.ConstantTimeCompare([]byte(cfg.GitLabToken), []byte(h.Get("X-Gitlab-Token"))) != 1 {
+			return "", ErrInvalidSignature
+		}
+		return h.Get("X-Gitlab-Event"), nil
+	case "gitea":
+		if cfg.GiteaSecret == "" {
+			return "", ErrUnknownProvider
+		}
+		if !validHMAC(cfg.GiteaSecret, body, h.Get("X-Gitea-Signature")) {
+			return "", ErrInvalidSignature
+		}
+		return h.Get("X-Gitea-Event"), nil
+	}
+
+	return "", ErrUnknownProvider
+}
+
+// validHMAC compares a hex encoded HMAC-SHA256 signature of the body in constant time
+func validHMAC(secret string, body []byte, signature string) bool {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// isPush returns true for the push event names of all providers
+func isPush(event string) bool {
+	return event == "push" || event == "Push Hook"
+}
+
+// ParsePush extracts the pushed ref and the repository urls out of a push event
+func ParsePush(body []byte) (*Push, error) {
+	var p payload
+
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+
+	push := &Push{Ref: p.Ref, DefaultBranch: p.Repository.DefaultBranch}
+	if push.DefaultBranch == "" {
+		push.DefaultBranch = p.Project.DefaultBranch
+	}
+
+	for _, u := range []string{
+		p.Repository.CloneURL, p.Repository.HTMLURL, p.Repository.SSHURL,
+		p.Repository.GitHTTPURL, p.Repository.GitSSHURL,
+		p.Project.WebURL, p.Project.GitHTTPURL, p.Project.GitSSHURL,
+	} {
+		if u != "" {
+			push.URLs = append(push.URLs, u)
+		}
+	}
+
+	if len(push.URLs) == 0 {
+		return nil, errors.New("push event does not contain a repository url")
+	}
+
+	return push, nil
+}
+
+// NormalizeURL reduces a repository url to host and path so that the different
+// forms (https, ssh, with or without .git) compare equal
+func NormalizeURL(s string) string {
+	return model.NormalizeRepoURL(s)
+}
+
+// FindModules returns all the modules which are registered with one of the urls
+func FindModules(urls []string) ([]model.Module, error) {
+	var modules []model.Module
+
+	// the repository urls are stored as entered by the users, so compare them normalized
+	keys := make([]string, 0, len(urls))
+	for _, u := range urls {
+		keys = append(keys, NormalizeURL(u))
+	}
+
+	result := model.DB.Where("repo_key IN ? and deleted_at is null", keys).Find(&modules)
+	return modules, result.Error
+}
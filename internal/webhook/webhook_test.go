@@ -0,0 +1,117 @@
+package webhook
+
+// SPDX-License-Identifier: EUPL-1.2
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"testing"
+
+	"gitlab.com/edea-dev/edea-server/internal/config"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	config.Cfg.Webhook.GitHubSecret = "gh-secret"
+	config.Cfg.Webhook.GitLabToken = "gl-token"
+	config.Cfg.Webhook.GiteaSecret = "gt-secret"
+
+	body := []byte(`{"ref":"refs/heads/main"}`)
+
+	tests := []struct {
+		name     string
+		provider string
+		header   http.Header
+		err      error
+		event    string
+	}{
+		{"github ok", "github", http.Header{
+			"X-Hub-Signature-256": {"sha256=" + sign("gh-secret", body)},
+			"X-Github-Event":      {"push"},
+		}, nil, "push"},
+		{"github wrong secret", "github", http.Header{
+			"X-Hub-Signature-256": {"sha256=" + sign("nope", body)},
+		}, ErrInvalidSignature, ""},
+		{"github missing signature", "github", http.Header{}, ErrInvalidSignature, ""},
+		{"gitlab ok", "gitlab", http.Header{
+			"X-Gitlab-Token": {"gl-token"},
+			"X-Gitlab-Event": {"Push Hook"},
+		}, nil, "Push Hook"},
+		{"gitlab wrong token", "gitlab", http.Header{"X-Gitlab-Token": {"gl"}}, ErrInvalidSignature, ""},
+		{"gitea ok", "gitea", http.Header{
+			"X-Gitea-Signature": {sign("gt-secret", body)},
+			"X-Gitea-Event":     {"push"},
+		}, nil, "push"},
+		{"gitea wrong secret", "gitea", http.Header{"X-Gitea-Signature": {sign("gh-secret", body)}}, ErrInvalidSignature, ""},
+		{"unknown provider", "bitbucket", http.Header{}, ErrUnknownProvider, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := verify(tt.provider, tt.header, body)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if event != tt.event {
+				t.Fatalf("expected event %q, got %q", tt.event, event)
+			}
+		})
+	}
+}
+
+func TestVerify_Unconfigured(t *testing.T) {
+	config.Cfg.Webhook.GiteaSecret = ""
+
+	body := []byte(`{}`)
+	h := http.Header{"X-Gitea-Signature": {sign("", body)}}
+
+	if _, err := verify("gitea", h, body); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("expected unconfigured provider to be rejected, got %v", err)
+	}
+}
+
+func TestParsePush(t *testing.T) {
+	body := []byte(`{
+		"ref": "refs/heads/main",
+		"project": {
+			"web_url": "https://gitlab.com/edea-dev/test-modules",
+			"git_ssh_url": "git@gitlab.com:edea-dev/test-modules.git",
+			"default_branch": "main"
+		}
+	}`)
+
+	p, err := ParsePush(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.DefaultBranch != "main" || p.Ref != "refs/heads/main" {
+		t.Fatalf("unexpected ref/default branch: %+v", p)
+	}
+	if len(p.URLs) != 2 {
+		t.Fatalf("expected 2 urls, got %v", p.URLs)
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	want := "gitlab.com/edea-dev/test-modules"
+
+	for _, u := range []string{
+		"https://gitlab.com/edea-dev/test-modules",
+		"https://gitlab.com/edea-dev/test-modules.git",
+		"https://GitLab.com/edea-dev/test-modules/",
+		"git@gitlab.com:edea-dev/test-modules.git",
+		"ssh://git@gitlab.com/edea-dev/test-modules.git",
+	} {
+		if got := NormalizeURL(u); got != want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", u, got, want)
+		}
+	}
+}